@@ -0,0 +1,56 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+)
+
+// nodeAction implements NewAction
+type nodeAction struct {
+	node       bt.Node
+	effects    Effects
+	conditions []IConditions
+}
+
+// NewAction returns an [Action] using the given node, effects, and conditions, see [TryNewAction], noting that it
+// will panic if they are invalid.
+func NewAction(node bt.Node, effects Effects, conditions ...IConditions) IAction {
+	action, err := TryNewAction(node, effects, conditions...)
+	if err != nil {
+		panic(err)
+	}
+	return action
+}
+
+// TryNewAction returns an [Action] using the given node, effects, and conditions, which will be returned (as-is) by
+// [Action.Node], [Action.Effects], and [Action.Conditions], respectively. An error will be returned if node is nil,
+// or if there are no effects.
+func TryNewAction(node bt.Node, effects Effects, conditions ...IConditions) (IAction, error) {
+	if node == nil {
+		return nil, fmt.Errorf(`pabt: nil action node`)
+	}
+	if len(effects) == 0 {
+		return nil, fmt.Errorf(`pabt: no action effects`)
+	}
+	return &nodeAction{node: node, effects: effects, conditions: conditions}, nil
+}
+
+func (a *nodeAction) Conditions() []IConditions { return a.conditions }
+func (a *nodeAction) Effects() Effects          { return a.effects }
+func (a *nodeAction) Node() bt.Node             { return a.node }
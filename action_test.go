@@ -0,0 +1,77 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"testing"
+)
+
+func TestNewAction(t *testing.T) {
+	var (
+		node       = failureNode()
+		effects    = Effects{Eff(`x`, 1), Eff(`y`, 2)}
+		conditions = []IConditions{{EqCond(`z`, 1)}, {EqCond(`w`, 1), EqCond(`v`, 1)}}
+		action     = NewAction(node, effects, conditions...)
+	)
+	if v := action.Node(); fmt.Sprintf(`%p`, v) != fmt.Sprintf(`%p`, node) {
+		t.Error(v)
+	}
+	if v := action.Effects(); len(v) != 2 || v[0] != effects[0] || v[1] != effects[1] {
+		t.Error(v)
+	}
+	if v := action.Conditions(); len(v) != 2 || len(v[0]) != 1 || v[0][0] != conditions[0][0] || len(v[1]) != 2 || v[1][0] != conditions[1][0] || v[1][1] != conditions[1][1] {
+		t.Error(v)
+	}
+	if v := NewAction(node, effects).Conditions(); v != nil {
+		t.Error(v)
+	}
+}
+
+func TestTryNewAction(t *testing.T) {
+	for _, tc := range []struct {
+		Name    string
+		Node    bt.Node
+		Effects Effects
+		Err     string
+	}{
+		{`nil node`, nil, Effects{Eff(`x`, 1)}, `pabt: nil action node`},
+		{`no effects`, failureNode(), nil, `pabt: no action effects`},
+		{`valid`, failureNode(), Effects{Eff(`x`, 1)}, ``},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			action, err := TryNewAction(tc.Node, tc.Effects)
+			if tc.Err == `` {
+				if err != nil || action == nil {
+					t.Error(action, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.Err || action != nil {
+				t.Error(action, err)
+			}
+			defer func() {
+				if r := recover(); fmt.Sprint(r) != tc.Err {
+					t.Error(r)
+				}
+			}()
+			NewAction(tc.Node, tc.Effects)
+			t.Error(`expected panic`)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+type (
+	// funcCondition implements Cond and EqCond, noting that it's always used as a pointer, to ensure it's comparable
+	funcCondition struct {
+		key   any
+		match func(value any) bool
+	}
+
+	// valueEffect implements Eff, noting that it's always used as a pointer, to ensure it's comparable
+	valueEffect struct {
+		key   any
+		value any
+	}
+)
+
+// Cond returns a [Condition] for the variable identified by key, which must be comparable, that uses match to
+// implement [Condition.Match]. Each call returns a distinct (comparable) value, e.g. for use with [WithActionsCache].
+func Cond(key any, match func(value any) bool) Condition {
+	return &funcCondition{key: key, match: match}
+}
+
+// EqCond returns a [Condition], like [Cond], that matches values equal to want, where values that aren't comparable
+// to want will not match, rather than panicking.
+func EqCond(key, want any) Condition {
+	return Cond(key, func(value any) (ok bool) {
+		defer func() { _ = recover() }()
+		return value == want
+	})
+}
+
+// Eff returns an [Effect] for the variable identified by key, which must be comparable, with the given value.
+func Eff(key, value any) Effect {
+	return &valueEffect{key: key, value: value}
+}
+
+func (c *funcCondition) Key() any             { return c.key }
+func (c *funcCondition) Match(value any) bool { return c.match(value) }
+func (e *valueEffect) Key() any               { return e.key }
+func (e *valueEffect) Value() any             { return e.value }
@@ -0,0 +1,92 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	bt "github.com/joeycumines/go-behaviortree"
+	"testing"
+)
+
+func TestEqCond(t *testing.T) {
+	type key struct{ name string }
+	condition := EqCond(key{`x`}, 1)
+	if condition.Key() != (key{`x`}) {
+		t.Error(condition.Key())
+	}
+	for _, tc := range []struct {
+		Value any
+		Match bool
+	}{
+		{1, true},
+		{2, false},
+		{`1`, false},
+		{int64(1), false},
+		{nil, false},
+		{[]int{1}, false},
+	} {
+		if v := condition.Match(tc.Value); v != tc.Match {
+			t.Errorf(`%#v: %v`, tc.Value, v)
+		}
+	}
+	// non-comparable want never matches
+	if EqCond(`y`, []int{1}).Match([]int{1}) {
+		t.Error(`expected no match`)
+	}
+	// distinct values
+	if EqCond(`x`, 1) == EqCond(`x`, 1) {
+		t.Error(`expected distinct conditions`)
+	}
+}
+
+func TestCond(t *testing.T) {
+	condition := Cond(`x`, func(value any) bool { return value.(int) > 1 })
+	if condition.Key() != `x` || condition.Match(1) || !condition.Match(2) {
+		t.Error(condition)
+	}
+}
+
+func TestEff(t *testing.T) {
+	effect := Eff(`x`, 1)
+	if effect.Key() != `x` || effect.Value() != 1 {
+		t.Error(effect)
+	}
+}
+
+func TestEqCond_plan(t *testing.T) {
+	x := 0
+	state := &mockState{
+		variable: func(key any) (any, error) { return x, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			return []IAction{&simpleAction{
+				effects: Effects{Eff(`x`, 1)},
+				node: bt.New(func([]bt.Node) (bt.Status, error) {
+					x = 1
+					return bt.Success, nil
+				}),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{EqCond(`x`, 1)}}, WithActionsCache[Condition]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bt.Status{bt.Running, bt.Success} {
+		if status, err := plan.Node().Tick(); err != nil || status != expected {
+			t.Fatal(i, status, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOT writes the current tree as a Graphviz DOT digraph, intended for debugging. Each vertex is labelled with the
+// role of the node (goal, ppa, action, or precondition), and either the tick type (Sequence, Selector, or Memorize),
+// for group nodes, or the key, for condition leaves. Edges are from each parent to its children, in order.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) DOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph {\n")
+	if p.root != nil {
+		ids := make(map[*node[T]]int)
+		p.root.walk(0, func(n *node[T], _ int) {
+			id := len(ids)
+			ids[n] = id
+			fmt.Fprintf(&b, "\tn%d [label=\"%s\"];\n", id, dotEscape(n.dotLabel()))
+			if n.parent != nil {
+				fmt.Fprintf(&b, "\tn%d -> n%d;\n", ids[n.parent], id)
+			}
+		})
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotLabel returns the DOT label for the receiver, as lines
+func (n *node[T]) dotLabel() []string {
+	label := []string{n.kind()}
+	if n.precondition != nil && n.node != nil {
+		label = append(label, fmt.Sprint(n.precondition.condition.Key()))
+	}
+	if n.node == nil {
+		label = append(label, tickKind(n.tick))
+	}
+	return label
+}
+
+// dotEscape joins lines as a DOT string literal (without the enclosing quotes)
+func dotEscape(lines []string) string {
+	for i, line := range lines {
+		lines[i] = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(line)
+	}
+	return strings.Join(lines, `\n`)
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"bytes"
+	"flag"
+	bt "github.com/joeycumines/go-behaviortree"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool(`update`, false, `update golden files`)
+
+func TestPlan_DOT_singlePrecondition(t *testing.T) {
+	plan, err := INew(
+		&mockState{variable: func(key any) (any, error) { return nil, nil }},
+		[]IConditions{{&mockCondition{
+			key:   func() any { return 3 },
+			match: func(value any) bool { return value == `3` },
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := plan.DOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join(`testdata`, `dot_single_precondition.golden`)
+	if *updateGolden {
+		if err := os.WriteFile(golden, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != string(expected) {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestPlan_DOT_expanded(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			if failed.Key() != `x` {
+				return nil, nil
+			}
+			return []IAction{
+				&simpleAction{
+					conditions: []IConditions{{&simpleCondition{key: `y"z`, value: 1}}},
+					effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+					node:       failureNode(),
+				},
+				&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node:    failureNode(),
+				},
+			}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}, {&simpleCondition{key: `w`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	var b bytes.Buffer
+	if err := plan.DOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	if strings.Count(s, `->`) != plan.Stats().Nodes-1 {
+		t.Error(s)
+	}
+	for _, label := range []string{
+		`n0 [label="goal\nSelector"];`,
+		`[label="ppa\nSelector"];`,
+		`[label="ppa\nMemorize"];`,
+		`[label="precondition\nx"];`,
+		`[label="precondition\nw"];`,
+		`[label="precondition\ny\"z"];`,
+		`[label="action\nSequence"];`,
+		`[label="action"];`,
+	} {
+		if !strings.Contains(s, label) {
+			t.Errorf("missing %s:\n%s", label, s)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"iter"
+)
+
+type (
+	// dryRunState implements State for Plan.DryRun, overlaying the values of simulated effects on the actual state
+	dryRunState[T Condition] struct {
+		State[T]
+		values map[any]any
+	}
+
+	// dryRunStreamingState implements StreamingState for Plan.DryRun, used if the actual state is a StreamingState,
+	// as embedding State hides StreamingState.ActionsSeq
+	dryRunStreamingState[T Condition] struct {
+		*dryRunState[T]
+		streaming StreamingState[T]
+	}
+)
+
+// DryRun computes the tree that would achieve the goal, assuming every action succeeds, without ticking any
+// [Action.Node]. Instead, the effects of each action are applied to a shadow copy of the state variables, which
+// initially resolve via [State.Variable]. Planning proceeds using a separate tree, configured with the same options,
+// excluding observers, [WithInvalidate], [WithTimeline], and [WithMaintain], for up to maxSteps ticks, returning a
+// [PlanSnapshot] of the tree once the goal is satisfied. An error will be returned if the goal wasn't satisfied
+// within maxSteps, or if planning failed, in which case the snapshot is of the tree at that point. Note that
+// [GuardCondition] values are always evaluated against the actual state, and that [State.Actions] (or
+// [StreamingState.ActionsSeq]) must not modify the actual state.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) DryRun(maxSteps int) (PlanSnapshot, error) {
+	if maxSteps <= 0 {
+		return PlanSnapshot{}, fmt.Errorf(`pabt: invalid dry run max steps: %d`, maxSteps)
+	}
+
+	state := &dryRunState[T]{State: p.state, values: make(map[any]any)}
+	shadow := Plan[T]{config: p.config}
+	shadow.state = state
+	if streaming, ok := p.state.(StreamingState[T]); ok {
+		shadow.state = &dryRunStreamingState[T]{dryRunState: state, streaming: streaming}
+	}
+	shadow.simulate = state.simulate
+	// excluded options
+	shadow.expandObserver = nil
+	shadow.conflictObs = nil
+	shadow.invalidate = nil
+	shadow.timeline = false
+	// success would otherwise never be returned
+	shadow.maintain = false
+	// per-plan state, note that cached actions may depend on the (actual) state
+	shadow.actionsCache = nil
+	shadow.expansions = 0
+	shadow.refined = nil
+	shadow.ticked = false
+	shadow.maintained = false
+	shadow.reusable = nil
+	shadow.entries = nil
+	if err := shadow.init(); err != nil {
+		return PlanSnapshot{}, err
+	}
+
+	for step := 1; step <= maxSteps; step++ {
+		status, err := shadow.Node().Tick()
+		if err != nil {
+			return shadow.Snapshot(), err
+		}
+		switch status {
+		case bt.Success:
+			return shadow.Snapshot(), nil
+		case bt.Failure:
+			return shadow.Snapshot(), fmt.Errorf(`pabt: dry run failed after %d steps`, step)
+		}
+	}
+
+	return shadow.Snapshot(), fmt.Errorf(`pabt: dry run exceeded %d steps`, maxSteps)
+}
+
+func (s *dryRunState[T]) Variable(key any) (any, error) {
+	if value, ok := s.values[key]; ok {
+		return value, nil
+	}
+	return s.State.Variable(key)
+}
+
+// simulate returns a node that applies the effects of act, in place of it's node
+func (s *dryRunState[T]) simulate(act Action[T]) bt.Node {
+	return bt.New(func([]bt.Node) (bt.Status, error) {
+		for _, effect := range act.Effects() {
+			s.values[effect.Key()] = effect.Value()
+		}
+		return bt.Success, nil
+	})
+}
+
+func (s *dryRunStreamingState[T]) ActionsSeq(failed T) iter.Seq2[Action[T], error] {
+	return s.streaming.ActionsSeq(failed)
+}
@@ -0,0 +1,217 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"errors"
+	bt "github.com/joeycumines/go-behaviortree"
+	"iter"
+	"reflect"
+	"testing"
+)
+
+// countKind returns the number of nodes of the given kind, in the snapshot
+func countKind(n *NodeSnapshot, kind string) (count int) {
+	if n == nil {
+		return
+	}
+	if n.Kind == kind {
+		count++
+	}
+	for i := range n.Children {
+		count += countKind(&n.Children[i], kind)
+	}
+	return
+}
+
+func TestPlan_DryRun(t *testing.T) {
+	state := newGraphState()
+	// actions would fail, if they were ticked
+	state.frozen = true
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := plan.DryRun(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// s0 -> s1 -> (s3 or s4) -> sg is at least three actions
+	if n := countKind(snapshot.Root, `action`); n < 3 {
+		t.Errorf("expected at least 3 actions, got %d", n)
+	}
+
+	// the actual state and plan are unaffected
+	if state.actor.name != `s0` {
+		t.Error(state.actor.name)
+	}
+	if v := plan.Snapshot(); countKind(v.Root, `action`) != 0 || plan.Stats().Expansions != 0 {
+		t.Error(plan.Stats())
+	}
+
+	// the dry run is repeatable, and matches the actual plan
+	if v, err := plan.DryRun(100); err != nil || !reflect.DeepEqual(v, snapshot) {
+		t.Error(v, err)
+	}
+	state.frozen = false
+	for i := 0; ; i++ {
+		if i > 100 {
+			t.Fatal(`too many ticks`)
+		}
+		if status, err := plan.Node().Tick(); err != nil {
+			t.Fatal(err)
+		} else if status != bt.Running {
+			break
+		}
+	}
+	if state.actor.name != `sg` {
+		t.Error(state.actor.name)
+	}
+	if v := plan.Snapshot(); !reflect.DeepEqual(v, snapshot) {
+		t.Errorf("expected the actual tree to match the dry run:\n%+v\n%+v", v, snapshot)
+	}
+}
+
+func TestPlan_DryRun_maxSteps(t *testing.T) {
+	state := newGraphState()
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plan.DryRun(0); err == nil || err.Error() != `pabt: invalid dry run max steps: 0` {
+		t.Error(err)
+	}
+	snapshot, err := plan.DryRun(1)
+	if err == nil || err.Error() != `pabt: dry run exceeded 1 steps` {
+		t.Error(err)
+	}
+	if countKind(snapshot.Root, `action`) == 0 {
+		t.Error(`expected the partial tree`)
+	}
+	if state.actor.name != `s0` {
+		t.Error(state.actor.name)
+	}
+}
+
+func TestPlan_DryRun_options(t *testing.T) {
+	var (
+		unresolvable bool
+		observed     int
+	)
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) {
+				if unresolvable {
+					return nil, errors.New(`some error`)
+				}
+				return 0, nil
+			},
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node:    bt.New(func([]bt.Node) (bt.Status, error) { return bt.Failure, nil }),
+				}}, nil
+			},
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithValidateVariables[Condition](),
+		WithExpandObserver[Condition](func(failed Condition, actions []IAction) { observed++ }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// observers are excluded
+	if _, err := plan.DryRun(10); err != nil {
+		t.Fatal(err)
+	}
+	if observed != 0 {
+		t.Error(observed)
+	}
+
+	// other options are retained
+	unresolvable = true
+	if _, err := plan.DryRun(10); err == nil || err.Error() != `pabt: unresolvable goal variable (string, x): some error` {
+		t.Error(err)
+	}
+}
+
+func TestPlan_DryRun_maintain(t *testing.T) {
+	var ticks int
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						ticks++
+						return bt.Running, nil
+					}),
+				}}, nil
+			},
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithMaintain[Condition](),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := plan.DryRun(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countKind(snapshot.Root, `action`) == 0 {
+		t.Error(`expected the action`)
+	}
+	if ticks != 0 {
+		t.Error(ticks)
+	}
+}
+
+func TestPlan_DryRun_streaming(t *testing.T) {
+	var streamed int
+	plan, err := INew(
+		&streamingState{
+			mockState: mockState{
+				variable: func(key any) (any, error) { return 0, nil },
+				actions:  func(failed Condition) ([]IAction, error) { panic(`unexpected call`) },
+			},
+			actionsSeq: func(failed Condition) iter.Seq2[IAction, error] {
+				return func(yield func(IAction, error) bool) {
+					streamed++
+					yield(&simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}}, node: bt.New(nil)}, nil)
+				}
+			},
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := plan.DryRun(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countKind(snapshot.Root, `action`) == 0 {
+		t.Error(`expected the action`)
+	}
+	if streamed != 1 {
+		t.Error(streamed)
+	}
+}
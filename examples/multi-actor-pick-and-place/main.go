@@ -0,0 +1,135 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+// Command multi-actor-pick-and-place runs two planning actors in one shared world, where both need the same cube on
+// the same goal, each with it's own (independent) plan. The actor that loses the race for the cube re-plans, while
+// the other holds it, and both plans succeed once the cube is placed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	bt "github.com/joeycumines/go-behaviortree"
+	"github.com/joeycumines/go-pabt/examples/tcell-pick-and-place/logic"
+	"github.com/joeycumines/go-pabt/examples/tcell-pick-and-place/sim"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	os.Exit(run(os.Args[0], os.Args[1:]))
+}
+
+func run(cmd string, args []string) int {
+	var (
+		flags   = flag.NewFlagSet(cmd, flag.ContinueOnError)
+		logfile string
+		exit    bool
+	)
+	flags.StringVar(&logfile, `logfile`, ``, `write log output to file`)
+	flags.BoolVar(&exit, `exit`, false, `exit once all plans succeed`)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if flags.NArg() != 0 {
+		log.Printf("expected no args\n")
+		flags.Usage()
+		return 1
+	}
+
+	if logfile != `` {
+		f, err := os.OpenFile(logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.ModePerm)
+		if err != nil {
+			log.Printf("logfile open error: %s\n", err)
+			return 1
+		}
+		defer f.Close()
+		log.SetOutput(f)
+	} else {
+		log.SetOutput(io.Discard)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	screen, err := tcell.NewScreen()
+	if err == nil {
+		err = screen.Init()
+	}
+	if err != nil {
+		log.Printf(`screen init error: %s`, err)
+		return 1
+	}
+	defer screen.Fini()
+
+	simulation, err := sim.New(sim.Config{
+		Screen:      screen,
+		Scenario:    `multi-actor`,
+		PlanOverlay: true,
+	})
+	if err != nil {
+		log.Printf(`sim init error: %s`, err)
+		return 1
+	}
+
+	// each actor has it's own plan, ticked independently, stopping once it succeeds (or fails with an error)
+	var tickers []bt.Ticker
+	for i, actor := range simulation.State().PlanConfig.Actors {
+		name := fmt.Sprintf(`actors[%d]`, i)
+		tickers = append(tickers, bt.NewTickerStopOnFailure(ctx, time.Millisecond*10, bt.New(
+			bt.Not(bt.All),
+			logic.PickAndPlace(ctx, simulation, actor),
+		)))
+		log.Printf("plan started for %s\n", name)
+	}
+
+	var (
+		exitCode int
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for i, ticker := range tickers {
+			<-ticker.Done()
+			if err := ticker.Err(); err == context.Canceled {
+				return
+			} else if err != nil {
+				log.Printf("plan error for actors[%d]: %s\n", i, err)
+				exitCode = 1
+				cancel()
+				return
+			}
+			log.Printf("plan success for actors[%d]\n", i)
+		}
+		if exit {
+			cancel()
+		}
+	}()
+
+	if err := simulation.Run(ctx); err != nil && err != context.Canceled {
+		log.Printf(`sim run error: %s`, err)
+		return 1
+	}
+	cancel()
+	<-done
+	return exitCode
+}
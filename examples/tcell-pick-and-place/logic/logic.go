@@ -18,22 +18,32 @@
 package logic
 
 import (
+	"cmp"
+	"container/heap"
 	"context"
 	"fmt"
 	bt "github.com/joeycumines/go-behaviortree"
 	"github.com/joeycumines/go-pabt"
 	"github.com/joeycumines/go-pabt/examples/tcell-pick-and-place/sim"
+	"iter"
 	"log"
-	"math"
+	"slices"
 	"sync"
 )
 
 type (
+	// Option configures PickAndPlace
+	Option func(p *pickAndPlace)
+
 	pickAndPlace struct {
 		ctx        context.Context
 		simulation sim.Simulation
 		actor      sim.Actor
-		moveState  struct {
+		// searchRadius limits the positions considered by templatePlace and templateMove, see WithSearchRadius
+		searchRadius int32
+		// planOptions are passed through to the plan, see WithPlanOptions
+		planOptions []pabt.IOption
+		moveState    struct {
 			mu     sync.Mutex
 			cancel context.CancelFunc
 			done   chan struct{}
@@ -66,7 +76,12 @@ type (
 		Actor sim.Actor
 	}
 	heldItemValue struct {
+		// item is the top of items (the only one that may be placed), or nil
 		item sim.Sprite
+		// items are all held items, in the order grasped
+		items []sim.Sprite
+		// capacity is the maximum len(items), see sim.Config.InventorySize
+		capacity int
 	}
 
 	// positionVar is used to map changes to the physical position of each sprite, relative to other(s)
@@ -74,8 +89,11 @@ type (
 		Sprite sim.Sprite
 	}
 	positionValue struct {
-		// positions are all the _relevant_ sprite positions
+		// positions are all the _relevant_ sprite positions, which must be accessed via the position method
 		positions map[sim.Sprite]*positionInfo
+		// override (if non-nil) replaces the position of sprite, without copying (or modifying) positions
+		sprite   sim.Sprite
+		override *positionInfo
 	}
 
 	// CONDITIONS
@@ -110,36 +128,92 @@ var (
 	_ pabt.IState = (*pickAndPlace)(nil)
 )
 
-func PickAndPlace(ctx context.Context, simulation sim.Simulation, actor sim.Actor) bt.Node {
+// WithSearchRadius limits the positions considered when templating place and move actions to those within radius
+// (per axis) of the actor, or any cube or goal in it's criteria, rather than the entire space, trading completeness
+// for faster refinement, where a radius <= 0 (the default) considers the entire space
+func WithSearchRadius(radius int32) Option {
+	return func(p *pickAndPlace) { p.searchRadius = radius }
+}
+
+// WithPlanOptions provides additional options for the underlying plan, e.g. [pabt.WithMaintain] to keep the cubes on
+// their goals, rather than succeeding once they are placed
+func WithPlanOptions(opts ...pabt.IOption) Option {
+	return func(p *pickAndPlace) { p.planOptions = append(p.planOptions, opts...) }
+}
+
+func PickAndPlace(ctx context.Context, simulation sim.Simulation, actor sim.Actor, opts ...Option) bt.Node {
 	state := &pickAndPlace{
 		ctx:        ctx,
 		simulation: simulation,
 		actor:      actor,
 	}
+	for _, opt := range opts {
+		opt(state)
+	}
+
+	// only used to validate shapes against the (fixed) bounds of the space, and to expand criteria wildcards
+	bounds := simulation.State()
 
 	var successConditions []pabt.IConditions
 	for pair := range actor.Criteria() {
-		successConditions = append(successConditions, pabt.IConditions{
-			// cube is on the goal (at least partially, though cubes are only 1x1 anyway)
-			&simpleCond{
-				key: positionVar{Sprite: pair.Cube},
-				match: func(r any) bool {
-					var (
-						positions = r.(*positionValue).positions
-						cubePos   = positions[pair.Cube]
-						goalPos   = positions[pair.Goal]
-					)
-					return cubePos != nil &&
-						goalPos != nil &&
-						cubePos.Shape != nil &&
-						goalPos.Shape != nil &&
-						cubePos.Shape.Collides(goalPos.Shape)
-				},
-			},
-		})
+		// wildcards expand to (disjunctive) success conditions for every matching cube / goal
+		cubes, goals := []sim.Sprite{pair.Cube}, []sim.Sprite{pair.Goal}
+		if pair.AnyCube() || pair.AnyGoal() {
+			if pair.AnyCube() {
+				cubes = nil
+			}
+			if pair.AnyGoal() {
+				goals = nil
+			}
+			for sprite := range bounds.Sprites {
+				switch sprite.(type) {
+				case sim.Cube:
+					if pair.AnyCube() {
+						cubes = append(cubes, sprite)
+					}
+				case sim.Goal:
+					if pair.AnyGoal() {
+						goals = append(goals, sprite)
+					}
+				}
+			}
+		}
+		for _, cube := range cubes {
+			for _, goal := range goals {
+				successConditions = append(successConditions, pabt.IConditions{
+					// cube is on the goal (at least partially, though cubes are only 1x1 anyway)
+					&simpleCond{
+						key: positionVar{Sprite: cube},
+						match: func(r any) bool {
+							var (
+								positions = r.(*positionValue)
+								cubePos   = positions.position(cube)
+								goalPos   = positions.position(goal)
+							)
+							return cubePos != nil &&
+								goalPos != nil &&
+								cubePos.Shape != nil &&
+								goalPos.Shape != nil &&
+								cubePos.Shape.Collides(goalPos.Shape)
+						},
+					},
+				})
+			}
+		}
 	}
 
-	plan, err := pabt.INew(state, successConditions)
+	validator := pabt.WithEffectValidator[pabt.Condition](func(effect pabt.Effect) bool {
+		if v, ok := effect.Value().(*positionValue); ok {
+			for _, pos := range v.all() {
+				if pos.Shape != nil && bounds.ValidateShape(pos.Shape) != nil {
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	plan, err := pabt.INew(state, successConditions, append([]pabt.IOption{validator}, state.planOptions...)...)
 	if err != nil {
 		panic(err)
 	}
@@ -187,6 +261,8 @@ func (p *pickAndPlace) Actions(failed pabt.Condition) (actions []pabt.IAction, e
 			}
 		}
 		snapshot = p.simulation.State()
+		// shared by all templates, which must overlay (see withPosition) rather than modify it
+		positions = snapshotPositions(snapshot)
 	)
 
 	for sprite := range snapshot.Sprites {
@@ -195,33 +271,168 @@ func (p *pickAndPlace) Actions(failed pabt.Condition) (actions []pabt.IAction, e
 		}
 		switch sprite := sprite.(type) {
 		case sim.Cube:
-			if add(`pick`, 0)(p.templatePick(failed, snapshot, sprite)) {
+			if add(`pick`, 0)(p.templatePick(failed, snapshot, positions, sprite)) {
 				return
 			}
 
+			for x, y := range p.positions(snapshot) {
+				if add(`place`, 0)(p.templatePlace(failed, snapshot, positions, x, y, sprite)) {
+					return
+				}
+			}
+		}
+	}
+
+	for x, y := range p.positions(snapshot) {
+		if add(`move`, 0)(p.templateMove(failed, snapshot, positions, x, y)) {
+			return
+		}
+	}
+
+	return
+}
+
+// positions returns the candidate (actor) positions for templatePlace and templateMove, which will be every position
+// in the space, unless limited by WithSearchRadius
+func (p *pickAndPlace) positions(snapshot *sim.State) iter.Seq2[int32, int32] {
+	var centres [][2]int32
+	if p.searchRadius > 0 {
+		add := func(sprite sim.Sprite) {
+			if v, ok := snapshot.Sprites[sprite]; ok {
+				if shape := v.Shape(); shape != nil {
+					x, y := shape.Position()
+					centres = append(centres, [2]int32{x, y})
+				}
+			}
+		}
+		add(p.actor)
+		for pair := range p.actor.Criteria() {
+			if !pair.AnyCube() {
+				add(pair.Cube)
+			}
+			if !pair.AnyGoal() {
+				add(pair.Goal)
+			}
+			if pair.AnyCube() || pair.AnyGoal() {
+				for sprite := range snapshot.Sprites {
+					switch sprite.(type) {
+					case sim.Cube:
+						if pair.AnyCube() {
+							add(sprite)
+						}
+					case sim.Goal:
+						if pair.AnyGoal() {
+							add(sprite)
+						}
+					}
+				}
+			}
+		}
+	}
+	if centres == nil {
+		return func(yield func(x, y int32) bool) {
 			for x := int32(0); x < snapshot.SpaceWidth; x++ {
 				for y := int32(0); y < snapshot.SpaceHeight; y++ {
-					if add(`place`, 0)(p.templatePlace(failed, snapshot, x, y, sprite)) {
+					if !yield(x, y) {
 						return
 					}
 				}
 			}
 		}
 	}
-
-	for x := int32(0); x < snapshot.SpaceWidth; x++ {
-		for y := int32(0); y < snapshot.SpaceHeight; y++ {
-			if add(`move`, 0)(p.templateMove(failed, snapshot, x, y)) {
-				return
+	// iterates the union of the (clamped) boxes around each centre, in the same order as the full space
+	r := p.searchRadius
+	return func(yield func(x, y int32) bool) {
+		var xs, ys [][2]int32
+		for _, c := range centres {
+			xs = append(xs, [2]int32{max(c[0]-r, 0), min(c[0]+r, snapshot.SpaceWidth-1)})
+		}
+		for _, xr := range mergeRanges(xs) {
+			for x := xr[0]; x <= xr[1]; x++ {
+				ys = ys[:0]
+				for _, c := range centres {
+					if abs32(x-c[0]) <= r {
+						ys = append(ys, [2]int32{max(c[1]-r, 0), min(c[1]+r, snapshot.SpaceHeight-1)})
+					}
+				}
+				for _, yr := range mergeRanges(ys) {
+					for y := yr[0]; y <= yr[1]; y++ {
+						if !yield(x, y) {
+							return
+						}
+					}
+				}
 			}
 		}
 	}
+}
 
-	return
+// mergeRanges sorts then merges the inclusive ranges (in place), returning the disjoint ranges, in ascending order,
+// where any empty ranges (min > max) are dropped
+func mergeRanges(ranges [][2]int32) [][2]int32 {
+	ranges = slices.DeleteFunc(ranges, func(v [2]int32) bool { return v[0] > v[1] })
+	slices.SortFunc(ranges, func(a, b [2]int32) int { return cmp.Compare(a[0], b[0]) })
+	var n int
+	for _, v := range ranges {
+		if n != 0 && v[0] <= ranges[n-1][1]+1 {
+			ranges[n-1][1] = max(ranges[n-1][1], v[1])
+			continue
+		}
+		ranges[n] = v
+		n++
+	}
+	return ranges[:n]
 }
 
 func (p *pickAndPlace) getSimulation() sim.Simulation { return p.simulation }
 
+// snapshotPositions returns the position of every sprite in the snapshot
+func snapshotPositions(snapshot *sim.State) map[sim.Sprite]*positionInfo {
+	positions := make(map[sim.Sprite]*positionInfo, len(snapshot.Sprites))
+	for k, v := range snapshot.Sprites {
+		positions[k] = &positionInfo{
+			Space: v.Space(),
+			Shape: v.Shape(),
+		}
+	}
+	return positions
+}
+
+// withPosition returns a value overlaying positions, with the shape of sprite replaced, neither positions nor any of
+// it's values are modified (or copied)
+func withPosition(positions map[sim.Sprite]*positionInfo, sprite sim.Sprite, shape sim.Shape) *positionValue {
+	info := positionInfo{Shape: shape}
+	if v := positions[sprite]; v != nil {
+		info.Space = v.Space
+	}
+	return &positionValue{positions: positions, sprite: sprite, override: &info}
+}
+
+// position returns the position of sprite, or nil if it isn't relevant
+func (v *positionValue) position(sprite sim.Sprite) *positionInfo {
+	if v.override != nil && sprite == v.sprite {
+		return v.override
+	}
+	return v.positions[sprite]
+}
+
+// all iterates every position, in no particular order
+func (v *positionValue) all() iter.Seq2[sim.Sprite, *positionInfo] {
+	return func(yield func(sim.Sprite, *positionInfo) bool) {
+		for sprite, pos := range v.positions {
+			if v.override != nil && sprite == v.sprite {
+				continue
+			}
+			if !yield(sprite, pos) {
+				return
+			}
+		}
+		if v.override != nil {
+			yield(v.sprite, v.override)
+		}
+	}
+}
+
 // templatePick will template actions to pickup the given sprite, note that these actions will be conditional on the
 // sprite remaining in it's current, visible position, since that is critical to the planning (e.g. of actor movement)
 //
@@ -236,7 +447,9 @@ func (p *pickAndPlace) getSimulation() sim.Simulation { return p.simulation }
 //	con: o_r ∈ N_o_cube
 //	     h = /0
 //	eff: h = cube
-func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State, sprite sim.Sprite) (actions []pabt.IAction, err error) {
+//
+// Note that h = /0 is generalised to |h| < capacity, to support an inventory of more than one item (as a stack).
+func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State, positions map[sim.Sprite]*positionInfo, sprite sim.Sprite) (actions []pabt.IAction, err error) {
 	var ox, oy int32
 	if spriteValue, ok := snapshot.Sprites[sprite]; !ok {
 		return
@@ -246,17 +459,14 @@ func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State,
 		ox, oy = spriteShape.Position()
 	}
 
-	positions := make(map[sim.Sprite]*positionInfo, len(snapshot.Sprites))
-	for k, v := range snapshot.Sprites {
-		positions[k] = &positionInfo{
-			Space: v.Space(),
-			Shape: v.Shape(),
-		}
-	}
-	positions[sprite].Shape = nil
+	value := withPosition(positions, sprite, nil)
 
 	pickupDistance := snapshot.PickupDistance
 
+	held := newHeldItemValue(snapshot, p.actor)
+	held.items = append(held.items, sprite)
+	held.item = sprite
+
 	var running bool
 
 	snapshot = nil
@@ -266,7 +476,7 @@ func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State,
 				&simpleCond{
 					key: positionVar{Sprite: sprite},
 					match: func(r any) bool {
-						if pos := r.(*positionValue).positions[sprite]; pos != nil && pos.Shape != nil {
+						if pos := r.(*positionValue).position(sprite); pos != nil && pos.Shape != nil {
 							if running {
 								return true
 							}
@@ -280,16 +490,16 @@ func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State,
 				&simpleCond{
 					key: heldItemVar{Actor: p.actor},
 					match: func(r any) bool {
-						return r.(*heldItemValue).item == nil
+						return !r.(*heldItemValue).full()
 					},
 				},
 				&simpleCond{
 					key: positionVar{Sprite: p.actor},
 					match: func(r any) bool {
 						var (
-							positions = r.(*positionValue).positions
-							spritePos = positions[sprite]
-							actorPos  = positions[p.actor]
+							positions = r.(*positionValue)
+							spritePos = positions.position(sprite)
+							actorPos  = positions.position(p.actor)
 						)
 						return spritePos != nil &&
 							actorPos != nil &&
@@ -303,11 +513,11 @@ func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State,
 		effects: pabt.Effects{
 			&simpleEffect{
 				key:   heldItemVar{Actor: p.actor},
-				value: &heldItemValue{item: sprite},
+				value: held,
 			},
 			&simpleEffect{
 				key:   positionVar{Sprite: sprite},
-				value: &positionValue{positions: positions},
+				value: value,
 			},
 		},
 		node: bt.New(
@@ -328,7 +538,7 @@ func (p *pickAndPlace) templatePick(failed pabt.Condition, snapshot *sim.State,
 //	con: o_r ∈ N_p
 //	     h = i
 //	eff: o_i = p
-func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State, x, y int32, sprite sim.Sprite) (actions []pabt.IAction, err error) {
+func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State, positions map[sim.Sprite]*positionInfo, x, y int32, sprite sim.Sprite) (actions []pabt.IAction, err error) {
 	spriteValue, ok := snapshot.Sprites[sprite]
 	if !ok {
 		return
@@ -336,7 +546,6 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 
 	var (
 		spriteShape      sim.Shape
-		positions        map[sim.Sprite]*positionInfo
 		noCollisionConds pabt.IConditions
 	)
 	{
@@ -354,18 +563,13 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 			return
 		}
 
-		positions = make(map[sim.Sprite]*positionInfo, len(snapshot.Sprites))
-		for k, v := range snapshot.Sprites {
-			positions[k] = &positionInfo{
-				Space: v.Space(),
-				Shape: v.Shape(),
-			}
+		for k := range snapshot.Sprites {
 			if k != p.actor && k != sprite {
 				k := k
 				noCollisionConds = append(noCollisionConds, &simpleCond{
 					key: positionVar{Sprite: k},
 					match: func(r any) bool {
-						if v := r.(*positionValue).positions[k]; v != nil && v.Shape != nil && v.Space.Collides(spriteValue.Space()) && v.Shape.Collides(spriteShape) {
+						if v := r.(*positionValue).position(k); v != nil && v.Shape != nil && v.Space.Collides(spriteValue.Space()) && v.Shape.Collides(spriteShape) {
 							return false
 						}
 						return true
@@ -373,7 +577,15 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 				})
 			}
 		}
-		positions[sprite].Shape = spriteShape
+	}
+	value := withPosition(positions, sprite, spriteShape)
+
+	held := newHeldItemValue(snapshot, p.actor)
+	held.items = slices.DeleteFunc(held.items, func(v sim.Sprite) bool { return v == sprite })
+	if len(held.items) != 0 {
+		held.item = held.items[len(held.items)-1]
+	} else {
+		held.item = nil
 	}
 
 	snapshot = nil
@@ -389,7 +601,7 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 				&simpleCond{
 					key: positionVar{Sprite: p.actor},
 					match: func(r any) bool {
-						if v := r.(*positionValue).positions[p.actor]; v != nil && v.Shape != nil {
+						if v := r.(*positionValue).position(p.actor); v != nil && v.Shape != nil {
 							if cx, cy := v.Shape.Position(); x == cx && y == cy {
 								return true
 							}
@@ -400,14 +612,14 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 			), noCollisionConds...),
 		},
 		effects: pabt.Effects{
-			// actor will not be holding anything
+			// actor will not be holding the sprite
 			&simpleEffect{
 				key:   heldItemVar{Actor: p.actor},
-				value: new(heldItemValue),
+				value: held,
 			},
 			&simpleEffect{
 				key:   positionVar{Sprite: sprite},
-				value: &positionValue{positions: positions},
+				value: value,
 			},
 		},
 		node: bt.New(bt.Async(p.tickPlace(sprite))),
@@ -420,11 +632,10 @@ func (p *pickAndPlace) templatePlace(failed pabt.Condition, snapshot *sim.State,
 // MoveTo(p, τ)
 // con: τ ⊂ CollFree
 // eff: o_r = p
-func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State, x, y int32) (actions []pabt.IAction, err error) {
-	// dumb "pathfinding"
+func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State, positions map[sim.Sprite]*positionInfo, x, y int32) (actions []pabt.IAction, err error) {
 	var (
 		space  sim.Space
-		shapes []sim.Shape
+		target sim.Shape
 	)
 	if actorValue, ok := snapshot.Sprites[p.actor]; !ok {
 		return
@@ -432,48 +643,32 @@ func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State,
 		return
 	} else {
 		space = actorValue.Space()
+		target = shape.Clone()
+		target.SetPosition(x, y)
+	}
 
-		var (
-			cx, cy = actorValue.Position()
-			dx, dy = float64(x) - cx, float64(y) - cy
-		)
-		if d := math.Sqrt(math.Pow(dx, 2) + math.Pow(dy, 2)); !math.IsNaN(d) && !math.IsInf(d, 0) && d > 0 {
-			dx, dy = dx/d, dy/d
-		}
-
-		for nx, ny := sim.RoundPosition(cx, cy); nx != x || ny != y; nx, ny = sim.RoundPosition(cx, cy) {
-			cx += dx
-			cy += dy
-
-			shape = shape.Clone()
-			shape.SetPosition(sim.RoundPosition(cx, cy))
-
-			if snapshot.ValidateShape(shape) != nil {
-				return
-			}
-
-			shapes = append(shapes, shape)
-		}
+	// pathfinding is comparatively expensive, and most destinations won't achieve the failed condition
+	if key, ok := failed.Key().(positionVar); !ok || key.Sprite != p.actor {
+		return
+	}
+	value := withPosition(positions, p.actor, target)
+	if !failed.Match(value) {
+		return
 	}
+
+	shapes := findPath(snapshot, p.actor, x, y)
 	if len(shapes) == 0 {
 		return
 	}
 
-	var (
-		noCollisionConds pabt.IConditions
-		positions        = make(map[sim.Sprite]*positionInfo, len(snapshot.Sprites))
-	)
-	for k, v := range snapshot.Sprites {
-		positions[k] = &positionInfo{
-			Space: v.Space(),
-			Shape: v.Shape(),
-		}
+	var noCollisionConds pabt.IConditions
+	for k := range snapshot.Sprites {
 		if k != p.actor {
 			k := k
 			noCollisionConds = append(noCollisionConds, &simpleCond{
 				key: positionVar{Sprite: k},
 				match: func(r any) bool {
-					if v := r.(*positionValue).positions[k]; v != nil && v.Shape != nil && v.Space.Collides(space) {
+					if v := r.(*positionValue).position(k); v != nil && v.Shape != nil && v.Space.Collides(space) {
 						for _, shape := range shapes {
 							if shape.Collides(v.Shape) {
 								return false
@@ -485,7 +680,6 @@ func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State,
 			})
 		}
 	}
-	positions[p.actor].Shape = shapes[len(shapes)-1]
 
 	snapshot = nil
 	actions = append(actions, &simpleAction{
@@ -495,10 +689,10 @@ func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State,
 		effects: pabt.Effects{
 			&simpleEffect{
 				key:   positionVar{Sprite: p.actor},
-				value: &positionValue{positions: positions},
+				value: value,
 			},
 		},
-		node: bt.New(bt.Async(p.tickMove(x, y))),
+		node: bt.New(bt.Async(p.tickMove(x, y, pathWaypoints(shapes)))),
 	})
 	return
 }
@@ -506,7 +700,8 @@ func (p *pickAndPlace) templateMove(failed pabt.Condition, snapshot *sim.State,
 func (p *pickAndPlace) tickPick(sprite sim.Sprite) bt.Tick {
 	return func(children []bt.Node) (bt.Status, error) {
 		log.Printf("pick(%s): start\n", string(sprite.Image()))
-		if err := p.simulation.Grasp(p.ctx, p.actor, sprite); err != nil {
+		p.simulation.SetPlanOverlay(p.actor, fmt.Sprintf(`pick(%s)`, string(sprite.Image())))
+		if held, err := p.simulation.GraspItem(p.ctx, p.actor, sprite); err != nil || held != sprite {
 			log.Printf("pick(%s): failure\n", string(sprite.Image()))
 			return bt.Failure, nil
 		}
@@ -514,12 +709,15 @@ func (p *pickAndPlace) tickPick(sprite sim.Sprite) bt.Tick {
 		return bt.Success, nil
 	}
 }
-func (p *pickAndPlace) tickMove(x, y int32) bt.Tick {
+func (p *pickAndPlace) tickMove(x, y int32, waypoints [][2]int32) bt.Tick {
 	return func(children []bt.Node) (bt.Status, error) {
 		log.Printf("move(%d, %d): start\n", x, y)
-		if err := p.move(p.actor, float64(x), float64(y)); err != nil {
-			log.Printf("move(%d, %d): failure\n", x, y)
-			return bt.Failure, nil
+		p.simulation.SetPlanOverlay(p.actor, fmt.Sprintf(`move(%d, %d)`, x, y))
+		for _, waypoint := range waypoints {
+			if err := p.move(p.actor, float64(waypoint[0]), float64(waypoint[1])); err != nil {
+				log.Printf("move(%d, %d): failure\n", x, y)
+				return bt.Failure, nil
+			}
 		}
 		log.Printf("move(%d, %d): success\n", x, y)
 		return bt.Success, nil
@@ -528,7 +726,8 @@ func (p *pickAndPlace) tickMove(x, y int32) bt.Tick {
 func (p *pickAndPlace) tickPlace(sprite sim.Sprite) bt.Tick {
 	return func(children []bt.Node) (bt.Status, error) {
 		log.Printf("place(%s): start\n", string(sprite.Image()))
-		if err := p.simulation.Release(p.ctx, p.actor, sprite); err != nil {
+		p.simulation.SetPlanOverlay(p.actor, fmt.Sprintf(`place(%s)`, string(sprite.Image())))
+		if held, err := p.simulation.ReleaseItem(p.ctx, p.actor, sprite); err != nil || held != nil {
 			log.Printf("place(%s): failure\n", string(sprite.Image()))
 			return bt.Failure, nil
 		}
@@ -557,6 +756,193 @@ func (p *pickAndPlace) move(sprite sim.Sprite, x, y float64) error {
 	return p.simulation.Move(ctx, sprite, x, y)
 }
 
+// findPath performs an A* search for the shortest path of the actor's shape, from it's current position to (x, y),
+// returning the shape at each position along the path, excluding the start, or nil if there is no such path, or the
+// actor is already at (x, y), note that the path will be 8-connected (without cutting corners) if the snapshot's
+// movement mode is sim.MovementDiagonal8, otherwise it will be 4-connected
+//
+// Positions colliding with the (current) shapes of other sprites are heavily penalised, rather than excluded, so
+// that the path will only pass through other sprites if there is no alternative, in which case the (caller's)
+// no-collision conditions will require moving them out of the way.
+func findPath(snapshot *sim.State, actor sim.Sprite, x, y int32) []sim.Shape {
+	const (
+		// collisionCost is the additional cost per position colliding with other sprites, which must exceed the
+		// cost of the longest possible path without collisions
+		collisionCost = 1 << 16
+	)
+	var (
+		start     sim.Shape
+		space     sim.Space
+		obstacles []sim.Shape
+	)
+	if actorValue, ok := snapshot.Sprites[actor]; !ok {
+		return nil
+	} else if start = actorValue.Shape(); start == nil {
+		return nil
+	} else {
+		space = actorValue.Space()
+	}
+	for k, v := range snapshot.Sprites {
+		if k != actor && v.Shape() != nil && v.Space().Collides(space) {
+			obstacles = append(obstacles, v.Shape())
+		}
+	}
+
+	var (
+		width, height = snapshot.SpaceWidth, snapshot.SpaceHeight
+		sx, sy        = start.Position()
+		index         = func(x, y int32) int32 { return y*width + x }
+		diagonal      = snapshot.MovementMode == sim.MovementDiagonal8
+		shapes        = make(map[int32]sim.Shape)
+		collisions    = make(map[int32]bool)
+		// shapeAt returns nil if the position is out of bounds
+		shapeAt = func(x, y int32) sim.Shape {
+			i := index(x, y)
+			if shape, ok := shapes[i]; ok {
+				return shape
+			}
+			shape := start.Clone()
+			shape.SetPosition(x, y)
+			if snapshot.ValidateShape(shape) != nil {
+				shape = nil
+			} else {
+				for _, obstacle := range obstacles {
+					if shape.Collides(obstacle) {
+						collisions[i] = true
+						break
+					}
+				}
+			}
+			shapes[i] = shape
+			return shape
+		}
+		free = func(x, y int32) bool { return shapeAt(x, y) != nil && !collisions[index(x, y)] }
+		// costs are doubled, to approximate diagonal steps (~1.41) as 3
+		heuristic = func(nx, ny int32) int32 {
+			dx, dy := abs32(x-nx), abs32(y-ny)
+			if !diagonal {
+				return 2 * (dx + dy)
+			}
+			if dx < dy {
+				dx, dy = dy, dx
+			}
+			return 2*dx + dy
+		}
+	)
+	if (sx == x && sy == y) || x < 0 || x >= width || y < 0 || y >= height || shapeAt(x, y) == nil {
+		return nil
+	}
+
+	var (
+		cost = map[int32]int32{index(sx, sy): 0}
+		from = make(map[int32]int32)
+		open = &pathQueue{{x: sx, y: sy, f: heuristic(sx, sy)}}
+		seq  int
+
+		neighbours = [][2]int32{{1, 0}, {0, 1}, {-1, 0}, {0, -1}, {1, 1}, {-1, 1}, {-1, -1}, {1, -1}}[:4]
+	)
+	if diagonal {
+		neighbours = neighbours[:8]
+	}
+	for open.Len() != 0 {
+		current := heap.Pop(open).(pathNode)
+		if current.x == x && current.y == y {
+			var path []sim.Shape
+			for i := index(x, y); i != index(sx, sy); i = from[i] {
+				path = append(path, shapes[i])
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+		if current.g > cost[index(current.x, current.y)] {
+			// stale
+			continue
+		}
+		for _, d := range neighbours {
+			nx, ny := current.x+d[0], current.y+d[1]
+			if nx < 0 || nx >= width || ny < 0 || ny >= height {
+				continue
+			}
+			if shapeAt(nx, ny) == nil ||
+				(d[0] != 0 && d[1] != 0 && (!free(nx, current.y) || !free(current.x, ny))) {
+				continue
+			}
+			g := current.g + 2
+			if d[0] != 0 && d[1] != 0 {
+				g++
+			}
+			if collisions[index(nx, ny)] {
+				g += collisionCost
+			}
+			if c, ok := cost[index(nx, ny)]; ok && c <= g {
+				continue
+			}
+			cost[index(nx, ny)] = g
+			from[index(nx, ny)] = index(current.x, current.y)
+			seq++
+			heap.Push(open, pathNode{x: nx, y: ny, g: g, f: g + heuristic(nx, ny), seq: seq})
+		}
+	}
+	return nil
+}
+
+// pathWaypoints returns the positions along the path at which the direction changes, and the final position
+func pathWaypoints(path []sim.Shape) (waypoints [][2]int32) {
+	for i, shape := range path {
+		x, y := shape.Position()
+		if i > 0 && i < len(path)-1 {
+			px, py := path[i-1].Position()
+			nx, ny := path[i+1].Position()
+			if x-px == nx-x && y-py == ny-y {
+				// same direction
+				continue
+			}
+		}
+		waypoints = append(waypoints, [2]int32{x, y})
+	}
+	return
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+type (
+	// pathNode is an entry in the open set of findPath
+	pathNode struct {
+		x, y int32
+		g, f int32
+		seq  int
+	}
+
+	// pathQueue implements heap.Interface, ordered by f, then g (descending), then insertion order
+	pathQueue []pathNode
+)
+
+func (q pathQueue) Len() int { return len(q) }
+func (q pathQueue) Less(i, j int) bool {
+	if q[i].f != q[j].f {
+		return q[i].f < q[j].f
+	}
+	if q[i].g != q[j].g {
+		return q[i].g > q[j].g
+	}
+	return q[i].seq < q[j].seq
+}
+func (q pathQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x any)   { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() any {
+	old := *q
+	v := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return v
+}
+
 func (e *simpleEffect) Key() any   { return e.key }
 func (e *simpleEffect) Value() any { return e.value }
 
@@ -568,25 +954,22 @@ func (a *simpleAction) Effects() pabt.Effects          { return a.effects }
 func (a *simpleAction) Node() bt.Node                  { return a.node }
 
 func (a heldItemVar) stateVar(state stateInterface) (any, error) {
-	var r heldItemValue
-	if v, ok := state.getSimulation().State().Sprites[a.Actor]; ok {
+	return newHeldItemValue(state.getSimulation().State(), a.Actor), nil
+}
+
+func newHeldItemValue(snapshot *sim.State, actor sim.Actor) *heldItemValue {
+	r := heldItemValue{capacity: snapshot.InventorySize}
+	if v, ok := snapshot.Sprites[actor]; ok {
 		if v, ok := v.(sim.Actor); ok {
 			r.item = v.HeldItem()
+			r.items = v.HeldItems()
 		}
 	}
-	return &r, nil
+	return &r
 }
 
+func (v *heldItemValue) full() bool { return len(v.items) >= v.capacity }
+
 func (p positionVar) stateVar(state stateInterface) (any, error) {
-	var r positionValue
-	for k, v := range state.getSimulation().State().Sprites {
-		if r.positions == nil {
-			r.positions = make(map[sim.Sprite]*positionInfo)
-		}
-		r.positions[k] = &positionInfo{
-			Space: v.Space(),
-			Shape: v.Shape(),
-		}
-	}
-	return &r, nil
+	return &positionValue{positions: snapshotPositions(state.getSimulation().State())}, nil
 }
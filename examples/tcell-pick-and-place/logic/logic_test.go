@@ -0,0 +1,566 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/gdamore/tcell/v2"
+	bt "github.com/joeycumines/go-behaviortree"
+	"github.com/joeycumines/go-pabt"
+	"github.com/joeycumines/go-pabt/examples/tcell-pick-and-place/sim"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestSimulation(t *testing.T, config sim.Config) (sim.Simulation, tcell.SimulationScreen) {
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(80, 24)
+	config.Screen = screen
+	simulation, err := sim.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return simulation, screen
+}
+
+// runPlans runs the simulation and a PickAndPlace plan per actor, until every plan has succeeded, or the context is
+// canceled (in which case an error will be reported)
+func runPlans(ctx context.Context, t *testing.T, simulation sim.Simulation, opts ...Option) {
+	runActorPlans(ctx, t, simulation, func(int, sim.Actor) []Option { return opts })
+}
+
+// runActorPlans is runPlans with options per actor
+func runActorPlans(ctx context.Context, t *testing.T, simulation sim.Simulation, opts func(i int, actor sim.Actor) []Option) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- simulation.Run(ctx) }()
+
+	var tickers []bt.Ticker
+	for i, actor := range simulation.State().PlanConfig.Actors {
+		plan := PickAndPlace(ctx, simulation, actor, opts(i, actor)...)
+		tickers = append(tickers, bt.NewTickerStopOnFailure(ctx, time.Millisecond*5, bt.New(bt.Not(bt.All), plan)))
+	}
+
+	for i, ticker := range tickers {
+		select {
+		case <-ctx.Done():
+			t.Fatalf(`actors[%d]: %v`, i, ctx.Err())
+		case <-ticker.Done():
+		}
+		if err := ticker.Err(); err != nil {
+			t.Fatalf(`actors[%d]: %v`, i, err)
+		}
+	}
+
+	cancel()
+	if err := <-runErr; err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+// graspRecorder records the actors that successfully grasped each item, see TestPickAndPlace_multiActor
+type graspRecorder struct {
+	sim.Simulation
+	mu     sync.Mutex
+	grasps map[sim.Sprite][]sim.Sprite
+}
+
+func (r *graspRecorder) GraspItem(ctx context.Context, sprite sim.Sprite, target sim.Sprite) (sim.Sprite, error) {
+	held, err := r.Simulation.GraspItem(ctx, sprite, target)
+	if err == nil && held == target {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.grasps[target] = append(r.grasps[target], sprite)
+	}
+	return held, err
+}
+
+// TestPickAndPlace_multiActor runs independent plans for two actors, in a shared world, where both need the same cube
+// on the same goal (see the multi-actor scenario). The conflict is resolved by the planner, rather than avoided: once
+// one actor grasps the cube, the conditions of the other's plan fail (the cube is no longer where it was), and it
+// re-plans (possibly finding no feasible refinement, and failing, while the cube is held) until the cube is placed,
+// satisfying both plans. Deadlock is avoided as neither plan waits on the other, i.e. neither holds anything the
+// other needs, without re-planning, and paths are routed around other actors, where possible (see findPath).
+func TestPickAndPlace_multiActor(t *testing.T) {
+	base, _ := newTestSimulation(t, sim.Config{
+		Scenario: `multi-actor`,
+		Interval: time.Millisecond,
+	})
+	simulation := &graspRecorder{Simulation: base, grasps: make(map[sim.Sprite][]sim.Sprite)}
+
+	var (
+		state      = simulation.State()
+		actors     = state.PlanConfig.Actors
+		cube, goal sim.Sprite
+		// contended counts expansions (per actor), while the cube was held by another actor
+		contended = make([]atomic.Int32, len(actors))
+	)
+	if len(actors) != 2 {
+		t.Fatal(actors)
+	}
+	for _, actor := range actors {
+		for pair := range actor.Criteria() {
+			if (cube != nil && cube != pair.Cube) || (goal != nil && goal != pair.Goal) {
+				t.Fatal(`expected the actors to share the same criteria`)
+			}
+			cube, goal = pair.Cube, pair.Goal
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runActorPlans(ctx, t, simulation, func(i int, actor sim.Actor) []Option {
+		return []Option{WithPlanOptions(pabt.WithExpandObserver[pabt.Condition](func(pabt.Condition, []pabt.IAction) {
+			state := simulation.State()
+			for _, other := range actors {
+				if other != actor && state.Sprites[other].(sim.Actor).HeldItem() == cube {
+					contended[i].Add(1)
+				}
+			}
+		}))}
+	})
+
+	// the cube was grasped by exactly one actor (the winner), the other re-planned while it was held
+	winner := -1
+	for _, actor := range simulation.grasps[cube] {
+		i := slices.IndexFunc(actors, func(v sim.Actor) bool { return v == actor })
+		if winner != -1 && i != winner {
+			t.Fatalf(`expected one actor to grasp the cube, got actors[%d] and actors[%d]`, winner, i)
+		}
+		winner = i
+	}
+	if winner == -1 {
+		t.Fatal(`expected an actor to grasp the cube`)
+	}
+	if loser := 1 - winner; contended[loser].Load() == 0 {
+		t.Errorf(`expected actors[%d] to re-plan while actors[%d] held the cube`, loser, winner)
+	}
+
+	state = simulation.State()
+	for i, actor := range actors {
+		if v := state.Sprites[actor].(sim.Actor).HeldItem(); v != nil {
+			t.Errorf(`actors[%d] is still holding %s`, i, string(v.Image()))
+		}
+	}
+	if c, g := state.Sprites[cube].Shape(), state.Sprites[goal].Shape(); c == nil || g == nil || !c.Collides(g) {
+		t.Errorf(`cube %s is not on the goal`, string(cube.Image()))
+	}
+}
+
+func TestPickAndPlace_headless(t *testing.T) {
+	simulation, err := sim.NewHeadless(sim.HeadlessConfig{
+		Scenario: `static`,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runPlans(ctx, t, simulation)
+
+	state := simulation.State()
+	actor := state.PlanConfig.Actors[0]
+	if v := state.Sprites[actor].(sim.Actor).HeldItem(); v != nil {
+		t.Errorf(`actor is still holding %s`, string(v.Image()))
+	}
+	for pair := range actor.Criteria() {
+		cube, goal := state.Sprites[pair.Cube].Shape(), state.Sprites[pair.Goal].Shape()
+		if cube == nil || goal == nil || !cube.Collides(goal) {
+			t.Fatalf(`cube %s is not on the goal`, string(pair.Cube.Image()))
+		}
+		// the cube is drawn over the goal
+		x, y := state.ScreenPosition(cube.Position())
+		if v := simulation.Grid()[y][x]; v != pair.Cube.Image()[0] {
+			t.Errorf(`expected %q at (%d, %d), got %q`, pair.Cube.Image()[0], x, y, v)
+		}
+	}
+}
+
+func TestPickAndPlace_maintain(t *testing.T) {
+	simulation, err := sim.NewHeadless(sim.HeadlessConfig{
+		Scenario: `static`,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- simulation.Run(ctx) }()
+
+	var (
+		snapshot   = simulation.State()
+		actor      = snapshot.PlanConfig.Actors[0]
+		cube, goal sim.Sprite
+	)
+	for pair := range actor.Criteria() {
+		cube, goal = pair.Cube, pair.Goal
+	}
+	cx, cy := snapshot.Sprites[cube].Shape().Position()
+	placed := func() bool {
+		state := simulation.State()
+		c, g := state.Sprites[cube].Shape(), state.Sprites[goal].Shape()
+		return c != nil && g != nil && c.Collides(g) && state.Sprites[actor].(sim.Actor).HeldItem() == nil
+	}
+
+	// ticked manually, so the plan is not ticked while the cube is disturbed
+	node := PickAndPlace(ctx, simulation, actor, WithPlanOptions(pabt.WithMaintain[pabt.Condition]()))
+	tick := func() {
+		t.Helper()
+		if status, err := node.Tick(); err != nil || status != bt.Running {
+			t.Fatal(status, err)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	achieve := func() {
+		t.Helper()
+		for !placed() {
+			if err := ctx.Err(); err != nil {
+				t.Fatal(err)
+			}
+			tick()
+		}
+		// maintained, rather than succeeding
+		for i := 0; i < 5; i++ {
+			tick()
+		}
+		if !placed() {
+			t.Fatal(`expected the cube to remain on the goal`)
+		}
+	}
+
+	achieve()
+
+	// disturbed, e.g. by an external agent, moving the cube back to where it started
+	if err := simulation.Move(ctx, cube, float64(cx), float64(cy)); err != nil {
+		t.Fatal(err)
+	}
+	if placed() {
+		t.Fatal(`expected the cube to have moved`)
+	}
+
+	achieve()
+
+	cancel()
+	if err := <-runErr; err != nil && err != context.Canceled {
+		t.Error(err)
+	}
+}
+
+func TestPickAndPlace_anyCube(t *testing.T) {
+	simulation, _ := newTestSimulation(t, sim.Config{
+		Scenario: `any-cube`,
+		Interval: time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runPlans(ctx, t, simulation)
+
+	state := simulation.State()
+	actor := state.PlanConfig.Actors[0]
+	if v := state.Sprites[actor].(sim.Actor).HeldItem(); v != nil {
+		t.Errorf(`actor is still holding %s`, string(v.Image()))
+	}
+	for pair := range actor.Criteria() {
+		if !pair.AnyCube() || pair.AnyGoal() {
+			t.Fatal(pair)
+		}
+		goal := state.Sprites[pair.Goal].Shape()
+		var placed []string
+		for k, v := range state.Sprites {
+			if _, ok := k.(sim.Cube); ok && v.Shape() != nil && goal != nil && v.Shape().Collides(goal) {
+				placed = append(placed, string(k.Image()))
+			}
+		}
+		if len(placed) != 1 {
+			t.Errorf(`expected one cube on the goal, got %q`, placed)
+		}
+	}
+}
+
+func TestPickAndPlace_planOverlay(t *testing.T) {
+	simulation, screen := newTestSimulation(t, sim.Config{
+		Scenario:    `multi-actor`,
+		Interval:    time.Millisecond,
+		PlanOverlay: true,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runPlans(ctx, t, simulation)
+
+	// the last action of the plan places the cube on the goal
+	var cube sim.Sprite
+	for pair := range simulation.State().PlanConfig.Actors[0].Criteria() {
+		cube = pair.Cube
+	}
+	expected := []rune(fmt.Sprintf(`0.plan = place(%s)`, string(cube.Image())))
+	cells, w, h := screen.GetContents()
+	for y := 0; y < h; y++ {
+		row := make([]rune, 0, len(expected))
+		for x := 0; x < w && x < len(expected); x++ {
+			if runes := cells[y*w+x].Runes; len(runes) != 0 {
+				row = append(row, runes[0])
+			}
+		}
+		if string(row) == string(expected) {
+			return
+		}
+	}
+	t.Errorf(`expected hud to contain %q`, string(expected))
+}
+
+func TestPickAndPlace_templateMove_routesAroundObstacle(t *testing.T) {
+	simulation, _ := newTestSimulation(t, sim.Config{
+		Scenario: `static`,
+		Interval: time.Millisecond,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- simulation.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-runErr; err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	var (
+		actor = simulation.State().PlanConfig.Actors[0]
+		cube  sim.Sprite
+	)
+	for k := range simulation.State().Sprites {
+		if string(k.Image()) == `1` {
+			cube = k
+		}
+	}
+	if cube == nil {
+		t.Fatal(`cube not found`)
+	}
+	cx, cy := simulation.State().Sprites[cube].Shape().Position()
+
+	p := &pickAndPlace{ctx: ctx, simulation: simulation, actor: actor}
+
+	// the actor is two rows high, so a straight line between these positions would pass through the cube
+	if err := p.move(actor, float64(cx-10), float64(cy-1)); err != nil {
+		t.Fatal(err)
+	}
+	x, y := cx+5, cy-1
+
+	snapshot := simulation.State()
+	actions, err := p.templateMove(&simpleCond{
+		key: positionVar{Sprite: actor},
+		match: func(r any) bool {
+			if v := r.(*positionValue).position(actor); v != nil && v.Shape != nil {
+				vx, vy := v.Shape.Position()
+				return vx == x && vy == y
+			}
+			return false
+		},
+	}, snapshot, snapshotPositions(snapshot), x, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 {
+		t.Fatal(actions)
+	}
+	action := actions[0]
+
+	positions := snapshotPositions(snapshot)
+	for _, conditions := range action.Conditions() {
+		for _, condition := range conditions {
+			if !condition.Match(&positionValue{positions: positions}) {
+				t.Error(`expected conditions to pass`)
+			}
+		}
+	}
+
+	status, err := action.Node().Tick()
+	for err == nil && status == bt.Running {
+		time.Sleep(time.Millisecond)
+		status, err = action.Node().Tick()
+	}
+	if err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+
+	if ax, ay := simulation.State().Sprites[actor].Shape().Position(); ax != x || ay != y {
+		t.Errorf(`expected actor at (%d, %d), got (%d, %d)`, x, y, ax, ay)
+	}
+	if nx, ny := simulation.State().Sprites[cube].Shape().Position(); nx != cx || ny != cy {
+		t.Errorf(`expected cube to remain at (%d, %d), got (%d, %d)`, cx, cy, nx, ny)
+	}
+}
+
+func TestPickAndPlace_searchRadius(t *testing.T) {
+	simulation, err := sim.NewHeadless(sim.HeadlessConfig{
+		Scenario: `static`,
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := simulation.State()
+	actor := snapshot.PlanConfig.Actors[0]
+
+	count := func(radius int32) (n int) {
+		p := &pickAndPlace{simulation: simulation, actor: actor, searchRadius: radius}
+		for range p.positions(snapshot) {
+			n++
+		}
+		return
+	}
+	if n := count(0); n != int(snapshot.SpaceWidth*snapshot.SpaceHeight) {
+		t.Errorf(`expected the full grid, got %d positions`, n)
+	}
+	if n := count(2); n == 0 || n >= count(0) {
+		t.Errorf(`expected a subset of the grid, got %d positions`, n)
+	}
+
+	// equivalent to filtering the full grid, by the distance to the nearest centre
+	var centres [][2]int32
+	for pair := range actor.Criteria() {
+		for _, sprite := range []sim.Sprite{actor, pair.Cube, pair.Goal} {
+			x, y := snapshot.Sprites[sprite].Shape().Position()
+			centres = append(centres, [2]int32{x, y})
+		}
+	}
+	for _, radius := range []int32{1, 2, 5, 10, 100} {
+		var expected, actual [][2]int32
+		for x := int32(0); x < snapshot.SpaceWidth; x++ {
+			for y := int32(0); y < snapshot.SpaceHeight; y++ {
+				for _, c := range centres {
+					if abs32(x-c[0]) <= radius && abs32(y-c[1]) <= radius {
+						expected = append(expected, [2]int32{x, y})
+						break
+					}
+				}
+			}
+		}
+		p := &pickAndPlace{simulation: simulation, actor: actor, searchRadius: radius}
+		for x, y := range p.positions(snapshot) {
+			actual = append(actual, [2]int32{x, y})
+		}
+		if !slices.Equal(actual, expected) {
+			t.Errorf("radius %d: expected %d positions, got %d", radius, len(expected), len(actual))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	runPlans(ctx, t, simulation, WithSearchRadius(10))
+
+	state := simulation.State()
+	for pair := range actor.Criteria() {
+		cube, goal := state.Sprites[pair.Cube].Shape(), state.Sprites[pair.Goal].Shape()
+		if cube == nil || goal == nil || !cube.Collides(goal) {
+			t.Errorf(`cube %s is not on the goal`, string(pair.Cube.Image()))
+		}
+	}
+}
+
+// clutteredCubes returns many cubes, irrelevant to the criteria of the static scenario, filling the bottom of the
+// space, every third column of every second row, see BenchmarkPickAndPlace_Actions_manySprites
+func clutteredCubes(tb testing.TB) (cubes []sim.HeadlessCube) {
+	simulation, err := sim.NewHeadless(sim.HeadlessConfig{Scenario: `static`})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	state := simulation.State()
+	for y := 18.0; y < float64(state.SpaceHeight); y += 2 {
+		for x := 1.0; x < float64(state.SpaceWidth); x += 3 {
+			cubes = append(cubes, sim.HeadlessCube{X: x, Y: y, Image: 'x'})
+		}
+	}
+	return
+}
+
+func benchmarkPickAndPlaceActions(b *testing.B, config sim.HeadlessConfig, opts ...Option) {
+	config.Interval = time.Millisecond
+	simulation, err := sim.NewHeadless(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	snapshot := simulation.State()
+	actor := snapshot.PlanConfig.Actors[0]
+	var cube, goal sim.Sprite
+	for pair := range actor.Criteria() {
+		cube, goal = pair.Cube, pair.Goal
+	}
+
+	p := &pickAndPlace{ctx: context.Background(), simulation: simulation, actor: actor}
+	for _, opt := range opts {
+		opt(p)
+	}
+	failed := &simpleCond{
+		key: positionVar{Sprite: cube},
+		match: func(r any) bool {
+			positions := r.(*positionValue)
+			cubePos, goalPos := positions.position(cube), positions.position(goal)
+			return cubePos != nil && goalPos != nil && cubePos.Shape != nil && goalPos.Shape != nil && cubePos.Shape.Collides(goalPos.Shape)
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Actions(failed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPickAndPlace_Actions_fullGrid(b *testing.B) {
+	benchmarkPickAndPlaceActions(b, sim.HeadlessConfig{Scenario: `static`})
+}
+
+func BenchmarkPickAndPlace_Actions_searchRadius(b *testing.B) {
+	benchmarkPickAndPlaceActions(b, sim.HeadlessConfig{Scenario: `static`}, WithSearchRadius(5))
+}
+
+func BenchmarkPickAndPlace_Actions_manySprites(b *testing.B) {
+	benchmarkPickAndPlaceActions(b, sim.HeadlessConfig{Scenario: `static`, Cubes: clutteredCubes(b)})
+}
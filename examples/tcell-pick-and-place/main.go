@@ -42,14 +42,22 @@ func main() {
 
 func run(cmd string, args []string) (exitCode int) {
 	var (
-		flags    = flag.NewFlagSet(cmd, flag.ContinueOnError)
-		logfile  stringFlag
-		exit     bool
-		scenario stringFlag
+		flags     = flag.NewFlagSet(cmd, flag.ContinueOnError)
+		logfile   stringFlag
+		exit      bool
+		scenario  stringFlag
+		overlay   bool
+		movement  sim.MovementMode
+		seed      int64
+		inventory int
 	)
 	flags.Var(&logfile, `logfile`, `write log output to file`)
 	flags.BoolVar(&exit, `exit`, false, `exit once all plans succeed`)
-	flags.Var(&scenario, `scenario`, `specify scenario as one of (static, human-vs-robot) [default=static]`)
+	flags.Var(&scenario, `scenario`, `specify scenario as one of (static, human-vs-robot, multi-actor, any-cube) [default=static]`)
+	flags.BoolVar(&overlay, `overlay`, false, `display the active action of each plan in the hud`)
+	flags.Var(&movement, `movement`, `specify movement mode as one of (free, cardinal4, diagonal8) [default=free]`)
+	flags.IntVar(&inventory, `inventory`, 1, `specify the number of items each actor may hold`)
+	flags.Int64Var(&seed, `seed`, 0, `seed the simulation's randomness, for reproducible runs [default=time based]`)
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
@@ -91,9 +99,18 @@ func run(cmd string, args []string) (exitCode int) {
 	}
 	defer screen.Fini()
 
+	var simRand *rand.Rand
+	if seed != 0 {
+		simRand = rand.New(rand.NewSource(seed))
+	}
+
 	simulation, err := sim.New(sim.Config{
-		Screen:   screen,
-		Scenario: string(scenario),
+		Screen:        screen,
+		Scenario:      string(scenario),
+		PlanOverlay:   overlay,
+		MovementMode:  movement,
+		Rand:          simRand,
+		InventorySize: inventory,
 	})
 	if err != nil {
 		if logfile == `` {
@@ -105,7 +122,7 @@ func run(cmd string, args []string) (exitCode int) {
 
 	defer func() {
 		var b bytes.Buffer
-		if _, err := dumpSimSpace(&b, screen, simulation); err == nil {
+		if _, err := dumpSimSpace(&b, simulation); err == nil {
 			log.Printf("dumping final state...\n%s\n", b.Bytes())
 		}
 	}()
@@ -264,24 +281,14 @@ func logBT(name string, node bt.Node) bt.Tick {
 	}
 }
 
-func dumpSimSpace(w io.Writer, screen tcell.Screen, simulation sim.Simulation) (written int64, err error) {
+func dumpSimSpace(w io.Writer, simulation sim.Simulation) (written int64, err error) {
 	var (
-		state = simulation.State()
-		x, y  int32
-		b     bytes.Buffer
-		r     rune
-		n     int64
+		b bytes.Buffer
+		n int64
 	)
-	for y = -1; y <= state.SpaceHeight; y++ {
+	for _, row := range simulation.Snapshot() {
 		b.Reset()
-		for x = -1; x <= state.SpaceWidth; x++ {
-			if x >= 0 && x < state.SpaceWidth && y >= 0 && y < state.SpaceHeight {
-				r, _, _, _ = screen.GetContent(state.ScreenPosition(x, y))
-			} else {
-				r = '#'
-			}
-			b.WriteRune(r)
-		}
+		b.WriteString(string(row))
 		b.WriteRune('\n')
 		n, err = io.Copy(w, &b)
 		written += n
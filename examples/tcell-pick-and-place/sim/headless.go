@@ -0,0 +1,176 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	tcell "github.com/gdamore/tcell/v2"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type (
+	// HeadlessSimulation is a Simulation that renders into an in-memory grid of runes, rather than a terminal, see
+	// NewHeadless
+	HeadlessSimulation interface {
+		Simulation
+
+		// Grid returns a copy of the last rendered frame, indexed by row (y) then column (x), where empty cells are
+		// spaces
+		Grid() [][]rune
+	}
+
+	// HeadlessConfig models the configuration for NewHeadless, see the equivalent fields of Config
+	HeadlessConfig struct {
+		Interval             time.Duration
+		Scenario             string
+		PlanOverlay          bool
+		OnGoalReached        func(actor Actor)
+		OnGoal               func(actor Actor, cube Cube, goal Goal)
+		OnCollision          func(a, b Sprite)
+		MovementMode         MovementMode
+		Rand                 *rand.Rand
+		InventorySize        int
+		ExternalLogicTimeout time.Duration
+		ValidateShapes       bool
+		// Cubes will be created in addition to those of the Scenario, e.g. to exercise planning with many sprites,
+		// where each must be within the space, and not collide with any other sprite
+		Cubes []HeadlessCube
+	}
+
+	// HeadlessCube models a 1x1 cube, see HeadlessConfig.Cubes
+	HeadlessCube struct {
+		X, Y  float64
+		Image rune
+	}
+
+	headless struct {
+		*service
+		display *headlessDisplay
+	}
+
+	// headlessDisplay implements display, double buffered like tcell.Screen, i.e. changes are visible on Show
+	headlessDisplay struct {
+		mu          sync.Mutex
+		back        [][]rune
+		front       [][]rune
+		backStyles  [][]tcell.Style
+		frontStyles [][]tcell.Style
+	}
+)
+
+// NewHeadless constructs a Simulation that behaves identically to one constructed via New, without a tcell.Screen,
+// intended for automated testing, note that there is no keyboard input, and the grid is always baseWidth by
+// baseHeight
+func NewHeadless(config HeadlessConfig) (HeadlessSimulation, error) {
+	display := newHeadlessDisplay(baseWidth, baseHeight)
+	svc, err := newService(Config{
+		Interval:             config.Interval,
+		Scenario:             config.Scenario,
+		PlanOverlay:          config.PlanOverlay,
+		OnGoalReached:        config.OnGoalReached,
+		OnGoal:               config.OnGoal,
+		OnCollision:          config.OnCollision,
+		MovementMode:         config.MovementMode,
+		Rand:                 config.Rand,
+		InventorySize:        config.InventorySize,
+		ExternalLogicTimeout: config.ExternalLogicTimeout,
+		ValidateShapes:       config.ValidateShapes,
+		cubes:                config.Cubes,
+	}, display)
+	if err != nil {
+		return nil, err
+	}
+	return &headless{service: svc, display: display}, nil
+}
+
+func (x *headless) Grid() [][]rune { return x.display.grid() }
+
+func newHeadlessDisplay(width, height int) *headlessDisplay {
+	d := &headlessDisplay{
+		back:        make([][]rune, height),
+		front:       make([][]rune, height),
+		backStyles:  make([][]tcell.Style, height),
+		frontStyles: make([][]tcell.Style, height),
+	}
+	for y := range d.back {
+		d.back[y] = make([]rune, width)
+		d.front[y] = make([]rune, width)
+		d.backStyles[y] = make([]tcell.Style, width)
+		d.frontStyles[y] = make([]tcell.Style, width)
+	}
+	d.Clear()
+	d.Show()
+	return d
+}
+
+func (d *headlessDisplay) Size() (width, height int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.back[0]), len(d.back)
+}
+
+func (d *headlessDisplay) Clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for y, row := range d.back {
+		for x := range row {
+			row[x] = ' '
+		}
+		clear(d.backStyles[y])
+	}
+}
+
+func (d *headlessDisplay) SetContent(x int, y int, mainc rune, _ []rune, style tcell.Style) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if y >= 0 && y < len(d.back) && x >= 0 && x < len(d.back[y]) {
+		d.back[y][x] = mainc
+		d.backStyles[y][x] = style
+	}
+}
+
+func (d *headlessDisplay) Show() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for y, row := range d.back {
+		copy(d.front[y], row)
+		copy(d.frontStyles[y], d.backStyles[y])
+	}
+}
+
+func (d *headlessDisplay) grid() [][]rune {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	grid := make([][]rune, len(d.front))
+	for y, row := range d.front {
+		grid[y] = append([]rune(nil), row...)
+	}
+	return grid
+}
+
+// styles returns a copy of the styles of the last rendered frame, indexed like grid
+func (d *headlessDisplay) styles() [][]tcell.Style {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	styles := make([][]tcell.Style, len(d.frontStyles))
+	for y, row := range d.frontStyles {
+		styles[y] = append([]tcell.Style(nil), row...)
+	}
+	return styles
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	"context"
+	"fmt"
+	tcell "github.com/gdamore/tcell/v2"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewHeadless(t *testing.T) {
+	simulation, err := NewHeadless(HeadlessConfig{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actorImage := func(x, y int) string {
+		grid := simulation.Grid()
+		if len(grid) != baseHeight || len(grid[0]) != baseWidth {
+			t.Fatal(len(grid), len(grid[0]))
+		}
+		return string(grid[y][x:x+3]) + string(grid[y+1][x:x+3])
+	}
+	if v := actorImage(6+hudWidth, 10); v != `0|00|0` {
+		t.Fatalf(`%q`, v)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- simulation.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil && err != context.Canceled {
+			t.Error(err)
+		}
+	}()
+
+	actor := simulation.State().PlanConfig.Actors[0]
+	if err := simulation.MoveBy(ctx, actor, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := actor.Shape().Position(); x != 10 || y != 10 {
+		t.Fatal(x, y)
+	}
+	for actorImage(10+hudWidth, 10) != `0|00|0` {
+		if ctx.Err() != nil {
+			t.Fatal(ctx.Err())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v := actorImage(6+hudWidth, 10); v != `      ` {
+		t.Errorf(`%q`, v)
+	}
+
+	if _, err := NewHeadless(HeadlessConfig{Scenario: `unknown`}); err == nil || err.Error() != `invalid scenario: unknown` {
+		t.Error(err)
+	}
+}
+
+func TestNewHeadless_styles(t *testing.T) {
+	simulation, err := NewHeadless(HeadlessConfig{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := simulation.(*headless)
+	for _, tc := range [...]struct {
+		x, y  int
+		style tcell.Style
+	}{
+		{30, 10, actorStyle},
+		{32, 11, actorStyle},
+		{77, 9, goalStyle},
+		{79, 13, goalStyle},
+		{60, 8, tcell.StyleDefault},
+		{0, 0, tcell.StyleDefault},
+	} {
+		if style := h.display.styles()[tc.y][tc.x]; style != tc.style {
+			t.Errorf(`unexpected style at %d, %d: %v`, tc.x, tc.y, style)
+		}
+	}
+
+	u := update{model: h.model}
+	actor := u.Actors[0]
+	sprite, err := u.createSprite(9, 10, 1, 1, []rune(`c`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.createCube(sprite); err != nil {
+		t.Fatal(err)
+	}
+	if !u.graspItem(actor, sprite) {
+		t.Fatal(`expected grasp`)
+	}
+	u.Redraw = true
+	u.refreshImages()
+	h.view(u)
+	if r := h.Grid()[10][31]; r != 'c' {
+		t.Fatalf(`%q`, r)
+	}
+	styles := h.display.styles()
+	if style := styles[10][31]; style != heldStyle {
+		t.Errorf(`expected the held item to be highlighted: %v`, style)
+	}
+	if style := styles[10][30]; style != actorStyle {
+		t.Errorf(`unexpected actor style: %v`, style)
+	}
+}
+
+func TestNewHeadless_cubes(t *testing.T) {
+	simulation, err := NewHeadless(HeadlessConfig{Cubes: []HeadlessCube{{X: 1, Y: 20, Image: 'x'}, {X: 4, Y: 20, Image: 'y'}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cubes []string
+	for _, sprite := range simulation.State().Sprites {
+		if cube, ok := sprite.(Cube); ok {
+			if x, y := cube.Shape().Position(); y == 20 {
+				cubes = append(cubes, fmt.Sprintf(`%s@%d`, string(cube.Image()), x))
+			}
+		}
+	}
+	sort.Strings(cubes)
+	if v := fmt.Sprint(cubes); v != `[x@1 y@4]` {
+		t.Error(v)
+	}
+
+	// the static scenario's actor is at (6, 10)
+	if _, err := NewHeadless(HeadlessConfig{Cubes: []HeadlessCube{{X: 7, Y: 10, Image: 'x'}}}); err == nil || err.Error() != `invalid cube 'x' at (7, 10): invalid coordinates: collides with other sprite(s)` {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	"cmp"
+	"slices"
+)
+
+const (
+	// spatialCellSize is the width and height of each cell of spatialIndex
+	spatialCellSize = 4
+)
+
+type (
+	// spatialIndex is a uniform grid of the (visible) sprites of a model, keyed by cell, used to limit collision
+	// checks to sprites in overlapping cells, note that it must be kept up to date via update, and that it is not
+	// safe for concurrent use
+	spatialIndex struct {
+		cells   map[[2]int32][]*spriteModel
+		entries map[*spriteModel]*spatialEntry
+		seq     int
+		// scratch is reused by query
+		scratch []*spriteModel
+	}
+
+	spatialEntry struct {
+		// z, layer and seq order sprites consistently with model.sprites
+		z, layer, seq int
+		// indexed indicates the sprite is in the (inclusive) range of cells x1, y1 to x2, y2
+		indexed        bool
+		x1, y1, x2, y2 int32
+	}
+)
+
+func newSpatialIndex() *spatialIndex {
+	return &spatialIndex{
+		cells:   make(map[[2]int32][]*spriteModel),
+		entries: make(map[*spriteModel]*spatialEntry),
+	}
+}
+
+// update indexes the sprite's current shape, or removes it from the index, if it is not visible, note that sprites
+// without an owner (i.e. that aren't yet part of the model) are ignored
+func (x *spatialIndex) update(sprite *spriteModel) {
+	entry := x.entries[sprite]
+	if entry == nil {
+		layer, ok := spriteLayer(sprite.Owner)
+		if !ok {
+			return
+		}
+		x.seq++
+		entry = &spatialEntry{z: sprite.Layer, layer: layer, seq: x.seq}
+		x.entries[sprite] = entry
+	}
+
+	var (
+		visible        = sprite.visible()
+		x1, y1, x2, y2 int32
+	)
+	if visible {
+		x1, y1, x2, y2 = spatialCells(sprite.Shape)
+		if entry.indexed && entry.x1 == x1 && entry.y1 == y1 && entry.x2 == x2 && entry.y2 == y2 {
+			return
+		}
+	}
+
+	if entry.indexed {
+		for cx := entry.x1; cx <= entry.x2; cx++ {
+			for cy := entry.y1; cy <= entry.y2; cy++ {
+				key := [2]int32{cx, cy}
+				cell := x.cells[key]
+				for i, v := range cell {
+					if v == sprite {
+						cell[i] = cell[len(cell)-1]
+						cell[len(cell)-1] = nil
+						cell = cell[:len(cell)-1]
+						break
+					}
+				}
+				if len(cell) == 0 {
+					delete(x.cells, key)
+				} else {
+					x.cells[key] = cell
+				}
+			}
+		}
+		entry.indexed = false
+	}
+
+	if visible {
+		for cx := x1; cx <= x2; cx++ {
+			for cy := y1; cy <= y2; cy++ {
+				key := [2]int32{cx, cy}
+				x.cells[key] = append(x.cells[key], sprite)
+			}
+		}
+		entry.indexed = true
+		entry.x1, entry.y1, entry.x2, entry.y2 = x1, y1, x2, y2
+	}
+}
+
+// query calls fn for each sprite in the cells overlapping the bounding box of shape, until it returns false, in the
+// same order as model.sprites
+func (x *spatialIndex) query(downward bool, shape Shape, fn func(sprite *spriteModel) bool) {
+	candidates := x.scratch[:0]
+	x1, y1, x2, y2 := spatialCells(shape)
+	for cx := x1; cx <= x2; cx++ {
+		for cy := y1; cy <= y2; cy++ {
+			candidates = append(candidates, x.cells[[2]int32{cx, cy}]...)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *spriteModel) int {
+		ea, eb := x.entries[a], x.entries[b]
+		if c := cmp.Compare(ea.z, eb.z); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(ea.layer, eb.layer); c != 0 {
+			return c
+		}
+		return cmp.Compare(ea.seq, eb.seq)
+	})
+	// fn may call query
+	x.scratch = nil
+	defer func() {
+		clear(candidates)
+		x.scratch = candidates[:0]
+	}()
+	for i := range candidates {
+		if downward {
+			i = len(candidates) - 1 - i
+		}
+		if (!downward && i > 0 && candidates[i] == candidates[i-1]) ||
+			(downward && i < len(candidates)-1 && candidates[i] == candidates[i+1]) {
+			// duplicate (in multiple cells)
+			continue
+		}
+		if !fn(candidates[i]) {
+			return
+		}
+	}
+}
+
+// spriteLayer returns the layer of a sprite with the given owner, consistent with the order of model.sprites, within
+// a given spriteModel.Layer
+func spriteLayer(owner any) (int, bool) {
+	switch owner.(type) {
+	case *goalModel:
+		return 0, true
+	case *wallModel:
+		return 1, true
+	case *cubeModel:
+		return 2, true
+	case *actorModel:
+		return 3, true
+	default:
+		return 0, false
+	}
+}
+
+// spatialCells returns the (inclusive) range of cells overlapped by the bounding box of shape, which will be empty
+// (x1 > x2 or y1 > y2) if the shape has no area
+func spatialCells(shape Shape) (x1, y1, x2, y2 int32) {
+	x, y := shape.Position()
+	w, h := shape.Size()
+	if w <= 0 || h <= 0 {
+		return 0, 0, -1, -1
+	}
+	return spatialCell(x), spatialCell(y), spatialCell(x + w - 1), spatialCell(y + h - 1)
+}
+
+func spatialCell(v int32) int32 {
+	if v < 0 {
+		return (v+1)/spatialCellSize - 1
+	}
+	return v / spatialCellSize
+}
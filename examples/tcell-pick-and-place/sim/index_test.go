@@ -0,0 +1,192 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checkSpatialIndex fails the test if the index of m is inconsistent with the sprites of m, including that
+// collisions must be the same as without the index
+func checkSpatialIndex(t *testing.T, m *model) {
+	t.Helper()
+	index := m.index
+	if index == nil {
+		t.Fatal(`nil index`)
+	}
+	names := make(map[*spriteModel]string)
+	m.sprites(false, func(sprite *spriteModel) bool {
+		names[sprite] = fmt.Sprintf(`%q`, string(sprite.Image))
+		entry := index.entries[sprite]
+		if entry == nil {
+			t.Errorf(`%s: not indexed`, names[sprite])
+			return true
+		}
+		if entry.indexed != sprite.visible() {
+			t.Errorf(`%s: indexed=%v visible=%v`, names[sprite], entry.indexed, sprite.visible())
+			return true
+		}
+		if !entry.indexed {
+			return true
+		}
+		if x1, y1, x2, y2 := spatialCells(sprite.Shape); entry.x1 != x1 || entry.y1 != y1 || entry.x2 != x2 || entry.y2 != y2 {
+			t.Errorf(`%s: stale cells`, names[sprite])
+		}
+		for cx := entry.x1; cx <= entry.x2; cx++ {
+			for cy := entry.y1; cy <= entry.y2; cy++ {
+				var found int
+				for _, v := range index.cells[[2]int32{cx, cy}] {
+					if v == sprite {
+						found++
+					}
+				}
+				if found != 1 {
+					t.Errorf(`%s: found %d times in cell %d, %d`, names[sprite], found, cx, cy)
+				}
+			}
+		}
+		return true
+	})
+	for key, cell := range index.cells {
+		if len(cell) == 0 {
+			t.Errorf(`empty cell %v`, key)
+		}
+		for _, sprite := range cell {
+			if entry := index.entries[sprite]; entry == nil || !entry.indexed ||
+				key[0] < entry.x1 || key[0] > entry.x2 || key[1] < entry.y1 || key[1] > entry.y2 {
+				t.Errorf(`%s: unexpected in cell %v`, names[sprite], key)
+			}
+		}
+	}
+	if len(index.entries) != len(names) {
+		t.Errorf(`expected %d entries, got %d`, len(names), len(index.entries))
+	}
+
+	m.sprites(false, func(sprite *spriteModel) bool {
+		for _, downward := range [...]bool{false, true} {
+			collisions := func() (v []string) {
+				m.collisions(downward, Space{Room: true, Floor: true}, sprite.Shape, func(sprite *spriteModel) bool {
+					v = append(v, names[sprite])
+					return true
+				})
+				return
+			}
+			indexed := collisions()
+			m.index = nil
+			expected := collisions()
+			m.index = index
+			if fmt.Sprint(indexed) != fmt.Sprint(expected) {
+				t.Errorf(`%s: downward=%v expected collisions %v, got %v`, names[sprite], downward, expected, indexed)
+			}
+		}
+		return true
+	})
+}
+
+func TestSpatialIndex_consistent(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond}).(*service)
+	ctx := runTestSimulation(t, simulation)
+	check := func() {
+		t.Helper()
+		if err := simulation.externalLogic(ctx, nil, func(ctx context.Context, u *update) bool {
+			checkSpatialIndex(t, u.model)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+	)
+	for k := range state.Sprites {
+		if string(k.Image()) == `1` {
+			cube = k
+		}
+	}
+	cx, cy := cube.Position()
+
+	for _, step := range []func() error{
+		func() error { return simulation.MoveBy(ctx, actor, 4, 2) },
+		func() error { return simulation.Move(ctx, actor, cx-3, cy) },
+		// the cube is removed from the space while it is held
+		func() error { return simulation.Grasp(ctx, actor, cube) },
+		func() error { return simulation.MoveBy(ctx, actor, 0, 5) },
+		func() error { return simulation.Release(ctx, actor, cube) },
+		func() error { return simulation.MoveBy(ctx, actor, -8, -3) },
+	} {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+		check()
+	}
+	// released above the actor
+	if x, y := cube.Shape().Position(); x != int32(cx)-2 || y != int32(cy)+4 {
+		t.Error(x, y)
+	}
+}
+
+func BenchmarkModel_collides(b *testing.B) {
+	for _, indexed := range [...]bool{false, true} {
+		b.Run(fmt.Sprintf(`indexed=%v`, indexed), func(b *testing.B) {
+			u := update{model: &model{State: newState()}}
+			if indexed {
+				u.index = newSpatialIndex()
+			}
+			var sprites []*spriteModel
+			for y := int32(0); y < spaceHeight && len(sprites) < 200; y += 2 {
+				for x := int32(0); x < spaceWidth && len(sprites) < 200; x += 2 {
+					sprite, err := u.createSprite(float64(x), float64(y), 1, 1, []rune(`c`))
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := u.createCube(sprite); err != nil {
+						b.Fatal(err)
+					}
+					sprites = append(sprites, sprite)
+				}
+			}
+			if len(sprites) != 200 {
+				b.Fatal(len(sprites))
+			}
+			var comparisons int
+			for _, sprite := range sprites {
+				u.candidates(true, sprite.Shape, func(*spriteModel) bool {
+					comparisons++
+					return true
+				})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, sprite := range sprites {
+					if u.collides(sprite) {
+						b.Fatal(sprite)
+					}
+				}
+			}
+			b.ReportMetric(float64(comparisons), `comparisons/op`)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	"fmt"
+	"math"
+)
+
+// MovementMode constrains the directions sprites may move in, see Config.MovementMode, note that it implements
+// flag.Value
+type MovementMode int
+
+const (
+	// MovementFree allows movement in any direction (the default)
+	MovementFree MovementMode = iota
+	// MovementCardinal4 allows only horizontal or vertical movement, where Simulation.Move will decompose any
+	// diagonal target into a horizontal then a vertical movement
+	MovementCardinal4
+	// MovementDiagonal8 allows horizontal, vertical, or (45 degree) diagonal movement, where Simulation.Move will
+	// decompose any other target into a diagonal then a horizontal or vertical movement
+	MovementDiagonal8
+)
+
+func (m MovementMode) String() string {
+	switch m {
+	case MovementFree:
+		return `free`
+	case MovementCardinal4:
+		return `cardinal4`
+	case MovementDiagonal8:
+		return `diagonal8`
+	default:
+		return fmt.Sprintf(`MovementMode(%d)`, int(m))
+	}
+}
+
+func (m *MovementMode) Set(s string) error {
+	for _, v := range [...]MovementMode{MovementFree, MovementCardinal4, MovementDiagonal8} {
+		if s == v.String() {
+			*m = v
+			return nil
+		}
+	}
+	return fmt.Errorf(`invalid movement mode: %s`, s)
+}
+
+func (m MovementMode) valid() bool { return m >= MovementFree && m <= MovementDiagonal8 }
+
+// allows returns true if a velocity of dx and dy is permitted
+func (m MovementMode) allows(dx, dy float64) bool {
+	switch m {
+	case MovementCardinal4:
+		return dx == 0 || dy == 0
+	case MovementDiagonal8:
+		return dx == 0 || dy == 0 || math.Abs(dx) == math.Abs(dy)
+	default:
+		return true
+	}
+}
+
+// waypoints returns the positions a sprite at (x1, y1) should move through, to reach (x2, y2), the last of which
+// will always be (x2, y2)
+func (m MovementMode) waypoints(x1, y1, x2, y2 float64) [][2]float64 {
+	var (
+		dx, dy = x2 - x1, y2 - y1
+		mx, my float64
+	)
+	switch m {
+	case MovementCardinal4:
+		mx, my = x2, y1
+	case MovementDiagonal8:
+		d := math.Min(math.Abs(dx), math.Abs(dy))
+		mx, my = x1+math.Copysign(d, dx), y1+math.Copysign(d, dy)
+	default:
+		return [][2]float64{{x2, y2}}
+	}
+	if (mx == x1 && my == y1) || (mx == x2 && my == y2) {
+		return [][2]float64{{x2, y2}}
+	}
+	return [][2]float64{{mx, my}, {x2, y2}}
+}
+
+// velocity returns the velocity (of magnitude stepDistance) for movement by dx and dy, snapped to the nearest
+// permitted direction, note that dx and dy must not both be zero
+func (m MovementMode) velocity(dx, dy float64) (vx, vy float64) {
+	ax, ay := math.Abs(dx), math.Abs(dy)
+	switch m {
+	case MovementCardinal4:
+		if ax >= ay {
+			return math.Copysign(stepDistance, dx), 0
+		}
+		return 0, math.Copysign(stepDistance, dy)
+	case MovementDiagonal8:
+		tan := math.Tan(math.Pi / 8)
+		if ay <= ax*tan {
+			return math.Copysign(stepDistance, dx), 0
+		}
+		if ax <= ay*tan {
+			return 0, math.Copysign(stepDistance, dy)
+		}
+		return math.Copysign(stepDistance/math.Sqrt2, dx), math.Copysign(stepDistance/math.Sqrt2, dy)
+	default:
+		d := calcDistance(0, 0, dx, dy)
+		return dx / d * stepDistance, dy / d * stepDistance
+	}
+}
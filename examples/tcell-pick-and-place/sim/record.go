@@ -0,0 +1,285 @@
+// Copyright 2021 Joseph Cumines
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build example
+// +build example
+
+package sim
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	tcell "github.com/gdamore/tcell/v2"
+	"io"
+	"math/rand"
+	"slices"
+)
+
+const (
+	recordOpConfig  = `config`
+	recordOpTick    = `tick`
+	recordOpKey     = `key`
+	recordOpResize  = `resize`
+	recordOpMove    = `move`
+	recordOpMoveBy  = `moveBy`
+	recordOpMoveAll = `moveAll`
+	recordOpGrasp   = `grasp`
+	recordOpRelease = `release`
+)
+
+type (
+	// recordEvent is a single line of a recording, see Config.Recorder, where Tick is the number of ticks prior to
+	// the event, and sprites are identified by their (1-based) index in model.sprites, or 0 if not found
+	recordEvent struct {
+		Tick int    `json:"tick"`
+		Op   string `json:"op"`
+
+		// recordOpConfig, where Seed will be set if the simulation's source of randomness was seeded by New
+
+		Scenario  string `json:"scenario,omitempty"`
+		Movement  string `json:"movement,omitempty"`
+		Inventory int    `json:"inventory,omitempty"`
+		Seed      *int64 `json:"seed,omitempty"`
+
+		// recordOpTick, the resulting positions of every sprite that moved
+
+		Moved []recordSprite `json:"moved,omitempty"`
+
+		// recordOpKey
+
+		Key  int  `json:"key,omitempty"`
+		Rune rune `json:"rune,omitempty"`
+		Mod  int  `json:"mod,omitempty"`
+
+		// recordOpResize
+
+		Width  int32 `json:"width,omitempty"`
+		Height int32 `json:"height,omitempty"`
+
+		// recordOpMove (x, y), recordOpMoveBy (dx, dy), recordOpGrasp, and recordOpRelease
+
+		Sprite int     `json:"sprite,omitempty"`
+		Target int     `json:"target,omitempty"`
+		X      float64 `json:"x,omitempty"`
+		Y      float64 `json:"y,omitempty"`
+
+		// recordOpMoveAll, ordered by sprite
+
+		Targets []recordSprite `json:"targets,omitempty"`
+	}
+
+	recordSprite struct {
+		Sprite int     `json:"sprite"`
+		X      float64 `json:"x"`
+		Y      float64 `json:"y"`
+	}
+
+	// recordRequest describes an externalLogicRequest, to be recorded on receipt
+	recordRequest struct {
+		op      string
+		sprite  Sprite
+		target  Sprite
+		x, y    float64
+		targets map[Sprite][2]float64
+	}
+)
+
+// Replay reconstructs a simulation from a recording (see Config.Recorder), by applying each input at the same tick,
+// returning the simulation as of the last recorded tick (ready to Run, or Step), note that it will fail if the
+// outcome of any tick differs from the recording, and that any Move, Grasp, Release, etc, still in progress at the
+// end of the recording will be cancelled
+func Replay(r io.Reader, screen tcell.Screen) (Simulation, error) {
+	if screen == nil {
+		return nil, fmt.Errorf(`nil screen`)
+	}
+
+	var (
+		decoder = json.NewDecoder(r)
+		event   recordEvent
+	)
+	if err := decoder.Decode(&event); err != nil {
+		return nil, fmt.Errorf(`invalid recording: %w`, err)
+	}
+	if event.Op != recordOpConfig {
+		return nil, fmt.Errorf(`invalid recording: expected %s got %s`, recordOpConfig, event.Op)
+	}
+	config := Config{
+		Screen:        screen,
+		Scenario:      event.Scenario,
+		InventorySize: event.Inventory,
+	}
+	if err := config.MovementMode.Set(event.Movement); err != nil {
+		return nil, fmt.Errorf(`invalid recording: %w`, err)
+	}
+	if event.Seed != nil {
+		config.Rand = rand.New(rand.NewSource(*event.Seed))
+	}
+	s, err := newService(config, screen)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for {
+		event = recordEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf(`invalid recording: %w`, err)
+		}
+
+		if event.Tick < s.ticks {
+			return nil, fmt.Errorf(`invalid recording: tick %d out of order`, event.Tick)
+		}
+		for s.ticks < event.Tick {
+			s.step(ctx, update{model: s.model})
+		}
+
+		u := update{model: s.model}
+		switch event.Op {
+		case recordOpTick:
+			for _, v := range event.Moved {
+				if sprite := s.model.spriteByID(v.Sprite); sprite == nil || sprite.X != v.X || sprite.Y != v.Y {
+					return nil, fmt.Errorf(`replay diverged at tick %d`, event.Tick)
+				}
+			}
+			continue
+		case recordOpKey:
+			s.key(&u, tcell.NewEventKey(tcell.Key(event.Key), event.Rune, tcell.ModMask(event.Mod)))
+		case recordOpResize:
+			u.resize(event.Width, event.Height)
+		case recordOpMove, recordOpMoveBy, recordOpGrasp, recordOpRelease:
+			var (
+				sprite = s.replaySprite(event.Sprite)
+				target = s.replaySprite(event.Target)
+			)
+			switch event.Op {
+			case recordOpMove:
+				go s.Move(ctx, sprite, event.X, event.Y)
+			case recordOpMoveBy:
+				go s.MoveBy(ctx, sprite, event.X, event.Y)
+			case recordOpGrasp:
+				go s.GraspItem(ctx, sprite, target)
+			case recordOpRelease:
+				go s.ReleaseItem(ctx, sprite, target)
+			}
+			s.replayRequest(ctx, &u)
+		case recordOpMoveAll:
+			targets := make(map[Sprite][2]float64, len(event.Targets))
+			for _, v := range event.Targets {
+				targets[s.replaySprite(v.Sprite)] = [2]float64{v.X, v.Y}
+			}
+			go s.MoveAll(ctx, targets)
+			s.replayRequest(ctx, &u)
+		default:
+			return nil, fmt.Errorf(`invalid recording: unknown op %q`, event.Op)
+		}
+		u.refreshImages()
+		s.view(u)
+	}
+
+	return s, nil
+}
+
+// replayRequest receives a (replayed) request, as would the update loop, but without recording it
+func (s *service) replayRequest(ctx context.Context, u *update) {
+	req := <-s.externalLogicChan
+	req.accept(ctx)
+	u.ExternalLogic = append(u.ExternalLogic, req.logic)
+}
+
+// record writes the event to the recorder, if any, until the first error
+func (s *service) record(event recordEvent) {
+	if s.recorder != nil && s.recordErr == nil {
+		s.recordErr = s.recorder.Encode(event)
+	}
+}
+func (s *service) recordRequest(m *model, r *recordRequest) {
+	if s.recorder == nil {
+		return
+	}
+	var targets []recordSprite
+	for sprite, target := range r.targets {
+		targets = append(targets, recordSprite{Sprite: m.spriteID(spriteModelOf(sprite)), X: target[0], Y: target[1]})
+	}
+	slices.SortFunc(targets, func(a, b recordSprite) int { return cmp.Compare(a.Sprite, b.Sprite) })
+	s.record(recordEvent{
+		Tick:    s.ticks,
+		Op:      r.op,
+		Sprite:  m.spriteID(spriteModelOf(r.sprite)),
+		Target:  m.spriteID(spriteModelOf(r.target)),
+		X:       r.x,
+		Y:       r.y,
+		Targets: targets,
+	})
+}
+func (s *service) recordTick(u *update) {
+	if s.recorder == nil {
+		return
+	}
+	event := recordEvent{Tick: s.ticks, Op: recordOpTick}
+	for _, sprite := range u.Moved {
+		event.Moved = append(event.Moved, recordSprite{Sprite: u.spriteID(sprite), X: sprite.X, Y: sprite.Y})
+	}
+	s.record(event)
+}
+
+// replaySprite returns the Sprite for a recorded id, which will not be found (by any operation), if id is invalid
+func (s *service) replaySprite(id int) Sprite {
+	if sprite := s.model.spriteByID(id); sprite != nil {
+		return s.state.new(sprite, sprite.Owner)
+	}
+	return Actor{}
+}
+
+func spriteModelOf(sprite Sprite) *spriteModel {
+	if sprite == nil {
+		return nil
+	}
+	return sprite.sprite()
+}
+
+func (m *model) spriteID(target *spriteModel) (id int) {
+	if target == nil {
+		return
+	}
+	var i int
+	m.sprites(false, func(sprite *spriteModel) bool {
+		i++
+		if sprite == target {
+			id = i
+			return false
+		}
+		return true
+	})
+	return
+}
+func (m *model) spriteByID(id int) (sprite *spriteModel) {
+	var i int
+	m.sprites(false, func(v *spriteModel) bool {
+		i++
+		if i == id {
+			sprite = v
+			return false
+		}
+		return true
+	})
+	return
+}
@@ -19,6 +19,7 @@ package sim
 import (
 	"fmt"
 	"math"
+	"slices"
 )
 
 type (
@@ -39,10 +40,35 @@ type (
 		// approximation, e.g. using Position and Size of shape to form a rectangle, checked against the receiver
 		Collides(shape Shape) bool
 		Clone() Shape
+		// Rotate returns a copy of the shape, rotated by degrees (clockwise, on screen) about its center, note that
+		// shapes without an orientation (rectangles, circles, and polygons) return an unrotated copy, see
+		// NewOrientedRectangle
+		Rotate(degrees float64) Shape
+		// Area returns the area of the shape, noting that it is the number of positions, for shapes modeled as a set
+		// of positions (i.e. circles)
+		Area() float64
+		// Contains returns true if the position (x, y) is within the shape, i.e. the shape collides with a 1x1
+		// rectangle at (x, y)
+		Contains(x, y int32) bool
 	}
 
 	shapeRectangle struct{ X, Y, W, H int32 }
 
+	// shapeCircle consists of every position within distance R of the center (X, Y), i.e. a disc
+	shapeCircle struct{ X, Y, R int32 }
+
+	// shapePolygon is a convex polygon, where Points are the vertices, with edges (and area) modeled like those of
+	// shapeRectangle, i.e. shapeRectangle{X, Y, W, H} is equivalent to the polygon (X, Y), (X+W, Y), (X+W, Y+H),
+	// (X, Y+H)
+	shapePolygon struct{ Points [][2]int32 }
+
+	// shapeOrientedRectangle is shapeRectangle{X, Y, W, H}, rotated by Angle degrees (clockwise, on screen) about
+	// its center, modeled as the shapePolygon of its corners, rounded to the nearest position
+	shapeOrientedRectangle struct {
+		X, Y, W, H int32
+		Angle      float64
+	}
+
 	shapeCollidesCycleGuard struct {
 		Shape
 		cycle bool
@@ -53,6 +79,9 @@ type (
 
 var (
 	_ Shape = (*shapeRectangle)(nil)
+	_ Shape = (*shapeCircle)(nil)
+	_ Shape = (*shapePolygon)(nil)
+	_ Shape = (*shapeOrientedRectangle)(nil)
 )
 
 func newRectangle(x, y, w, h int32) Shape {
@@ -84,6 +113,8 @@ func (s *shapeRectangle) Collides(shape Shape) bool {
 	switch shape := unpackShape(shape).(type) {
 	case *shapeRectangle:
 		return s.collidesRectangle(shape)
+	case *shapeCircle:
+		return shape.collidesRectangle(s)
 	}
 	if collides, cycle := s.collidesShape(shape); collides || !cycle {
 		return collides
@@ -115,6 +146,405 @@ func (s *shapeRectangle) Clone() Shape {
 	v := *s
 	return &v
 }
+func (s *shapeRectangle) Rotate(float64) Shape { return s.Clone() }
+func (s *shapeRectangle) Area() float64        { return float64(s.W) * float64(s.H) }
+func (s *shapeRectangle) Contains(x, y int32) bool {
+	return x >= s.X && x < s.X+s.W && y >= s.Y && y < s.Y+s.H
+}
+
+// newCircle returns a Shape consisting of every position within distance r of the center (cx, cy), note that the
+// Position will be the top left corner of the bounding box, i.e. (cx-r, cy-r)
+func newCircle(cx, cy, r int32) Shape {
+	if r < 0 {
+		panic(fmt.Errorf(`sim.newCircle invalid input: %d, %d, %d`, cx, cy, r))
+	}
+	return &shapeCircle{cx, cy, r}
+}
+
+func (s *shapeCircle) Position() (int32, int32) { return s.X - s.R, s.Y - s.R }
+func (s *shapeCircle) SetPosition(x, y int32)   { s.X, s.Y = x+s.R, y+s.R }
+func (s *shapeCircle) Size() (int32, int32)     { return s.R*2 + 1, s.R*2 + 1 }
+func (s *shapeCircle) Center() (int32, int32)   { return s.X, s.Y }
+func (s *shapeCircle) Closest(x, y int32) (int32, int32) {
+	if s.contains(x, y) {
+		return x, y
+	}
+	// the nearest position (to x, y) out of those surrounding the intersection with the edge of the circle, at least
+	// one of which (the one towards the center) will be contained by the receiver
+	var (
+		dx, dy = float64(x - s.X), float64(y - s.Y)
+		scale  = float64(s.R) / math.Sqrt(dx*dx+dy*dy)
+		px, py = float64(s.X) + dx*scale, float64(s.Y) + dy*scale
+		cx, cy int32
+		best   = int64(-1)
+	)
+	for _, vx := range [...]float64{math.Floor(px), math.Ceil(px)} {
+		for _, vy := range [...]float64{math.Floor(py), math.Ceil(py)} {
+			if vx, vy := int32(vx), int32(vy); s.contains(vx, vy) {
+				if d := int64(x-vx)*int64(x-vx) + int64(y-vy)*int64(y-vy); best < 0 || d < best {
+					cx, cy, best = vx, vy, d
+				}
+			}
+		}
+	}
+	return cx, cy
+}
+func (s *shapeCircle) Distance(shape Shape) float64 {
+	var (
+		x1, y1 = s.Closest(shape.Center())
+		x2, y2 = shape.Closest(s.Center())
+	)
+	return calcDistance(float64(x1), float64(y1), float64(x2), float64(y2))
+}
+func (s *shapeCircle) Collides(shape Shape) bool {
+	switch shape := unpackShape(shape).(type) {
+	case *shapeRectangle:
+		return s.collidesRectangle(shape)
+	case *shapeCircle:
+		return s.collidesCircle(shape)
+	}
+	g := &shapeCollidesCycleGuard{Shape: s}
+	if collides := shape.Collides(g); collides || !g.cycle {
+		return collides
+	}
+	var r shapeRectangle
+	r.X, r.Y = shape.Position()
+	r.W, r.H = shape.Size()
+	return s.collidesRectangle(&r)
+}
+func (s *shapeCircle) collidesRectangle(shape *shapeRectangle) bool {
+	if shape.W <= 0 || shape.H <= 0 {
+		return false
+	}
+	return s.contains(closestBounds(shape.X, shape.W, s.X), closestBounds(shape.Y, shape.H, s.Y))
+}
+func (s *shapeCircle) collidesCircle(shape *shapeCircle) bool {
+	dx, dy, r := int64(s.X-shape.X), int64(s.Y-shape.Y), int64(s.R+shape.R)
+	return dx*dx+dy*dy <= r*r
+}
+func (s *shapeCircle) contains(x, y int32) bool {
+	dx, dy, r := int64(x-s.X), int64(y-s.Y), int64(s.R)
+	return dx*dx+dy*dy <= r*r
+}
+func (s *shapeCircle) Clone() Shape {
+	v := *s
+	return &v
+}
+func (s *shapeCircle) Rotate(float64) Shape { return s.Clone() }
+func (s *shapeCircle) Area() float64 {
+	var n int64
+	for dx := -int64(s.R); dx <= int64(s.R); dx++ {
+		n += 2*int64(math.Sqrt(float64(int64(s.R)*int64(s.R)-dx*dx))) + 1
+	}
+	return float64(n)
+}
+func (s *shapeCircle) Contains(x, y int32) bool { return s.contains(x, y) }
+
+// newPolygon returns a Shape modeling the convex polygon with the given vertices (in either winding order), which
+// will be copied, note that it will panic if points has less than 3 vertices, or isn't convex with a non-zero area
+func newPolygon(points [][2]int32) Shape {
+	s := &shapePolygon{Points: append([][2]int32(nil), points...)}
+	if !s.valid() {
+		panic(fmt.Errorf(`sim.newPolygon invalid input: %v`, points))
+	}
+	return s
+}
+
+func (s *shapePolygon) Position() (int32, int32) {
+	x, y, _, _ := s.bounds()
+	return x, y
+}
+func (s *shapePolygon) SetPosition(x, y int32) {
+	ox, oy, _, _ := s.bounds()
+	for i := range s.Points {
+		s.Points[i][0] += x - ox
+		s.Points[i][1] += y - oy
+	}
+}
+func (s *shapePolygon) Size() (int32, int32) {
+	x1, y1, x2, y2 := s.bounds()
+	return x2 - x1, y2 - y1
+}
+
+// Center returns the centroid, rounded down (consistent with shapeRectangle)
+func (s *shapePolygon) Center() (int32, int32) {
+	var a, cx, cy float64
+	for i, p := range s.Points {
+		q := s.Points[(i+1)%len(s.Points)]
+		c := float64(p[0])*float64(q[1]) - float64(q[0])*float64(p[1])
+		a += c
+		cx += float64(p[0]+q[0]) * c
+		cy += float64(p[1]+q[1]) * c
+	}
+	return int32(math.Floor(cx / (3 * a))), int32(math.Floor(cy / (3 * a)))
+}
+
+// Closest returns the nearest point on the boundary of the polygon, rounded to the nearest position, or the target
+// itself, if it is within the polygon
+func (s *shapePolygon) Closest(x, y int32) (int32, int32) {
+	if s.contains(x, y) {
+		return x, y
+	}
+	var (
+		tx, ty = float64(x), float64(y)
+		cx, cy float64
+		best   = math.Inf(1)
+	)
+	for i, p := range s.Points {
+		var (
+			q      = s.Points[(i+1)%len(s.Points)]
+			px, py = float64(p[0]), float64(p[1])
+			dx, dy = float64(q[0]) - px, float64(q[1]) - py
+			t      = ((tx-px)*dx + (ty-py)*dy) / (dx*dx + dy*dy)
+		)
+		t = math.Max(0, math.Min(1, t))
+		if d := calcDistance(px+t*dx, py+t*dy, tx, ty); d < best {
+			cx, cy, best = px+t*dx, py+t*dy, d
+		}
+	}
+	return RoundPosition(cx, cy)
+}
+func (s *shapePolygon) Distance(shape Shape) float64 {
+	var (
+		x1, y1 = s.Closest(shape.Center())
+		x2, y2 = shape.Closest(s.Center())
+	)
+	return calcDistance(float64(x1), float64(y1), float64(x2), float64(y2))
+}
+func (s *shapePolygon) Collides(shape Shape) bool {
+	switch shape := unpackShape(shape).(type) {
+	case *shapePolygon:
+		return s.collidesPolygon(shape)
+	case *shapeRectangle:
+		return s.collidesRectangle(shape)
+	case *shapeCircle:
+		// handled explicitly, as shapeCircle would also unpack the cycle guard
+		return s.collidesCircle(shape)
+	}
+	g := &shapeCollidesCycleGuard{Shape: s}
+	if collides := shape.Collides(g); collides || !g.cycle {
+		return collides
+	}
+	var r shapeRectangle
+	r.X, r.Y = shape.Position()
+	r.W, r.H = shape.Size()
+	return s.collidesRectangle(&r)
+}
+func (s *shapePolygon) collidesRectangle(shape *shapeRectangle) bool {
+	if shape.W <= 0 || shape.H <= 0 {
+		return false
+	}
+	return s.collidesPolygon(&shapePolygon{Points: [][2]int32{
+		{shape.X, shape.Y},
+		{shape.X + shape.W, shape.Y},
+		{shape.X + shape.W, shape.Y + shape.H},
+		{shape.X, shape.Y + shape.H},
+	}})
+}
+
+// collidesCircle checks each position of the circle, as a 1x1 rectangle
+func (s *shapePolygon) collidesCircle(shape *shapeCircle) bool {
+	x, y := shape.Position()
+	w, h := shape.Size()
+	for cx := x; cx < x+w; cx++ {
+		for cy := y; cy < y+h; cy++ {
+			if shape.contains(cx, cy) && s.collidesRectangle(&shapeRectangle{cx, cy, 1, 1}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collidesPolygon uses the separating axis theorem, where touching edges don't collide
+func (s *shapePolygon) collidesPolygon(shape *shapePolygon) bool {
+	return !s.separates(shape) && !shape.separates(s)
+}
+
+// separates returns true if any of the receiver's edge normals separates it from shape
+func (s *shapePolygon) separates(shape *shapePolygon) bool {
+	for i, p := range s.Points {
+		var (
+			q          = s.Points[(i+1)%len(s.Points)]
+			nx, ny     = int64(p[1] - q[1]), int64(q[0] - p[0])
+			minA, maxA = projectPoints(s.Points, nx, ny)
+			minB, maxB = projectPoints(shape.Points, nx, ny)
+		)
+		if maxA <= minB || maxB <= minA {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if (x, y) is within the polygon, including on the boundary
+func (s *shapePolygon) contains(x, y int32) bool {
+	var sign int64
+	for i, p := range s.Points {
+		q := s.Points[(i+1)%len(s.Points)]
+		c := int64(q[0]-p[0])*int64(y-p[1]) - int64(q[1]-p[1])*int64(x-p[0])
+		if c == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = c
+		} else if (c > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return true
+}
+func (s *shapePolygon) bounds() (x1, y1, x2, y2 int32) {
+	x1, y1, x2, y2 = s.Points[0][0], s.Points[0][1], s.Points[0][0], s.Points[0][1]
+	for _, p := range s.Points[1:] {
+		x1, y1 = min(x1, p[0]), min(y1, p[1])
+		x2, y2 = max(x2, p[0]), max(y2, p[1])
+	}
+	return
+}
+
+// valid returns true if the polygon has at least 3 vertices, and is convex, with a non-zero area
+func (s *shapePolygon) valid() bool {
+	if len(s.Points) < 3 {
+		return false
+	}
+	var sign int64
+	for i, p := range s.Points {
+		var (
+			q = s.Points[(i+1)%len(s.Points)]
+			r = s.Points[(i+2)%len(s.Points)]
+			c = int64(q[0]-p[0])*int64(r[1]-q[1]) - int64(q[1]-p[1])*int64(r[0]-q[0])
+		)
+		if c == 0 {
+			continue
+		}
+		if sign == 0 {
+			sign = c
+		} else if (c > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return sign != 0
+}
+func (s *shapePolygon) Clone() Shape {
+	return &shapePolygon{Points: append([][2]int32(nil), s.Points...)}
+}
+func (s *shapePolygon) Rotate(float64) Shape { return s.Clone() }
+func (s *shapePolygon) Area() float64 {
+	var a int64
+	for i, p := range s.Points {
+		q := s.Points[(i+1)%len(s.Points)]
+		a += int64(p[0])*int64(q[1]) - int64(q[0])*int64(p[1])
+	}
+	if a < 0 {
+		a = -a
+	}
+	return float64(a) / 2
+}
+func (s *shapePolygon) Contains(x, y int32) bool {
+	return s.collidesRectangle(&shapeRectangle{x, y, 1, 1})
+}
+
+// newOrientedRectangle returns a Shape modeling the rectangle (x, y, w, h), rotated by degrees (clockwise, on
+// screen) about its center, note that Position and Size are that of the rotated bounding box
+func newOrientedRectangle(x, y, w, h int32, degrees float64) Shape {
+	if w <= 0 || h <= 0 {
+		panic(fmt.Errorf(`sim.newOrientedRectangle invalid input: %d, %d, %d %d`, x, y, w, h))
+	}
+	return &shapeOrientedRectangle{x, y, w, h, normalizeDegrees(degrees)}
+}
+
+func (s *shapeOrientedRectangle) Position() (int32, int32) { return s.polygon().Position() }
+func (s *shapeOrientedRectangle) SetPosition(x, y int32) {
+	// the rounding of the corners is unaffected by translation
+	ox, oy := s.Position()
+	s.X += x - ox
+	s.Y += y - oy
+}
+func (s *shapeOrientedRectangle) Size() (int32, int32)   { return s.polygon().Size() }
+func (s *shapeOrientedRectangle) Center() (int32, int32) { return s.W/2 + s.X, s.H/2 + s.Y }
+func (s *shapeOrientedRectangle) Closest(x, y int32) (int32, int32) {
+	return s.polygon().Closest(x, y)
+}
+func (s *shapeOrientedRectangle) Distance(shape Shape) float64 {
+	var (
+		x1, y1 = s.Closest(shape.Center())
+		x2, y2 = shape.Closest(s.Center())
+	)
+	return calcDistance(float64(x1), float64(y1), float64(x2), float64(y2))
+}
+
+// Collides uses shapePolygon (i.e. the separating axis theorem, for polygons and rectangles)
+func (s *shapeOrientedRectangle) Collides(shape Shape) bool {
+	if shape, ok := unpackShape(shape).(*shapeOrientedRectangle); ok {
+		return s.polygon().collidesPolygon(shape.polygon())
+	}
+	return s.polygon().Collides(shape)
+}
+func (s *shapeOrientedRectangle) Clone() Shape {
+	v := *s
+	return &v
+}
+func (s *shapeOrientedRectangle) Rotate(degrees float64) Shape {
+	v := *s
+	v.Angle = normalizeDegrees(v.Angle + degrees)
+	return &v
+}
+func (s *shapeOrientedRectangle) Area() float64            { return s.polygon().Area() }
+func (s *shapeOrientedRectangle) Contains(x, y int32) bool { return s.polygon().Contains(x, y) }
+
+// polygon returns the rotated corners, or the unrotated corners, if rounding would merge any corners, or result in
+// an invalid polygon
+func (s *shapeOrientedRectangle) polygon() *shapePolygon {
+	corners := [...][2]int32{
+		{s.X, s.Y},
+		{s.X + s.W, s.Y},
+		{s.X + s.W, s.Y + s.H},
+		{s.X, s.Y + s.H},
+	}
+	var (
+		sin, cos = math.Sincos(s.Angle * math.Pi / 180)
+		cx, cy   = float64(s.X) + float64(s.W)/2, float64(s.Y) + float64(s.H)/2
+		p        = &shapePolygon{Points: make([][2]int32, 0, len(corners))}
+	)
+	for _, corner := range corners {
+		dx, dy := float64(corner[0])-cx, float64(corner[1])-cy
+		point := [2]int32{
+			int32(math.Floor(cx + dx*cos - dy*sin + 0.5)),
+			int32(math.Floor(cy + dx*sin + dy*cos + 0.5)),
+		}
+		if slices.Contains(p.Points, point) {
+			p.Points = corners[:]
+			return p
+		}
+		p.Points = append(p.Points, point)
+	}
+	if !p.valid() {
+		p.Points = corners[:]
+	}
+	return p
+}
+
+// normalizeDegrees returns the equivalent angle in the range [0, 360)
+func normalizeDegrees(degrees float64) float64 {
+	if degrees = math.Mod(degrees, 360); degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+func projectPoints(points [][2]int32, nx, ny int64) (lo, hi int64) {
+	for i, p := range points {
+		v := int64(p[0])*nx + int64(p[1])*ny
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+	return
+}
 
 func (s *shapeCollidesCycleGuard) Collides(Shape) bool {
 	s.cycle = true
@@ -18,6 +18,7 @@ package sim
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -108,3 +109,431 @@ func TestShapeRectangle_Clone(t *testing.T) {
 		t.Error(b)
 	}
 }
+
+func TestShapeRectangle_Area(t *testing.T) {
+	if v := (&shapeRectangle{1, 2, 3, 4}).Area(); v != 12 {
+		t.Error(v)
+	}
+	if v := (&shapeRectangle{-5, -5, 1, 1}).Area(); v != 1 {
+		t.Error(v)
+	}
+}
+
+func TestShapeRectangle_Contains(t *testing.T) {
+	s := &shapeRectangle{1, 2, 3, 4}
+	for _, tc := range []struct {
+		X, Y int32
+		C    bool
+	}{
+		// corners
+		{1, 2, true},
+		{3, 2, true},
+		{1, 5, true},
+		{3, 5, true},
+		{0, 1, false},
+		{4, 1, false},
+		{0, 6, false},
+		{4, 6, false},
+		// edges
+		{2, 2, true},
+		{1, 3, true},
+		{3, 4, true},
+		{2, 5, true},
+		{2, 1, false},
+		{0, 3, false},
+		{4, 4, false},
+		{2, 6, false},
+		// centre
+		{2, 4, true},
+	} {
+		if c := s.Contains(tc.X, tc.Y); c != tc.C {
+			t.Error(tc, c)
+		}
+	}
+}
+
+func TestShapeCircle_Collides(t *testing.T) {
+	for _, tc := range []struct {
+		C *shapeCircle
+		S Shape
+		R bool
+	}{
+		// circle-circle
+		{&shapeCircle{0, 0, 0}, &shapeCircle{0, 0, 0}, true},
+		{&shapeCircle{0, 0, 0}, &shapeCircle{1, 0, 0}, false},
+		{&shapeCircle{0, 0, 1}, &shapeCircle{1, 0, 0}, true},
+		{&shapeCircle{0, 0, 1}, &shapeCircle{2, 0, 1}, true},  // tangent
+		{&shapeCircle{0, 0, 1}, &shapeCircle{3, 0, 1}, false}, // gap
+		{&shapeCircle{0, 0, 2}, &shapeCircle{3, 4, 3}, true},  // tangent (3-4-5)
+		{&shapeCircle{0, 0, 2}, &shapeCircle{3, 4, 2}, false},
+		{&shapeCircle{0, 0, 1}, &shapeCircle{2, 2, 1}, false}, // bounding boxes overlap
+		{&shapeCircle{0, 0, 5}, &shapeCircle{1, 1, 1}, true},  // contained
+		// circle-rectangle
+		{&shapeCircle{0, 0, 0}, &shapeRectangle{0, 0, 1, 1}, true},
+		{&shapeCircle{0, 0, 0}, &shapeRectangle{1, 0, 1, 1}, false},
+		{&shapeCircle{0, 0, 1}, &shapeRectangle{1, 0, 1, 1}, true},     // tangent
+		{&shapeCircle{0, 0, 1}, &shapeRectangle{2, 0, 1, 1}, false},    // gap
+		{&shapeCircle{0, 0, 1}, &shapeRectangle{1, 1, 1, 1}, false},    // corner of bounding box
+		{&shapeCircle{0, 0, 1}, &shapeRectangle{-1, 1, 3, 1}, true},    // edge
+		{&shapeCircle{0, 0, 2}, &shapeRectangle{1, 1, 3, 3}, true},     // corner
+		{&shapeCircle{0, 0, 2}, &shapeRectangle{2, 2, 3, 3}, false},    // corner, bounding boxes overlap
+		{&shapeCircle{0, 0, 2}, &shapeRectangle{-5, -5, 10, 10}, true}, // contained
+		{&shapeCircle{5, 5, 1}, &shapeRectangle{0, 0, 10, 10}, true},   // contained
+		{&shapeCircle{0, 0, 3}, &shapeRectangle{}, false},
+	} {
+		t.Run(fmt.Sprintf(`%#v %#v %#v`, tc.C, tc.S, tc.R), func(t *testing.T) {
+			c := tc.C.Collides(tc.S)
+			if c != tc.R {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(tc.C) {
+				t.Error(c)
+			}
+			if c != tc.C.Collides(&shapeIsUnknown{tc.S}) {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(&shapeIsUnknown{tc.C}) {
+				t.Error(c)
+			}
+			if _, ok := tc.S.(*shapeRectangle); ok {
+				// approximated using the bounding box, which is exact for rectangles
+				if c != tc.C.Collides(&shapeHasUnknown{tc.S}) {
+					t.Error(c)
+				}
+			}
+		})
+	}
+}
+
+func TestShapeCircle_SetPosition(t *testing.T) {
+	s := shapeCircle{R: 2}
+	s.SetPosition(2, 3)
+	if s != (shapeCircle{X: 4, Y: 5, R: 2}) {
+		t.Error(s)
+	}
+	if x, y := s.Position(); x != 2 || y != 3 {
+		t.Error(x, y)
+	}
+	if x, y := s.Center(); x != 4 || y != 5 {
+		t.Error(x, y)
+	}
+}
+
+func TestShapeCircle_Size(t *testing.T) {
+	if w, h := (&shapeCircle{1, 2, 3}).Size(); w != 7 || h != 7 {
+		t.Error(w, h)
+	}
+	if w, h := (&shapeCircle{1, 2, 0}).Size(); w != 1 || h != 1 {
+		t.Error(w, h)
+	}
+}
+
+func TestShapeCircle_Closest(t *testing.T) {
+	for _, tc := range []struct {
+		C            shapeCircle
+		X, Y, CX, CY int32
+	}{
+		{shapeCircle{0, 0, 2}, 0, 0, 0, 0},
+		{shapeCircle{0, 0, 2}, 1, 1, 1, 1},
+		{shapeCircle{0, 0, 2}, 5, 0, 2, 0},
+		{shapeCircle{0, 0, 2}, 0, -5, 0, -2},
+		{shapeCircle{0, 0, 2}, 5, 5, 1, 1},
+		{shapeCircle{0, 0, 1}, 5, 5, 0, 1},
+		{shapeCircle{0, 0, 1}, 5, 4, 1, 0},
+		{shapeCircle{3, 3, 2}, -2, -2, 2, 2},
+	} {
+		t.Run(fmt.Sprintf(`%v_%d_%d`, tc.C, tc.X, tc.Y), func(t *testing.T) {
+			if cx, cy := tc.C.Closest(tc.X, tc.Y); cx != tc.CX || cy != tc.CY {
+				t.Error(cx, cy)
+			}
+		})
+	}
+}
+
+func TestShapeCircle_Clone(t *testing.T) {
+	a := &shapeCircle{1, 2, 3}
+	if b := a.Clone().(*shapeCircle); a == b || *a != *b || *b != (shapeCircle{1, 2, 3}) {
+		t.Error(b)
+	}
+}
+
+func TestShapePolygon_Collides(t *testing.T) {
+	triangle := func() *shapePolygon { return &shapePolygon{Points: [][2]int32{{0, 0}, {4, 0}, {0, 4}}} }
+	for _, tc := range []struct {
+		P *shapePolygon
+		S Shape
+		C bool
+	}{
+		// triangle-rectangle
+		{triangle(), &shapeRectangle{0, 0, 1, 1}, true},
+		{triangle(), &shapeRectangle{1, 1, 2, 2}, true},
+		{triangle(), &shapeRectangle{-1, -1, 2, 2}, true},
+		{triangle(), &shapeRectangle{-2, 1, 10, 1}, true},
+		{triangle(), &shapeRectangle{2, 2, 2, 2}, false},   // touching the hypotenuse
+		{triangle(), &shapeRectangle{3, 3, 1, 1}, false},   // within the bounding box
+		{triangle(), &shapeRectangle{4, 0, 1, 1}, false},   // touching a vertex
+		{triangle(), &shapeRectangle{-1, -1, 1, 1}, false}, // touching a vertex
+		{triangle(), &shapeRectangle{0, -1, 4, 1}, false},  // touching an edge
+		{triangle(), &shapeRectangle{5, 5, 1, 1}, false},
+		{triangle(), &shapeRectangle{}, false},
+		// polygon-polygon
+		{triangle(), triangle(), true},
+		{triangle(), &shapePolygon{Points: [][2]int32{{4, 0}, {4, 4}, {0, 4}}}, false}, // touching the hypotenuse
+		{triangle(), &shapePolygon{Points: [][2]int32{{3, 0}, {4, 4}, {0, 3}}}, true},
+		{triangle(), &shapePolygon{Points: [][2]int32{{1, 1}, {2, 1}, {1, 2}}}, true}, // contained
+		{triangle(), &shapePolygon{Points: [][2]int32{{5, 0}, {6, 0}, {5, 6}}}, false},
+		// polygon-circle
+		{triangle(), &shapeCircle{2, 2, 1}, true},
+		{triangle(), &shapeCircle{3, 3, 1}, false},
+		{triangle(), &shapeCircle{5, 5, 1}, false},
+		// rectangle-equivalent
+		{&shapePolygon{Points: [][2]int32{{0, 0}, {3, 0}, {3, 2}, {0, 2}}}, &shapeRectangle{2, 1, 1, 1}, true},
+		{&shapePolygon{Points: [][2]int32{{0, 0}, {3, 0}, {3, 2}, {0, 2}}}, &shapeRectangle{3, 1, 1, 1}, false},
+		{&shapePolygon{Points: [][2]int32{{0, 0}, {3, 0}, {3, 2}, {0, 2}}}, &shapeRectangle{-2, -2, 3, 3}, true},
+		{&shapePolygon{Points: [][2]int32{{0, 0}, {3, 0}, {3, 2}, {0, 2}}}, &shapeRectangle{-2, -3, 3, 3}, false},
+	} {
+		t.Run(fmt.Sprintf(`%v %#v %#v`, tc.P.Points, tc.S, tc.C), func(t *testing.T) {
+			c := tc.P.Collides(tc.S)
+			if c != tc.C {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(tc.P) {
+				t.Error(c)
+			}
+			if c != tc.P.Collides(&shapeIsUnknown{tc.S}) {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(&shapeIsUnknown{tc.P}) {
+				t.Error(c)
+			}
+			if _, ok := tc.S.(*shapeRectangle); ok {
+				// approximated using the bounding box, which is exact for rectangles
+				if c != tc.P.Collides(&shapeHasUnknown{tc.S}) {
+					t.Error(c)
+				}
+			}
+		})
+	}
+}
+
+func TestShapePolygon_SetPosition(t *testing.T) {
+	s := newPolygon([][2]int32{{1, 5}, {5, 1}, {5, 5}}).(*shapePolygon)
+	if x, y := s.Position(); x != 1 || y != 1 {
+		t.Error(x, y)
+	}
+	s.SetPosition(-2, 3)
+	if v := fmt.Sprint(s.Points); v != `[[-2 7] [2 3] [2 7]]` {
+		t.Error(v)
+	}
+	if x, y := s.Position(); x != -2 || y != 3 {
+		t.Error(x, y)
+	}
+}
+
+func TestShapePolygon_Size(t *testing.T) {
+	if w, h := newPolygon([][2]int32{{1, 5}, {5, 1}, {6, 5}}).Size(); w != 5 || h != 4 {
+		t.Error(w, h)
+	}
+}
+
+func TestShapePolygon_Center(t *testing.T) {
+	for _, tc := range []struct {
+		P      [][2]int32
+		CX, CY int32
+	}{
+		{[][2]int32{{0, 0}, {4, 0}, {0, 4}}, 1, 1},
+		{[][2]int32{{0, 0}, {6, 0}, {6, 6}}, 4, 2},
+		{[][2]int32{{0, 0}, {3, 0}, {3, 2}, {0, 2}}, 1, 1}, // same as shapeRectangle{0, 0, 3, 2}
+	} {
+		if cx, cy := newPolygon(tc.P).Center(); cx != tc.CX || cy != tc.CY {
+			t.Error(tc.P, cx, cy)
+		}
+	}
+}
+
+func TestShapePolygon_Closest(t *testing.T) {
+	s := newPolygon([][2]int32{{0, 0}, {4, 0}, {0, 4}})
+	for _, tc := range []struct{ X, Y, CX, CY int32 }{
+		{1, 1, 1, 1},
+		{4, 0, 4, 0},
+		{5, 5, 2, 2},
+		{-3, 1, 0, 1},
+		{2, -7, 2, 0},
+		{9, -1, 4, 0},
+	} {
+		if cx, cy := s.Closest(tc.X, tc.Y); cx != tc.CX || cy != tc.CY {
+			t.Error(tc, cx, cy)
+		}
+	}
+}
+
+func TestShapePolygon_Clone(t *testing.T) {
+	a := newPolygon([][2]int32{{0, 0}, {4, 0}, {0, 4}}).(*shapePolygon)
+	b := a.Clone().(*shapePolygon)
+	b.SetPosition(1, 1)
+	if v := fmt.Sprint(a.Points); v != `[[0 0] [4 0] [0 4]]` {
+		t.Error(v)
+	}
+	if v := fmt.Sprint(b.Points); v != `[[1 1] [5 1] [1 5]]` {
+		t.Error(v)
+	}
+}
+
+func TestNewPolygon_invalid(t *testing.T) {
+	for _, points := range [][][2]int32{
+		nil,
+		{{0, 0}, {1, 1}},
+		{{0, 0}, {1, 1}, {2, 2}},
+		{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}}, // L-shaped
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error(points)
+				}
+			}()
+			newPolygon(points)
+		}()
+	}
+}
+
+func TestShapeOrientedRectangle_Collides(t *testing.T) {
+	// a 4x4 square, rotated 45 degrees, is the diamond (2, -1), (5, 2), (2, 5), (-1, 2)
+	diamond := func() *shapeOrientedRectangle { return newOrientedRectangle(0, 0, 4, 4, 45).(*shapeOrientedRectangle) }
+	if v := fmt.Sprint(diamond().polygon().Points); v != `[[2 -1] [5 2] [2 5] [-1 2]]` {
+		t.Fatal(v)
+	}
+	for _, tc := range []struct {
+		O *shapeOrientedRectangle
+		S Shape
+		C bool
+	}{
+		{diamond(), &shapeRectangle{1, 1, 2, 2}, true},
+		{diamond(), &shapeRectangle{0, 0, 1, 1}, true},
+		{diamond(), &shapeRectangle{4, 2, 1, 1}, true},   // outside the unrotated square
+		{diamond(), &shapeRectangle{-1, -1, 1, 1}, false}, // inside the unrotated square's bounding box
+		{diamond(), &shapeRectangle{3, -1, 1, 1}, false},  // touching an edge
+		{diamond(), &shapeRectangle{5, 2, 1, 1}, false},   // touching a vertex
+		{diamond(), &shapeRectangle{3, 3, 3, 3}, true},
+		{diamond(), &shapeCircle{2, 2, 1}, true},
+		{diamond(), &shapeCircle{5, 5, 1}, false},
+		{diamond(), &shapePolygon{Points: [][2]int32{{4, 0}, {6, 0}, {6, 2}}}, false},
+		{diamond(), &shapePolygon{Points: [][2]int32{{3, 0}, {6, 0}, {6, 3}}}, false}, // touching an edge
+		{diamond(), &shapePolygon{Points: [][2]int32{{2, 0}, {6, 0}, {6, 4}}}, true},
+		{diamond(), diamond(), true},
+		{diamond(), newOrientedRectangle(6, 0, 4, 4, 45), false}, // touching vertices
+		{diamond(), newOrientedRectangle(4, 0, 4, 4, 45), true},
+		{diamond(), newOrientedRectangle(4, 0, 4, 4, 0), true},
+	} {
+		t.Run(fmt.Sprintf(`%v %#v %#v`, tc.O.polygon().Points, tc.S, tc.C), func(t *testing.T) {
+			c := tc.O.Collides(tc.S)
+			if c != tc.C {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(tc.O) {
+				t.Error(c)
+			}
+			if c != tc.O.Collides(&shapeIsUnknown{tc.S}) {
+				t.Error(c)
+			}
+			if c != tc.S.Collides(&shapeIsUnknown{tc.O}) {
+				t.Error(c)
+			}
+		})
+	}
+}
+
+func TestShapeOrientedRectangle_SetPosition(t *testing.T) {
+	s := newOrientedRectangle(0, 0, 4, 4, 45)
+	if x, y := s.Position(); x != -1 || y != -1 {
+		t.Error(x, y)
+	}
+	s.SetPosition(-7, 3)
+	if v := fmt.Sprint(s.(*shapeOrientedRectangle).polygon().Points); v != `[[-4 3] [-1 6] [-4 9] [-7 6]]` {
+		t.Error(v)
+	}
+	if w, h := s.Size(); w != 6 || h != 6 {
+		t.Error(w, h)
+	}
+}
+
+func TestShape_Rotate(t *testing.T) {
+	for _, s := range []Shape{
+		&shapeRectangle{1, 2, 3, 4},
+		&shapeCircle{1, 2, 3},
+		newPolygon([][2]int32{{0, 0}, {4, 0}, {0, 4}}),
+	} {
+		if v := s.Rotate(45); v == s || !reflect.DeepEqual(v, s) {
+			t.Errorf(`expected an unrotated copy of %#v`, s)
+		}
+	}
+
+	a := newOrientedRectangle(0, 0, 4, 2, 0)
+	b := a.Rotate(45).Rotate(45)
+	if v := a.(*shapeOrientedRectangle).Angle; v != 0 {
+		t.Error(v)
+	}
+	if v := b.(*shapeOrientedRectangle).Angle; v != 90 {
+		t.Error(v)
+	}
+	if w, h := b.Size(); w != 2 || h != 4 {
+		t.Error(w, h)
+	}
+	if cx, cy := b.Center(); cx != 2 || cy != 1 {
+		t.Error(cx, cy)
+	}
+	if v := b.Rotate(-450).(*shapeOrientedRectangle).Angle; v != 0 {
+		t.Error(v)
+	}
+	// rounding would collapse the rotated corners of a 1x1 square, so it falls back to the unrotated corners
+	if v := fmt.Sprint(newOrientedRectangle(0, 0, 1, 1, 45).(*shapeOrientedRectangle).polygon().Points); v != `[[0 0] [1 0] [1 1] [0 1]]` {
+		t.Error(v)
+	}
+}
+
+func TestShape_Area(t *testing.T) {
+	for _, tc := range []struct {
+		S Shape
+		A float64
+	}{
+		{&shapeCircle{0, 0, 0}, 1},
+		{&shapeCircle{3, 3, 1}, 5},
+		{&shapeCircle{3, 3, 2}, 13},
+		{newPolygon([][2]int32{{0, 0}, {4, 0}, {0, 4}}), 8},
+		{newPolygon([][2]int32{{0, 0}, {0, 2}, {3, 2}, {3, 0}}), 6},
+		{newOrientedRectangle(0, 0, 4, 4, 0), 16},
+		{newOrientedRectangle(0, 0, 4, 4, 45), 18},
+	} {
+		if a := tc.S.Area(); a != tc.A {
+			t.Errorf(`%#v: %v`, tc.S, a)
+		}
+	}
+}
+
+func TestShape_Contains(t *testing.T) {
+	for _, s := range []Shape{
+		&shapeRectangle{1, 2, 3, 4},
+		&shapeCircle{3, 3, 2},
+		newPolygon([][2]int32{{0, 0}, {4, 0}, {0, 4}}),
+		newOrientedRectangle(0, 0, 4, 4, 45),
+	} {
+		var n int
+		for x := int32(-3); x < 9; x++ {
+			for y := int32(-3); y < 9; y++ {
+				c := s.Contains(x, y)
+				if c != s.Collides(&shapeRectangle{x, y, 1, 1}) {
+					t.Errorf(`%#v: %d, %d`, s, x, y)
+				}
+				if c {
+					n++
+				}
+			}
+		}
+		if n == 0 {
+			t.Errorf(`%#v: expected positions`, s)
+		}
+	}
+	if s := (&shapeCircle{3, 3, 2}); !s.Contains(3, 3) || !s.Contains(5, 3) || s.Contains(5, 5) {
+		t.Error(`unexpected circle containment`)
+	}
+}
@@ -18,10 +18,16 @@
 package sim
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"fmt"
 	tcell "github.com/gdamore/tcell/v2"
+	"io"
+	"maps"
 	"math"
+	"math/rand"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -36,6 +42,7 @@ const (
 	spaceWidth      = baseWidth - hudWidth
 	spaceHeight     = baseHeight
 	runeExtra       = '#'
+	runeWall        = '%'
 	stepDistance    = 6.0 / tickPerSecond
 	tickPerSecond   = 30.0
 	defaultInterval = time.Second / tickPerSecond
@@ -49,12 +56,15 @@ arrows = move
 space = stop/start
 wasd = turn
 numbers = pick
-'r' = place`
+'r' = place
+click = go to`
 )
 
 const (
 	scenarioStatic       = `static`
 	scenarioHumanVsRobot = `human-vs-robot`
+	scenarioMultiActor   = `multi-actor`
+	scenarioAnyCube      = `any-cube`
 )
 
 type (
@@ -67,15 +77,101 @@ type (
 		// pathfinding), note that it must be called with a key from the Sprites map
 		Move(ctx context.Context, sprite Sprite, x, y float64) error
 
+		// MoveBy is equivalent to Move, but with a target position relative to the Sprite's position (at the time
+		// the move starts)
+		MoveBy(ctx context.Context, sprite Sprite, dx, dy float64) error
+
+		// MoveAll is equivalent to calling Move for each of targets (sprite to x, y), concurrently, except that the
+		// movements are applied together (in lockstep, each tick), returning once every sprite has reached its
+		// target, or the first error, in which case the remaining sprites will be stopped
+		MoveAll(ctx context.Context, targets map[Sprite][2]float64) error
+
 		Grasp(ctx context.Context, sprite Sprite, target Sprite) error
 
 		Release(ctx context.Context, sprite Sprite, target Sprite) error
+
+		// GraspItem is equivalent to Grasp, but also returns the item held by the actor (sprite), after grasping
+		GraspItem(ctx context.Context, sprite Sprite, target Sprite) (Sprite, error)
+
+		// ReleaseItem is equivalent to Release, but also returns the item held by the actor (sprite), after
+		// releasing, which will be nil on success
+		ReleaseItem(ctx context.Context, sprite Sprite, target Sprite) (Sprite, error)
+
+		// WouldCollide will return a Sprite that the given sprite would collide with, were it positioned at the
+		// (visible / screen) position x and y, note that it must be called with a key from the Sprites map, and that
+		// which Sprite is returned is unspecified if there are multiple
+		WouldCollide(sprite Sprite, x, y int32) (Sprite, bool)
+
+		// Distance returns the shortest distance between the shapes of a and b (see Shape.Distance), as of a single
+		// point in time, note that it must be called with keys from the Sprites map, and that it will fail if either
+		// is deleted or not visible (e.g. held)
+		Distance(a, b Sprite) (float64, error)
+
+		// Snapshot renders the visible sprites into a grid of runes, indexed by row (y) then column (x), including
+		// a border (of runeExtra), i.e. it is State.SpaceHeight+2 by State.SpaceWidth+2, where empty cells are spaces
+		Snapshot() [][]rune
+
+		// SetPlanOverlay sets the text displayed for the given actor in the plan overlay, e.g. the plan's active
+		// action, replacing any previous text, note that it is a no-op unless Config.PlanOverlay is set
+		SetPlanOverlay(actor Sprite, text string)
+
+		// Pause stops the simulation ticking (i.e. nothing moves), until Resume is called, without stopping the
+		// handling of other events (e.g. keyboard input), note that it will block until received by Run (or ctx
+		// is done), and that, while paused, Move, Grasp, Release, etc, will be queued, and won't apply (or return)
+		// until resumed, consistent with their behavior between ticks
+		Pause(ctx context.Context) error
+
+		// Resume resumes ticking after Pause, note that it will block until received by Run (or ctx is done)
+		Resume(ctx context.Context) error
+
+		// Step advances the simulation by exactly one tick, independent of Config.Interval, intended for
+		// deterministic testing, note that it will fail if Run is active, and that any pending Move, Grasp,
+		// Release, etc, will be accepted (using ctx) prior to the tick, i.e. ctx should outlive them
+		Step(ctx context.Context) error
+
+		// SetInterval changes the tick interval (see Config.Interval), taking effect immediately if Run is active,
+		// in which case it will block until received by Run (or ctx is done)
+		SetInterval(ctx context.Context, d time.Duration) error
 	}
 
 	Config struct {
+		// Screen is required, see NewHeadless to run without one
 		Screen   tcell.Screen
 		Interval time.Duration // tick interval
 		Scenario string
+		// PlanOverlay enables displaying text (per actor) in the hud, see Simulation.SetPlanOverlay
+		PlanOverlay bool
+		// OnGoalReached is called once each time an actor's criteria become satisfied (every cube on its goal), from
+		// the simulation's loop (after the state has been updated), meaning it must not block on the simulation
+		OnGoalReached func(actor Actor)
+		// OnGoal is called once each time a cube (in an actor's criteria) is first placed on its goal, with the
+		// actual cube and goal (see CriteriaKey for wildcards), from the simulation's loop (after the state has been
+		// updated), meaning it must not block on the simulation
+		OnGoal func(actor Actor, cube Cube, goal Goal)
+		// OnCollision is called each time a sprite's (per tick) movement is reverted, as it would collide with another
+		// sprite, from the simulation's loop (after the state has been updated), meaning it must not block on the
+		// simulation, note that a and b are the moving and colliding sprites, respectively
+		OnCollision func(a, b Sprite)
+		// MovementMode constrains the directions sprites may move in, including via Simulation.Move
+		MovementMode MovementMode
+		// Rand is the source of all randomness (e.g. scenario layout), defaulting to one seeded from the current
+		// time, note that it must not be used by anything else, as it is not safe for concurrent use
+		Rand *rand.Rand
+		// InventorySize is the maximum number of items each actor may hold, as a stack (i.e. released in reverse
+		// order), defaulting to 1
+		InventorySize int
+		// Recorder will receive a recording of the simulation (JSON lines), of every input (e.g. Move, Grasp, key
+		// presses), and the outcome of each tick, sufficient to reconstruct it via Replay, note that any error
+		// writing to it will stop the simulation (returned by Run or Step)
+		Recorder io.Writer
+		// ExternalLogicTimeout limits how long each external call (e.g. Move) will wait for the simulation's loop to
+		// accept it, defaulting to 5 seconds plus the Interval
+		ExternalLogicTimeout time.Duration
+		// ValidateShapes is a debugging aid, that enables a check that each shape returned by NewSpriteShape has the
+		// requested size, which various logic assumes, panicking if it doesn't, e.g. to catch a custom factory
+		ValidateShapes bool
+		// cubes are created after the scenario, see HeadlessConfig.Cubes
+		cubes []HeadlessCube
 	}
 
 	Space struct {
@@ -85,15 +181,33 @@ type (
 
 	service struct {
 		*state
-		config            Config
-		model             *model
-		runMutex          sync.Mutex
-		running           int32
-		actions           bool
-		tickChan          <-chan time.Time
+		config   Config
+		display  display
+		model    *model
+		runMutex sync.Mutex
+		running  int32
+		actions  bool
+		tickChan <-chan time.Time
+		// ticker is only accessed by Run
+		ticker            *time.Ticker
 		keyChan           <-chan *tcell.EventKey
 		resizeChan        <-chan *tcell.EventResize
-		externalLogicChan chan externalLogic
+		mouseChan         <-chan *tcell.EventMouse
+		externalLogicChan chan externalLogicRequest
+		pauseChan         chan bool
+		intervalChan      chan time.Duration
+		// paused is only accessed by Run
+		paused bool
+		// mouseButtons are the buttons of the last mouse event, only accessed by Run, see mouse
+		mouseButtons tcell.ButtonMask
+		// ticks is the number of ticks so far, only accessed by Run or Step
+		ticks int
+		// recorder and recordErr are only accessed by Run or Step, see Config.Recorder
+		recorder     *json.Encoder
+		recordErr    error
+		overlayMu    sync.Mutex
+		overlay      map[*spriteModel]string
+		overlayDirty bool
 	}
 
 	update struct {
@@ -104,6 +218,14 @@ type (
 		Actions []func()
 		Redraw  bool
 		Lock    bool
+		// actors whose criteria became satisfied during this update
+		Reached []*actorModel
+		// criteria whose cube was placed on its goal during this update
+		Placed []criteriaPlacement
+		// pairs of (moving, colliding) sprites whose movement was reverted during this update
+		Collisions [][2]*spriteModel
+		// sprites whose position was modified by movement during this update
+		Moved []*spriteModel
 	}
 
 	model struct {
@@ -120,20 +242,48 @@ type (
 		Cubes []*cubeModel
 		// where the actor needs to take the target cube
 		Goals []*goalModel
+		// static obstacles, that never move
+		Walls []*wallModel
 		// executed each update once per tick until returns true
 		ExternalLogic []externalLogic
+		MovementMode  MovementMode
+		// Rand is the simulation's Config.Rand
+		Rand          *rand.Rand
+		InventorySize int
+		// ValidateShapes is the simulation's Config.ValidateShapes, see newSpriteShape
+		ValidateShapes bool
+		// layers are the distinct spriteModel.Layer values of the sprites in the model, ascending, see initSprite
+		layers []int
+		// index accelerates collisions, if non-nil, updated via update.updateSprite
+		index *spatialIndex
 	}
 
 	spriteModel struct {
-		X, Y          float64       // location (top left)
-		Width, Height int32         // size
-		DX, DY        float64       // direction + magnitude
-		Stop          bool          // skips movement but keeps direction / magnitude
-		Images        []spriteImage // image stack see also spriteImage
-		Image         []rune        // last image runes
-		Shape         Shape         // shape must be set if the sprite is visible and must be added to the space
-		Owner         any           // Owner is what this sprite is for
-		Space         Space         // flags indicating what it should collide with
+		X, Y          float64             // location (top left)
+		Width, Height int32               // size
+		DX, DY        float64             // direction + magnitude
+		Stop          bool                // skips movement but keeps direction / magnitude
+		Images        []spriteImage       // image stack see also spriteImage
+		Image         []rune              // last image runes
+		Shape         Shape               // shape must be set if the sprite is visible and must be added to the space
+		Owner         any                 // Owner is what this sprite is for
+		Space         Space               // flags indicating what it should collide with
+		Layer         int                 // draw / collision order, ahead of the owner's type, fixed once part of the model
+		Style         tcell.Style         // style of each cell, unless overridden by ImageStyles
+		ImageStyles   map[int]tcell.Style // last image styles, see spriteImage.Styles
+	}
+
+	// display is the subset of tcell.Screen used to render the simulation, where events will be polled only if it
+	// also implements eventPoller
+	display interface {
+		Size() (width, height int)
+		Clear()
+		SetContent(x int, y int, mainc rune, combc []rune, style tcell.Style)
+		Show()
+	}
+
+	eventPoller interface {
+		PollEvent() tcell.Event
 	}
 
 	spriteImage interface {
@@ -141,10 +291,17 @@ type (
 		Runes() []rune
 		// Expired indicates the image can be removed from the stack
 		Expired() bool
+		// Styles overrides the style of cells, keyed by index of Runes, and may be nil
+		Styles() map[int]tcell.Style
 	}
 
 	staticImage []rune
 
+	styledImage struct {
+		staticImage
+		styles map[int]tcell.Style
+	}
+
 	imageExpiry struct {
 		spriteImage
 		expired func() bool
@@ -154,7 +311,18 @@ type (
 		Sprite   *spriteModel
 		Criteria Criteria
 		Keyboard bool
-		HeldItem Sprite
+		// HeldItems is a stack, where the last item is on top (the only one that may be released)
+		HeldItems []Sprite
+		// Reached indicates the criteria were satisfied as of the last tick
+		Reached bool
+		// Placed indicates the cube of each criteria was on its goal as of the last tick
+		Placed map[CriteriaKey]bool
+	}
+
+	criteriaPlacement struct {
+		Actor *actorModel
+		Cube  *cubeModel
+		Goal  *goalModel
 	}
 
 	cubeModel struct {
@@ -165,8 +333,20 @@ type (
 		Sprite *spriteModel
 	}
 
+	wallModel struct {
+		Sprite *spriteModel
+	}
+
 	externalLogic func(ctx context.Context, u *update) bool
 
+	externalLogicRequest struct {
+		logic externalLogic
+		// accept will be called (by Run) with the context passed to logic, on receipt
+		accept func(ctx context.Context)
+		// record describes the request for Config.Recorder, if non-nil
+		record *recordRequest
+	}
+
 	scenarioValue struct {
 		init func(u *update)
 	}
@@ -186,6 +366,15 @@ var (
 	goalSpace = Space{
 		Floor: true,
 	}
+	wallSpace = Space{
+		Room: true,
+	}
+
+	// default styles, applied on creation, unless the sprite already has a style
+	actorStyle = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	goalStyle  = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	// heldStyle highlights the cell of an actor's image that shows its held item
+	heldStyle = tcell.StyleDefault.Reverse(true)
 
 	scenarioMap = map[string]scenarioValue{
 		scenarioStatic: {
@@ -325,17 +514,96 @@ var (
 				}
 			},
 		},
+		scenarioMultiActor: {
+			// two planning actors share one world, and both need to place the same cube on the same goal, and are
+			// (almost) equidistant from it, demonstrating conflict between (independent) plans, where the actor that loses the
+			// race for the cube will fail to refine it's plan (the cube isn't visible, while held), and re-plan, until
+			// the other actor places the cube, satisfying both
+			init: func(u *update) {
+				var sharedGoal Goal
+				if sprite, err := u.createSprite(48-hudWidth, 3, 9, 4, []rune(`!!!!!!!!!!!!GOAL!!!!!!!!!!!!!!!!!!!!`)); err != nil {
+					panic(err)
+				} else if goal, err := u.createGoal(sprite); err != nil {
+					panic(err)
+				} else {
+					sharedGoal = u.State.new(goal.Sprite, goal).(Goal)
+				}
+
+				var sharedCube Cube
+				if sprite, err := u.createSprite(51-hudWidth, 14, 1, 1, []rune(`1`)); err != nil {
+					panic(err)
+				} else if cube, err := u.createCube(sprite); err != nil {
+					panic(err)
+				} else {
+					sharedCube = u.State.new(cube.Sprite, cube).(Cube)
+				}
+
+				for _, x := range [...]float64{26 - hudWidth, 75 - hudWidth} {
+					if sprite, err := u.createSprite(x, 18, 3, 2, []rune(`0|00|0`)); err != nil {
+						panic(err)
+					} else if actor, err := u.createActor(sprite); err != nil {
+						panic(err)
+					} else {
+						u.PlanConfig.Actors = append(u.PlanConfig.Actors, u.State.new(actor.Sprite, actor).(Actor))
+						actor.Criteria[CriteriaKey{Cube: sharedCube, Goal: sharedGoal}] = CriteriaValue{}
+					}
+				}
+			},
+		},
+		scenarioAnyCube: {
+			// the actor's criteria is satisfied by placing either cube on the goal
+			init: func(u *update) {
+				if sprite, err := u.createSprite(30-hudWidth, 10, 3, 2, []rune(`0|00|0`)); err != nil {
+					panic(err)
+				} else if actor, err := u.createActor(sprite); err != nil {
+					panic(err)
+				} else {
+					u.PlanConfig.Actors = append(u.PlanConfig.Actors, u.State.new(actor.Sprite, actor).(Actor))
+
+					actor.Keyboard = true
+
+					if sprite, err := u.createSprite(77-hudWidth, 9, 3, 5, []rune(`!G!!O!!A!!L!!!!`)); err != nil {
+						panic(err)
+					} else if goal, err := u.createGoal(sprite); err != nil {
+						panic(err)
+					} else {
+						actor.Criteria[CriteriaKey{Goal: u.State.new(goal.Sprite, goal).(Goal)}] = CriteriaValue{}
+					}
+				}
+
+				if sprite, err := u.createSprite(60-hudWidth, 8, 1, 1, []rune(`1`)); err != nil {
+					panic(err)
+				} else if _, err := u.createCube(sprite); err != nil {
+					panic(err)
+				}
+				if sprite, err := u.createSprite(45-hudWidth, 16, 1, 1, []rune(`2`)); err != nil {
+					panic(err)
+				} else if _, err := u.createCube(sprite); err != nil {
+					panic(err)
+				}
+			},
+		},
 	}
 )
 
 var (
 	NewSpriteShape = newRectangle
+	NewCircle      = newCircle
+	NewPolygon     = newPolygon
+	// NewOrientedRectangle returns a rectangle, rotated by the given degrees, see Shape.Rotate
+	NewOrientedRectangle = newOrientedRectangle
 )
 
 func New(config Config) (Simulation, error) {
 	if config.Screen == nil {
 		return nil, fmt.Errorf(`nil screen`)
 	}
+	// supports click to move, see service.mouse
+	config.Screen.EnableMouse()
+	return newService(config, config.Screen)
+}
+
+func newService(config Config, display display) (*service, error) {
 	if config.Interval == 0 {
 		config.Interval = defaultInterval
 	}
@@ -348,38 +616,94 @@ func New(config Config) (Simulation, error) {
 	if _, ok := scenarioMap[config.Scenario]; !ok {
 		return nil, fmt.Errorf(`invalid scenario: %s`, config.Scenario)
 	}
+	if !config.MovementMode.valid() {
+		return nil, fmt.Errorf(`invalid movement mode: %s`, config.MovementMode)
+	}
+	if config.InventorySize == 0 {
+		config.InventorySize = 1
+	}
+	if config.InventorySize < 0 {
+		return nil, fmt.Errorf(`invalid inventory size: %d`, config.InventorySize)
+	}
+	if config.ExternalLogicTimeout == 0 {
+		config.ExternalLogicTimeout = time.Second*5 + config.Interval
+	}
+	if config.ExternalLogicTimeout < 0 {
+		return nil, fmt.Errorf(`invalid external logic timeout: %s`, config.ExternalLogicTimeout)
+	}
+	var seed *int64
+	if config.Rand == nil {
+		seed = new(int64)
+		*seed = time.Now().UnixNano()
+		config.Rand = rand.New(rand.NewSource(*seed))
+	}
 	svc := &service{
-		state: &state{
-			sprites: make(map[*spriteModel]*spriteModel),
-			actors:  make(map[*actorModel]*actorModel),
-			cubes:   make(map[*cubeModel]*cubeModel),
-			goals:   make(map[*goalModel]*goalModel),
-		},
+		state:             newState(),
 		config:            config,
+		display:           display,
 		actions:           true,
-		externalLogicChan: make(chan externalLogic),
+		externalLogicChan: make(chan externalLogicRequest),
+		pauseChan:         make(chan bool),
+		intervalChan:      make(chan time.Duration),
+	}
+	if config.Recorder != nil {
+		svc.recorder = json.NewEncoder(config.Recorder)
+		svc.record(recordEvent{
+			Op:        recordOpConfig,
+			Scenario:  config.Scenario,
+			Movement:  config.MovementMode.String(),
+			Inventory: config.InventorySize,
+			Seed:      seed,
+		})
+		if svc.recordErr != nil {
+			return nil, svc.recordErr
+		}
+	}
+	u, err := svc.init(config)
+	if err != nil {
+		return nil, err
 	}
-	svc.view(svc.init(config))
+	svc.view(u)
 	return svc, nil
 }
 
-func (s *service) init(config Config) (u update) {
+func (s *service) init(config Config) (u update, err error) {
 	u.model = &model{
-		State:    s.state,
-		Time:     time.Now(),
-		Interval: config.Interval,
+		State:         s.state,
+		Time:          time.Now(),
+		Interval:      config.Interval,
+		MovementMode:  config.MovementMode,
+		Rand:          config.Rand,
+		InventorySize: config.InventorySize,
+		index:         newSpatialIndex(),
 	}
-	u.Width, u.Height = sizeInt32(s.config.Screen.Size())
+	u.ValidateShapes = config.ValidateShapes
+	u.Width, u.Height = sizeInt32(s.display.Size())
 
 	// setup scenario
 	scenarioMap[config.Scenario].init(&u)
 
+	for _, v := range config.cubes {
+		var sprite *spriteModel
+		if sprite, err = u.createSprite(v.X, v.Y, 1, 1, []rune{v.Image}); err == nil {
+			_, err = u.createCube(sprite)
+		}
+		if err != nil {
+			return u, fmt.Errorf(`invalid cube %q at (%v, %v): %w`, v.Image, v.X, v.Y, err)
+		}
+	}
+
 	u.Redraw = true
 	u.Dirty = false
 	u.Lock = true
 
 	// plan config will be setup by scenario init
-	u.Actions = append(u.Actions, func() { u.State.plan = u.PlanConfig })
+	u.Actions = append(u.Actions, func() {
+		u.State.next.plan = u.PlanConfig
+		u.State.next.movement = u.MovementMode
+		u.State.next.inventory = u.InventorySize
+		u.State.next.validateShapes = u.ValidateShapes
+	})
 	return
 }
 func (s *service) view(u update) {
@@ -389,14 +713,35 @@ func (s *service) view(u update) {
 			if u.Lock {
 				s.state.mu.Lock()
 				defer s.state.mu.Unlock()
+				s.state.begin()
+				defer s.state.commit()
 			}
 			for _, action := range u.Actions {
 				action()
 			}
 		}()
 	}
+	if s.config.OnGoalReached != nil {
+		for _, actor := range u.Reached {
+			s.config.OnGoalReached(s.state.new(actor.Sprite, actor).(Actor))
+		}
+	}
+	if s.config.OnGoal != nil {
+		for _, v := range u.Placed {
+			s.config.OnGoal(
+				s.state.new(v.Actor.Sprite, v.Actor).(Actor),
+				s.state.new(v.Cube.Sprite, v.Cube).(Cube),
+				s.state.new(v.Goal.Sprite, v.Goal).(Goal),
+			)
+		}
+	}
+	if s.config.OnCollision != nil {
+		for _, pair := range u.Collisions {
+			s.config.OnCollision(s.state.new(pair[0], pair[0].Owner), s.state.new(pair[1], pair[1].Owner))
+		}
+	}
 	if u.Redraw {
-		s.config.Screen.Clear()
+		s.display.Clear()
 
 		// draw border (fills everything outside the scene with runeExtra)
 		{
@@ -408,21 +753,21 @@ func (s *service) view(u update) {
 			if extraWidth {
 				for y := int32(0); y < u.Height && y < baseHeight; y++ {
 					for x := int32(baseWidth); x < u.Width; x++ {
-						s.config.Screen.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
+						s.display.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
 					}
 				}
 			}
 			if extraHeight {
 				for x := int32(0); x < u.Width && x < baseWidth; x++ {
 					for y := int32(baseHeight); y < u.Height; y++ {
-						s.config.Screen.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
+						s.display.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
 					}
 				}
 			}
 			if extraWidth && extraHeight {
 				for x := int32(baseWidth); x < u.Width; x++ {
 					for y := int32(baseHeight); y < u.Height; y++ {
-						s.config.Screen.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
+						s.display.SetContent(int(x), int(y), runeExtra, nil, tcell.StyleDefault)
 					}
 				}
 			}
@@ -439,13 +784,17 @@ func (s *service) view(u update) {
 		// terrible hud
 		{
 			for y := int32(0); y < hudHeight; y++ {
-				s.config.Screen.SetContent(hudWidth-1, int(y), '|', nil, tcell.StyleDefault)
+				s.display.SetContent(hudWidth-1, int(y), '|', nil, tcell.StyleDefault)
 			}
-			for y, line := range strings.Split(fmt.Sprintf(
+			hud := fmt.Sprintf(
 				"%s\n\n%s",
 				infoText,
 				u.statusPane(),
-			), "\n") {
+			)
+			if s.config.PlanOverlay {
+				hud += "\n" + string(s.planPane(u.model))
+			}
+			for y, line := range strings.Split(hud, "\n") {
 				if y >= hudHeight {
 					break
 				}
@@ -453,79 +802,130 @@ func (s *service) view(u update) {
 					if x >= hudWidth-1 {
 						break
 					}
-					s.config.Screen.SetContent(x, y, v, nil, tcell.StyleDefault)
+					s.display.SetContent(x, y, v, nil, tcell.StyleDefault)
 				}
 			}
 		}
 
-		s.config.Screen.Show()
+		s.display.Show()
 	}
 }
-func (s *service) drawSprite(sprite *spriteModel) { sprite.draw(s.config.Screen.SetContent) }
+func (s *service) drawSprite(sprite *spriteModel) { sprite.draw(s.display.SetContent) }
 func (s *service) update(ctx context.Context) (u update) {
 	u.model = s.model
+	tickChan := s.tickChan
+	if s.paused {
+		tickChan = nil
+	}
 	select {
 	case <-ctx.Done():
-	case u.Time = <-s.tickChan:
-		u.ExternalLogic = u.externalLogic(ctx)
-		u.move()
-		if u.Dirty {
-			u.Redraw = true
-			u.Dirty = false
-		}
+	case u.Time = <-tickChan:
+		s.tick(ctx, &u)
 	case event := <-s.keyChan:
-		switch event.Key() {
-		case tcell.KeyCtrlC:
-			u.Actions = append(u.Actions, func() { atomic.StoreInt32(&s.running, 0) })
-		case tcell.KeyUp:
-			u.controlActorsKeyboard(true, 0, -stepDistance)
-		case tcell.KeyDown:
-			u.controlActorsKeyboard(true, 0, stepDistance)
-		case tcell.KeyLeft:
-			u.controlActorsKeyboard(true, -stepDistance, 0)
-		case tcell.KeyRight:
-			u.controlActorsKeyboard(true, stepDistance, 0)
-		case tcell.KeyRune:
-			switch event.Rune() {
-			case 'w':
-				u.controlActorsKeyboard(false, 0, -stepDistance)
-			case 's':
-				u.controlActorsKeyboard(false, 0, stepDistance)
-			case 'a':
-				u.controlActorsKeyboard(false, -stepDistance, 0)
-			case 'd':
-				u.controlActorsKeyboard(false, stepDistance, 0)
-			case ' ':
-				u.toggleStopActorsKeyboard()
-			case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-				for _, cube := range s.model.Cubes {
-					if sprite := cube.sprite(); sprite.visible() && sprite.Images[0].Runes()[0] == event.Rune() {
-						if u.graspItemActorKeyboard(sprite) {
-							continue
-						}
+		s.record(recordEvent{Tick: s.ticks, Op: recordOpKey, Key: int(event.Key()), Rune: event.Rune(), Mod: int(event.Modifiers())})
+		s.key(&u, event)
+	case event := <-s.resizeChan:
+		w, h := sizeInt32(event.Size())
+		s.record(recordEvent{Tick: s.ticks, Op: recordOpResize, Width: w, Height: h})
+		u.resize(w, h)
+	case event := <-s.mouseChan:
+		s.mouse(ctx, &u, event)
+	case req := <-s.externalLogicChan:
+		if req.record != nil {
+			s.recordRequest(u.model, req.record)
+		}
+		req.accept(ctx)
+		u.ExternalLogic = append(u.ExternalLogic, req.logic)
+	case s.paused = <-s.pauseChan:
+	case u.Interval = <-s.intervalChan:
+		s.ticker.Reset(u.Interval)
+	}
+	u.refreshImages()
+	return
+}
+func (s *service) key(u *update, event *tcell.EventKey) {
+	switch event.Key() {
+	case tcell.KeyCtrlC:
+		u.Actions = append(u.Actions, func() { atomic.StoreInt32(&s.running, 0) })
+	case tcell.KeyUp:
+		u.controlActorsKeyboard(true, 0, -stepDistance)
+	case tcell.KeyDown:
+		u.controlActorsKeyboard(true, 0, stepDistance)
+	case tcell.KeyLeft:
+		u.controlActorsKeyboard(true, -stepDistance, 0)
+	case tcell.KeyRight:
+		u.controlActorsKeyboard(true, stepDistance, 0)
+	case tcell.KeyRune:
+		switch event.Rune() {
+		case 'w':
+			u.controlActorsKeyboard(false, 0, -stepDistance)
+		case 's':
+			u.controlActorsKeyboard(false, 0, stepDistance)
+		case 'a':
+			u.controlActorsKeyboard(false, -stepDistance, 0)
+		case 'd':
+			u.controlActorsKeyboard(false, stepDistance, 0)
+		case ' ':
+			u.toggleStopActorsKeyboard()
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			for _, cube := range s.model.Cubes {
+				if sprite := cube.sprite(); sprite.visible() && sprite.Images[0].Runes()[0] == event.Rune() {
+					if u.graspItemActorKeyboard(sprite) {
+						continue
 					}
 				}
-			case 'r':
-				u.releaseHeldItemActorsKeyboard()
 			}
+		case 'r':
+			u.releaseHeldItemActorsKeyboard()
 		}
-	case event := <-s.resizeChan:
-		if w, h := sizeInt32(event.Size()); w != u.Width || h != u.Height {
-			u.Width, u.Height = w, h
+	}
+}
+
+// mouse moves the keyboard controlled actor(s) to the cell that was left-clicked, using Move, which will be
+// interrupted by any subsequent click or keyboard control
+func (s *service) mouse(ctx context.Context, u *update, event *tcell.EventMouse) {
+	buttons := event.Buttons()
+	clicked := buttons&tcell.Button1 != 0 && s.mouseButtons&tcell.Button1 == 0
+	s.mouseButtons = buttons
+	if !clicked {
+		return
+	}
+	sx, sy := event.Position()
+	x, y := float64(sx-hudWidth), float64(sy)
+	if x < 0 || x >= spaceWidth || y < 0 || y >= spaceHeight {
+		return
+	}
+	for _, actor := range u.Actors {
+		sprite := actor.sprite()
+		if !actorFilterKeyboard(actor) || !sprite.visible() {
+			continue
+		}
+		target := u.State.new(sprite, actor)
+		x, y := math.Min(x, spaceWidth-float64(sprite.Width)), math.Min(y, spaceHeight-float64(sprite.Height))
+		// Move must be called asynchronously, as it's handled by the update loop
+		go func() { _ = s.Move(ctx, target, x, y) }()
+	}
+}
+func (s *service) tick(ctx context.Context, u *update) {
+	u.ExternalLogic = u.externalLogic(ctx)
+	u.move()
+	u.checkCriteria()
+	s.ticks++
+	if u.Lock {
+		s.recordTick(u)
+	}
+	if s.config.PlanOverlay {
+		s.overlayMu.Lock()
+		if s.overlayDirty {
 			u.Dirty = true
+			s.overlayDirty = false
 		}
-	case fn := <-s.externalLogicChan:
-		u.ExternalLogic = append(u.ExternalLogic, fn)
+		s.overlayMu.Unlock()
 	}
-	if u.Redraw {
-		u.sprites(false, func(sprite *spriteModel) bool {
-			if sprite.visible() {
-				sprite.Image = sprite.image().Runes()
-			}
-			return true
-		})
+	if u.Dirty {
+		u.Redraw = true
+		u.Dirty = false
 	}
-	return
 }
 func (s *service) Run(ctx context.Context) error {
 	s.runMutex.Lock()
@@ -543,36 +943,78 @@ func (s *service) Run(ctx context.Context) error {
 			return err
 		}
 		s.view(s.update(ctx))
+		if s.recordErr != nil {
+			return s.recordErr
+		}
 	}
 	return nil
 }
+func (s *service) Step(ctx context.Context) error {
+	if !s.runMutex.TryLock() {
+		return fmt.Errorf(`simulation is running`)
+	}
+	defer s.runMutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u := update{model: s.model}
+	for pending := true; pending; {
+		select {
+		case req := <-s.externalLogicChan:
+			if req.record != nil {
+				s.recordRequest(u.model, req.record)
+			}
+			req.accept(ctx)
+			u.ExternalLogic = append(u.ExternalLogic, req.logic)
+		default:
+			pending = false
+		}
+	}
+	s.step(ctx, u)
+	return s.recordErr
+}
+func (s *service) step(ctx context.Context, u update) {
+	u.Time = u.Time.Add(u.Interval)
+	s.tick(ctx, &u)
+	u.refreshImages()
+	s.view(u)
+}
 func (s *service) startTicker(ctx context.Context) {
 	ticker := time.NewTicker(s.model.Interval)
 	go func() {
 		<-ctx.Done()
 		ticker.Stop()
 	}()
+	s.ticker = ticker
 	s.tickChan = ticker.C
 }
 func (s *service) startEventLoop(ctx context.Context) {
+	poller, ok := s.display.(eventPoller)
+	if !ok {
+		return
+	}
 	var (
 		keyChan    = make(chan *tcell.EventKey)
 		resizeChan = make(chan *tcell.EventResize)
+		mouseChan  = make(chan *tcell.EventMouse)
 	)
 	go eventLoop(
 		ctx,
-		s.config.Screen.PollEvent,
+		poller.PollEvent,
 		keyChan,
 		resizeChan,
+		mouseChan,
 	)
 	s.keyChan = keyChan
 	s.resizeChan = resizeChan
+	s.mouseChan = mouseChan
 }
 func eventLoop(
 	ctx context.Context,
 	poll func() tcell.Event,
 	keyChan chan<- *tcell.EventKey,
 	resizeChan chan<- *tcell.EventResize,
+	mouseChan chan<- *tcell.EventMouse,
 ) {
 	var (
 		event tcell.Event
@@ -598,10 +1040,16 @@ func eventLoop(
 				return
 			case resizeChan <- event:
 			}
+		case *tcell.EventMouse:
+			select {
+			case <-ctx.Done():
+				return
+			case mouseChan <- event:
+			}
 		}
 	}
 }
-func (s *service) externalLogic(ctx context.Context, fn func(ctx context.Context, u *update) bool) (err error) {
+func (s *service) externalLogic(ctx context.Context, record *recordRequest, fn func(ctx context.Context, u *update) bool) (err error) {
 	err = ctx.Err()
 	if err != nil {
 		return
@@ -624,26 +1072,25 @@ func (s *service) externalLogic(ctx context.Context, fn func(ctx context.Context
 			close(done)
 			return true
 		}
-		logic externalLogic = func(c context.Context, u *update) bool {
-			select {
-			case <-ready:
-			default:
+		req = externalLogicRequest{
+			logic: func(c context.Context, u *update) bool { return call(u) },
+			accept: func(c context.Context) {
 				runCtx = c
 				close(ready)
-			}
-			return call(u)
+			},
+			record: record,
 		}
 	)
 
 	// wait for runCtx
 	func() {
-		ctx, cancel := context.WithTimeout(ctx, time.Second*5+s.config.Interval)
+		ctx, cancel := context.WithTimeout(ctx, s.config.ExternalLogicTimeout)
 		defer cancel()
 		select {
 		case <-ctx.Done():
 			err = ctx.Err()
 			return
-		case s.externalLogicChan <- logic:
+		case s.externalLogicChan <- req:
 		}
 		select {
 		case <-ctx.Done():
@@ -666,37 +1113,155 @@ func (s *service) externalLogic(ctx context.Context, fn func(ctx context.Context
 
 	return
 }
+func (s *service) Pause(ctx context.Context) error  { return s.setPaused(ctx, true) }
+func (s *service) Resume(ctx context.Context) error { return s.setPaused(ctx, false) }
+func (s *service) setPaused(ctx context.Context, paused bool) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.pauseChan <- paused:
+		return nil
+	}
+}
+func (s *service) SetInterval(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf(`invalid interval: %s`, d)
+	}
+	if s.runMutex.TryLock() {
+		defer s.runMutex.Unlock()
+		s.model.Interval = d
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s.intervalChan <- d:
+		return nil
+	}
+}
 func (s *service) Move(ctx context.Context, sprite Sprite, x, y float64) error {
+	return s.move(ctx, &recordRequest{op: recordOpMove, sprite: sprite, x: x, y: y}, sprite, func(*spriteModel) (float64, float64) { return x, y })
+}
+func (s *service) MoveBy(ctx context.Context, sprite Sprite, dx, dy float64) error {
+	return s.move(ctx, &recordRequest{op: recordOpMoveBy, sprite: sprite, x: dx, y: dy}, sprite, func(sprite *spriteModel) (float64, float64) { return sprite.X + dx, sprite.Y + dy })
+}
+func (s *service) MoveAll(ctx context.Context, targets map[Sprite][2]float64) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	type entry struct {
+		sprite Sprite
+		id     int
+		mover  func(u *update) (done bool, err error)
+		done   bool
+	}
+	var (
+		entries = make([]*entry, 0, len(targets))
+		err     error
+		init    bool
+	)
+	for sprite, target := range targets {
+		entries = append(entries, &entry{
+			sprite: sprite,
+			mover:  newMover(sprite, func(*spriteModel) (float64, float64) { return target[0], target[1] }),
+		})
+	}
+	if e := s.externalLogic(ctx, &recordRequest{op: recordOpMoveAll, targets: targets}, func(ctx context.Context, u *update) bool {
+		if !init {
+			// consistent order, e.g. for Replay
+			for _, v := range entries {
+				v.id = u.spriteID(spriteModelOf(v.sprite))
+			}
+			slices.SortFunc(entries, func(a, b *entry) int { return cmp.Compare(a.id, b.id) })
+			init = true
+		}
+		var remaining bool
+		for _, v := range entries {
+			if v.done {
+				continue
+			}
+			if v.done, err = v.mover(u); err != nil {
+				// the remaining sprites would otherwise continue past their targets
+				for _, v := range entries {
+					if sprite := spriteModelOf(v.sprite); !v.done && u.spriteExists(sprite) {
+						u.setStop(sprite, true)
+					}
+				}
+				return true
+			}
+			if !v.done {
+				remaining = true
+			}
+		}
+		return !remaining
+	}); e != nil {
+		// the logic may still be running, e.g. if the context was canceled
+		return e
+	}
+	return err
+}
+func (s *service) move(ctx context.Context, record *recordRequest, sprite Sprite, target func(sprite *spriteModel) (x, y float64)) error {
+	var (
+		mover = newMover(sprite, target)
+		err   error
+	)
+	if e := s.externalLogic(ctx, record, func(ctx context.Context, u *update) (done bool) {
+		done, err = mover(u)
+		return
+	}); e != nil {
+		// the logic may still be running, e.g. if the context was canceled
+		return e
+	}
+	return err
+}
+
+// newMover returns the per-tick logic of a Move, which returns true once the move is done, and any error
+func newMover(sprite Sprite, target func(sprite *spriteModel) (x, y float64)) func(u *update) (bool, error) {
 	const (
 		delta = 0.1
 	)
 	var (
-		equal  = func(x2, y2 float64) bool { return math.Abs(x-x2) <= delta && math.Abs(y-y2) <= delta }
-		err    error
-		shadow *spriteModel
+		x, y      float64
+		waypoints [][2]float64
+		equal     = func(x2, y2 float64) bool { return math.Abs(x-x2) <= delta && math.Abs(y-y2) <= delta }
+		shadow    *spriteModel
+		init      bool
 	)
-	if e := s.externalLogic(ctx, func(ctx context.Context, u *update) bool {
+	return func(u *update) (bool, error) {
 		sprite := sprite.sprite()
 		if !u.spriteExists(sprite) {
-			err = fmt.Errorf(`sprite not found`)
-			return true
+			return true, fmt.Errorf(`sprite not found`)
+		}
+		if _, ok := sprite.Owner.(*wallModel); ok {
+			return true, fmt.Errorf(`sprite not movable`)
+		}
+		if !init {
+			x, y = target(sprite)
+			waypoints = u.MovementMode.waypoints(sprite.X, sprite.Y, x, y)
+			init = true
 		}
 		if x < 0 || x > spaceWidth-float64(sprite.Width) || y < 0 || y > spaceHeight-float64(sprite.Height) {
-			err = fmt.Errorf(`target position invalid: %v, %v`, x, y)
-			return true
+			return true, fmt.Errorf(`target position invalid: %v, %v`, x, y)
 		}
 		if !sprite.visible() {
-			err = fmt.Errorf(`sprite not visible`)
-			return true
+			return true, fmt.Errorf(`sprite not visible`)
+		}
+		for len(waypoints) > 1 && math.Abs(waypoints[0][0]-sprite.X) <= delta && math.Abs(waypoints[0][1]-sprite.Y) <= delta {
+			// reached an intermediate position, the velocity will be recalculated (as if starting a new move)
+			waypoints = waypoints[1:]
+			shadow = nil
 		}
 		if equal(sprite.X, sprite.Y) {
-			sprite.Stop = true
-			return true
+			if !sprite.Stop {
+				sprite.Stop = true
+				u.updateSprite(sprite)
+				u.Dirty = true
+			}
+			return true, nil
 		}
 		var interrupted bool
 		if shadow == nil {
-			d := calcDistance(sprite.X, sprite.Y, x, y)
-			sprite.DX, sprite.DY = (x-sprite.X)/d*stepDistance, (y-sprite.Y)/d*stepDistance
+			sprite.DX, sprite.DY = u.MovementMode.velocity(waypoints[0][0]-sprite.X, waypoints[0][1]-sprite.Y)
 			sprite.Stop = false
 			shadow = sprite.clone()
 			shadow.Space = Space{}
@@ -715,28 +1280,60 @@ func (s *service) Move(ctx context.Context, sprite Sprite, x, y float64) error {
 			}
 		}
 		if interrupted {
-			err = fmt.Errorf("sprite movement interrupted")
-			return true
+			return true, fmt.Errorf("sprite movement interrupted")
 		}
-		return false
-	}); err == nil {
-		return e
+		return false, nil
 	}
-	return err
 }
 func (s *service) Grasp(ctx context.Context, sprite Sprite, target Sprite) error {
-	return s.actionActorCube(ctx, sprite, target, (*update).graspItem)
+	_, err := s.GraspItem(ctx, sprite, target)
+	return err
 }
 func (s *service) Release(ctx context.Context, sprite Sprite, target Sprite) error {
-	return s.actionActorCube(ctx, sprite, target, (*update).releaseItem)
+	_, err := s.ReleaseItem(ctx, sprite, target)
+	return err
 }
-func (s *service) actionActorCube(ctx context.Context, sprite Sprite, target Sprite, action func(*update, *actorModel, *spriteModel) bool) error {
+func (s *service) GraspItem(ctx context.Context, sprite Sprite, target Sprite) (Sprite, error) {
+	return s.actionActorCube(ctx, &recordRequest{op: recordOpGrasp, sprite: sprite, target: target}, sprite, target, (*update).graspItem)
+}
+func (s *service) ReleaseItem(ctx context.Context, sprite Sprite, target Sprite) (Sprite, error) {
+	return s.actionActorCube(ctx, &recordRequest{op: recordOpRelease, sprite: sprite, target: target}, sprite, target, (*update).releaseItem)
+}
+func (s *service) SetPlanOverlay(actor Sprite, text string) {
+	if !s.config.PlanOverlay {
+		return
+	}
+	sprite := actor.sprite()
+	s.overlayMu.Lock()
+	defer s.overlayMu.Unlock()
+	if v, ok := s.overlay[sprite]; ok && v == text {
+		return
+	}
+	if s.overlay == nil {
+		s.overlay = make(map[*spriteModel]string)
+	}
+	s.overlay[sprite] = text
+	s.overlayDirty = true
+}
+func (s *service) planPane(m *model) (b []byte) {
+	s.overlayMu.Lock()
+	defer s.overlayMu.Unlock()
+	b = append(b, "PLAN STATUS\n"...)
+	for i, actor := range m.Actors {
+		if text, ok := s.overlay[actor.sprite()]; ok {
+			b = append(b, fmt.Sprintf("%d.plan = %s\n", i, text)...)
+		}
+	}
+	return
+}
+func (s *service) actionActorCube(ctx context.Context, record *recordRequest, sprite Sprite, target Sprite, action func(*update, *actorModel, *spriteModel) bool) (Sprite, error) {
 	var (
-		sm  = sprite.sprite()
-		tm  = target.sprite()
-		err error
+		sm   = sprite.sprite()
+		tm   = target.sprite()
+		held Sprite
+		err  error
 	)
-	if e := s.externalLogic(ctx, func(ctx context.Context, u *update) bool {
+	if e := s.externalLogic(ctx, record, func(ctx context.Context, u *update) bool {
 		{
 			search := map[*spriteModel]struct{}{sm: {}, tm: {}}
 			u.sprites(false, func(sprite *spriteModel) bool {
@@ -767,14 +1364,24 @@ func (s *service) actionActorCube(ctx context.Context, sprite Sprite, target Spr
 			return true
 		}
 
+		held = actor.heldItem()
+
 		return true
-	}); err == nil {
-		return e
+	}); e != nil {
+		return nil, e
+	} else if err != nil {
+		return nil, err
 	}
-	return err
+	return held, nil
 }
 
 func (u *update) createSprite(x, y float64, width, height int32, runes []rune) (*spriteModel, error) {
+	return u.createLayeredSprite(0, x, y, width, height, runes)
+}
+
+// createLayeredSprite is createSprite with a layer, where sprites in higher layers are drawn over (and take priority
+// in collisions with) sprites in lower ones, regardless of type
+func (u *update) createLayeredSprite(layer int, x, y float64, width, height int32, runes []rune) (*spriteModel, error) {
 	vx, vy := RoundPosition(x, y)
 	if err := validateSprite(vx, vy, width, height, runes); err != nil {
 		return nil, err
@@ -787,15 +1394,19 @@ func (u *update) createSprite(x, y float64, width, height int32, runes []rune) (
 		Images: []spriteImage{
 			append(staticImage(nil), runes...),
 		},
+		Layer: layer,
 	}
-	sprite.Shape = sprite.shapeAt(vx, vy)
-	sprite.Image = sprite.image().Runes()
+	sprite.Shape = sprite.shapeAt(vx, vy, u.ValidateShapes)
+	sprite.refreshImage()
 	u.updateSprite(sprite)
 	return sprite, nil
 }
 func (u *update) updateSprite(sprite *spriteModel) {
+	if u.index != nil {
+		u.index.update(sprite)
+	}
 	u.Lock = true
-	u.Actions = append(u.Actions, func() { u.State.sprites[sprite] = sprite.clone() })
+	u.Actions = append(u.Actions, func() { u.State.next.sprites[sprite] = sprite.clone() })
 }
 func (u *update) initSprite(sprite *spriteModel, owner any, space Space) error {
 	if sprite.Owner != nil || sprite.Space != (Space{}) {
@@ -807,6 +1418,9 @@ func (u *update) initSprite(sprite *spriteModel, owner any, space Space) error {
 		return fmt.Errorf(`invalid coordinates: collides with other sprite(s)`)
 	}
 	sprite.Owner = owner
+	if i, ok := slices.BinarySearch(u.layers, sprite.Layer); !ok {
+		u.layers = slices.Insert(u.layers, i, sprite.Layer)
+	}
 	u.updateSprite(sprite)
 	u.Dirty = true
 	return nil
@@ -818,12 +1432,14 @@ func (u *update) reposition(sprite *spriteModel, x, y float64) error {
 	}
 	{
 		old := sprite.Shape
-		sprite.Shape = sprite.shapeAt(vx, vy)
+		sprite.Shape = sprite.shapeAt(vx, vy, u.ValidateShapes)
 		if u.collides(sprite) {
 			sprite.Shape = old
 			return fmt.Errorf(`invalid coordinates: collides with other sprite(s)`)
 		}
 	}
+	// the location must match the shape, e.g. for a subsequent move
+	sprite.X, sprite.Y = float64(vx), float64(vy)
 	u.updateSprite(sprite)
 	u.Dirty = true
 	return nil
@@ -861,6 +1477,9 @@ func (u *update) createActor(sprite *spriteModel) (*actorModel, error) {
 		Sprite:   sprite,
 		Criteria: make(Criteria),
 	}
+	if sprite.Style == tcell.StyleDefault {
+		sprite.Style = actorStyle
+	}
 	if err := u.initSprite(sprite, actor, actorSpace); err != nil {
 		return nil, err
 	}
@@ -870,12 +1489,15 @@ func (u *update) createActor(sprite *spriteModel) (*actorModel, error) {
 }
 func (u *update) updateActor(actor *actorModel) {
 	u.Lock = true
-	u.Actions = append(u.Actions, func() { u.State.actors[actor] = actor.clone() })
+	u.Actions = append(u.Actions, func() { u.State.next.actors[actor] = actor.clone() })
 }
 func (u *update) createGoal(sprite *spriteModel) (*goalModel, error) {
 	goal := &goalModel{
 		Sprite: sprite,
 	}
+	if sprite.Style == tcell.StyleDefault {
+		sprite.Style = goalStyle
+	}
 	if err := u.initSprite(sprite, goal, goalSpace); err != nil {
 		return nil, err
 	}
@@ -885,7 +1507,32 @@ func (u *update) createGoal(sprite *spriteModel) (*goalModel, error) {
 }
 func (u *update) updateGoal(goal *goalModel) {
 	u.Lock = true
-	u.Actions = append(u.Actions, func() { u.State.goals[goal] = goal.clone() })
+	u.Actions = append(u.Actions, func() { u.State.next.goals[goal] = goal.clone() })
+}
+func (u *update) createWall(x, y float64, width, height int32) (*wallModel, error) {
+	runes := make([]rune, width*height)
+	for i := range runes {
+		runes[i] = runeWall
+	}
+	sprite, err := u.createSprite(x, y, width, height, runes)
+	if err != nil {
+		return nil, err
+	}
+	wall := &wallModel{
+		Sprite: sprite,
+	}
+	if err := u.initSprite(sprite, wall, wallSpace); err != nil {
+		// unpublish the sprite (createSprite updated it)
+		u.Actions = append(u.Actions, func() { delete(u.State.next.sprites, sprite) })
+		return nil, err
+	}
+	u.Walls = append(u.Walls, wall)
+	u.updateWall(wall)
+	return wall, nil
+}
+func (u *update) updateWall(wall *wallModel) {
+	u.Lock = true
+	u.Actions = append(u.Actions, func() { u.State.next.walls[wall] = wall.clone() })
 }
 func (u *update) createCube(sprite *spriteModel) (*cubeModel, error) {
 	cube := &cubeModel{
@@ -900,14 +1547,15 @@ func (u *update) createCube(sprite *spriteModel) (*cubeModel, error) {
 }
 func (u *update) updateCube(cube *cubeModel) {
 	u.Lock = true
-	u.Actions = append(u.Actions, func() { u.State.cubes[cube] = cube.clone() })
+	u.Actions = append(u.Actions, func() { u.State.next.cubes[cube] = cube.clone() })
 }
 func (u *update) move() {
 	u.sprites(false, func(sprite *spriteModel) bool {
 		if sprite.visible() {
-			moved, modified := sprite.move(u.collides)
+			moved, modified := sprite.move(u.collidesMoving)
 			if modified {
 				u.updateSprite(sprite)
+				u.Moved = append(u.Moved, sprite)
 			}
 			if moved {
 				u.Dirty = true
@@ -915,6 +1563,49 @@ func (u *update) move() {
 		}
 		return true
 	})
+	u.checkGoals()
+}
+func (u *update) resize(w, h int32) {
+	if w != u.Width || h != u.Height {
+		u.Width, u.Height = w, h
+		u.Dirty = true
+	}
+}
+func (u *update) refreshImages() {
+	if u.Redraw {
+		u.sprites(false, func(sprite *spriteModel) bool {
+			if sprite.visible() {
+				sprite.refreshImage()
+			}
+			return true
+		})
+	}
+}
+func (u *update) checkCriteria() {
+	for _, actor := range u.Actors {
+		if reached := u.satisfied(actor); reached != actor.Reached {
+			actor.Reached = reached
+			u.updateActor(actor)
+			if reached {
+				u.Reached = append(u.Reached, actor)
+			}
+		}
+	}
+}
+func (u *update) checkGoals() {
+	for _, actor := range u.Actors {
+		for key := range actor.Criteria {
+			if cube, goal, placed := u.placement(key); placed != actor.Placed[key] {
+				if actor.Placed == nil {
+					actor.Placed = make(map[CriteriaKey]bool)
+				}
+				actor.Placed[key] = placed
+				if placed {
+					u.Placed = append(u.Placed, criteriaPlacement{Actor: actor, Cube: cube, Goal: goal})
+				}
+			}
+		}
+	}
 }
 func (u *update) externalLogic(ctx context.Context) (remaining []externalLogic) {
 	for _, fn := range u.ExternalLogic {
@@ -925,6 +1616,9 @@ func (u *update) externalLogic(ctx context.Context) (remaining []externalLogic)
 	return
 }
 func (u *update) controlActors(force bool, dx, dy float64, filter func(actor *actorModel) bool) {
+	if !u.MovementMode.allows(dx, dy) {
+		return
+	}
 	for _, actor := range u.Actors {
 		if filter(actor) {
 			u.control(actor.sprite(), force, dx, dy)
@@ -948,8 +1642,8 @@ func (u *update) graspItemActor(sprite *spriteModel, filter func(actor *actorMod
 }
 func (u *update) releaseHeldItemActors(filter func(actor *actorModel) bool) {
 	for _, actor := range u.Actors {
-		if filter(actor) && actor.HeldItem != nil {
-			u.releaseItem(actor, actor.HeldItem.sprite())
+		if held := actor.heldItem(); filter(actor) && held != nil {
+			u.releaseItem(actor, held.sprite())
 		}
 	}
 }
@@ -964,12 +1658,12 @@ func (u *update) releaseHeldItemActorsKeyboard() {
 	u.releaseHeldItemActors(actorFilterKeyboard)
 }
 func (u *update) graspItem(actor *actorModel, sprite *spriteModel) bool {
-	if actor.HeldItem != nil || !sprite.visible() || len(sprite.Images) != 1 {
+	if len(actor.HeldItems) >= u.InventorySize || !sprite.visible() || len(sprite.Images) != 1 {
 		return false
 	}
 
 	actorSprite := actor.sprite()
-	if !actorSprite.visible() || len(actorSprite.Images) != 1 {
+	if !actorSprite.visible() || len(actorSprite.Images) == 0 {
 		return false
 	}
 
@@ -982,10 +1676,13 @@ func (u *update) graspItem(actor *actorModel, sprite *spriteModel) bool {
 
 	{
 		cs := u.State.new(sprite, sprite.Owner)
-		actor.HeldItem = cs
+		actor.HeldItems = append(actor.HeldItems, cs)
 		actorSprite.Images = append(actorSprite.Images, imageExpiry{
-			spriteImage: actorImage,
-			expired:     func() bool { return actor.HeldItem != cs },
+			spriteImage: styledImage{
+				staticImage: actorImage,
+				styles:      map[int]tcell.Style{int(actorSprite.Width) / 2: heldStyle},
+			},
+			expired: func() bool { return !actor.holds(cs) },
 		})
 	}
 	sprite.Shape = nil
@@ -997,7 +1694,7 @@ func (u *update) graspItem(actor *actorModel, sprite *spriteModel) bool {
 	return true
 }
 func (u *update) releaseItem(actor *actorModel, sprite *spriteModel) bool {
-	if actor.HeldItem != u.State.new(sprite, sprite.Owner) {
+	if actor.heldItem() != u.State.new(sprite, sprite.Owner) {
 		return false
 	}
 
@@ -1014,7 +1711,8 @@ func (u *update) releaseItem(actor *actorModel, sprite *spriteModel) bool {
 		}
 	}
 
-	actor.HeldItem = nil
+	actor.HeldItems[len(actor.HeldItems)-1] = nil
+	actor.HeldItems = actor.HeldItems[:len(actor.HeldItems)-1]
 
 	u.updateActor(actor)
 	u.updateSprite(actorSprite)
@@ -1035,15 +1733,71 @@ func (m *model) spriteExists(sprite *spriteModel) (exists bool) {
 	}
 	return
 }
+
+// sprites iterates over all sprites, ordered (upward) by spriteModel.Layer, then as goals, walls, cubes, then actors,
+// in the order they were created, or in exactly the reverse order, if downward
 func (m *model) sprites(downward bool, fn func(sprite *spriteModel) bool) {
+	if len(m.layers) <= 1 {
+		m.spritesByType(downward, fn)
+		return
+	}
+	var (
+		layer int
+		ok    = true
+	)
+	for i := range m.layers {
+		if downward {
+			i = len(m.layers) - 1 - i
+		}
+		layer = m.layers[i]
+		m.spritesByType(downward, func(sprite *spriteModel) bool {
+			if sprite.Layer != layer {
+				return true
+			}
+			ok = fn(sprite)
+			return ok
+		})
+		if !ok {
+			return
+		}
+	}
+}
+
+// spritesByType implements sprites, ignoring spriteModel.Layer
+func (m *model) spritesByType(downward bool, fn func(sprite *spriteModel) bool) {
 	if downward {
-		panic(`downward unimplemented`)
+		for i := len(m.Actors) - 1; i >= 0; i-- {
+			if !callSpriteFn(m.Actors[i], fn) {
+				return
+			}
+		}
+		for i := len(m.Cubes) - 1; i >= 0; i-- {
+			if !callSpriteFn(m.Cubes[i], fn) {
+				return
+			}
+		}
+		for i := len(m.Walls) - 1; i >= 0; i-- {
+			if !callSpriteFn(m.Walls[i], fn) {
+				return
+			}
+		}
+		for i := len(m.Goals) - 1; i >= 0; i-- {
+			if !callSpriteFn(m.Goals[i], fn) {
+				return
+			}
+		}
+		return
 	}
 	for _, v := range m.Goals {
 		if !callSpriteFn(v, fn) {
 			return
 		}
 	}
+	for _, v := range m.Walls {
+		if !callSpriteFn(v, fn) {
+			return
+		}
+	}
 	for _, v := range m.Cubes {
 		if !callSpriteFn(v, fn) {
 			return
@@ -1055,25 +1809,83 @@ func (m *model) sprites(downward bool, fn func(sprite *spriteModel) bool) {
 		}
 	}
 }
-func (m *model) collisions(space Space, shape Shape, fn func(sprite *spriteModel) bool) {
-	// TODO should probably resolve collisions downward
-	m.sprites(false, func(sprite *spriteModel) bool {
+
+// satisfied indicates every criteria of the actor has been placed
+func (m *model) satisfied(actor *actorModel) bool {
+	if len(actor.Criteria) == 0 {
+		return false
+	}
+	for pair := range actor.Criteria {
+		if _, _, ok := m.placement(pair); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// placement returns the first cube (on a goal) satisfying the given criteria, expanding any wildcards
+func (m *model) placement(pair CriteriaKey) (*cubeModel, *goalModel, bool) {
+	cubes, goals := m.Cubes, m.Goals
+	if !pair.AnyCube() {
+		cubes = []*cubeModel{pair.Cube.cubeState.model}
+	}
+	if !pair.AnyGoal() {
+		goals = []*goalModel{pair.Goal.goalState.model}
+	}
+	for _, cube := range cubes {
+		for _, goal := range goals {
+			if cs, gs := cube.sprite(), goal.sprite(); cs.visible() && gs.visible() && cs.Shape.Collides(gs.Shape) {
+				return cube, goal, true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// collisions calls fn for each sprite colliding with space and shape, in the order of sprites (see downward)
+func (m *model) collisions(downward bool, space Space, shape Shape, fn func(sprite *spriteModel) bool) {
+	m.candidates(downward, shape, func(sprite *spriteModel) bool {
 		if sprite.collides(space, shape) {
 			return fn(sprite)
 		}
 		return true
 	})
 }
-func (m *model) collides(sprite *spriteModel) (collides bool) {
-	m.collisions(sprite.Space, sprite.Shape, func(o *spriteModel) bool {
+
+// candidates calls fn for each sprite that may collide with shape, in the order of sprites (see downward)
+func (m *model) candidates(downward bool, shape Shape, fn func(sprite *spriteModel) bool) {
+	if m.index == nil {
+		m.sprites(downward, fn)
+	} else if shape != nil {
+		m.index.query(downward, shape, fn)
+	}
+}
+
+// collider returns the first sprite (excluding itself) that the given sprite collides with, in the order of sprites,
+// i.e. the highest priority collider, if downward, or nil
+func (m *model) collider(downward bool, sprite *spriteModel) (collider *spriteModel) {
+	m.collisions(downward, sprite.Space, sprite.Shape, func(o *spriteModel) bool {
 		if o == sprite {
 			return true
 		}
-		collides = true
+		collider = o
 		return false
 	})
 	return
 }
+
+// collides resolves collisions downward, i.e. against actors, then cubes, then goals, as moving sprites are most
+// likely to collide with other actors
+func (m *model) collides(sprite *spriteModel) bool { return m.collider(true, sprite) != nil }
+
+// collidesMoving is collides, recording any collision, see update.Collisions
+func (u *update) collidesMoving(sprite *spriteModel) bool {
+	if collider := u.collider(true, sprite); collider != nil {
+		u.Collisions = append(u.Collisions, [2]*spriteModel{sprite, collider})
+		return true
+	}
+	return false
+}
 func (m *model) statusPane() (b []byte) {
 	b = make([]byte, 0, hudWidth*hudHeight) // including newlines but less border
 	b = append(b, "ACTOR STATUS\n"...)
@@ -1085,13 +1897,18 @@ func (m *model) statusPane() (b []byte) {
 			b = append(b, fmt.Sprintf("%s.vel = %s\n", name, summarizeVelocity(sprite.DX, sprite.DY))...)
 			b = append(b, fmt.Sprintf("%s.stop = %v\n", name, sprite.Stop)...)
 			b = append(b, fmt.Sprintf("%s.hand = %s\n", name, func() string {
-				if actor.HeldItem != nil {
-					if v := actor.HeldItem.sprite(); v != nil && len(v.Image) != 0 && v.Height == 1 {
-						return string(v.Image)
+				if len(actor.HeldItems) == 0 {
+					return `none`
+				}
+				var hand []rune
+				for _, item := range actor.HeldItems {
+					if v := item.sprite(); v != nil && len(v.Image) != 0 && v.Height == 1 {
+						hand = append(hand, v.Image...)
+					} else {
+						hand = append(hand, '?')
 					}
-					return `unknown`
 				}
-				return `none`
+				return string(hand)
 			}())...)
 		}
 	}
@@ -1112,11 +1929,14 @@ func (m *spriteModel) clone() *spriteModel {
 		// images aren't safe (for use in the state) but whatever
 		r.Images = append([]spriteImage(nil), m.Images...)
 		r.Image = append([]rune(nil), m.Image...)
+		r.Style = m.Style
+		r.ImageStyles = maps.Clone(m.ImageStyles)
 		if m.Shape != nil {
 			r.Shape = m.Shape.Clone()
 		}
 		r.Owner = m.Owner
 		r.Space = m.Space
+		r.Layer = m.Layer
 	}
 	return &r
 }
@@ -1178,11 +1998,19 @@ func (m *spriteModel) draw(draw func(x int, y int, mainc rune, combc []rune, sty
 			v := m.Image[i]
 			i++
 			if v != 0 {
-				draw(int(x+w+hudWidth), int(y+h), v, nil, tcell.StyleDefault)
+				style, ok := m.ImageStyles[i-1]
+				if !ok {
+					style = m.Style
+				}
+				draw(int(x+w+hudWidth), int(y+h), v, nil, style)
 			}
 		}
 	}
 }
+func (m *spriteModel) refreshImage() {
+	image := m.image()
+	m.Image, m.ImageStyles = image.Runes(), image.Styles()
+}
 func (m *spriteModel) sprite() *spriteModel            { return m }
 func (m *spriteModel) visible() bool                   { return m != nil && m.Shape != nil }
 func (m *spriteModel) distance(o *spriteModel) float64 { return m.Shape.Distance(o.Shape) }
@@ -1199,7 +2027,21 @@ func (m *spriteModel) image() (v spriteImage) {
 	}
 	return
 }
-func (m *spriteModel) shapeAt(vx, vy int32) Shape { return NewSpriteShape(vx, vy, m.Width, m.Height) }
+func (m *spriteModel) shapeAt(vx, vy int32, validate bool) Shape {
+	return newSpriteShape(validate, vx, vy, m.Width, m.Height)
+}
+
+// newSpriteShape calls NewSpriteShape, panicking if validate is true, and the shape isn't w by h, see
+// Config.ValidateShapes
+func newSpriteShape(validate bool, x, y, w, h int32) Shape {
+	shape := NewSpriteShape(x, y, w, h)
+	if validate {
+		if sw, sh := shape.Size(); sw != w || sh != h {
+			panic(fmt.Errorf(`sim: NewSpriteShape(%d, %d, %d, %d) returned a shape of size %dx%d, expected %dx%d`, x, y, w, h, sw, sh, w, h))
+		}
+	}
+	return shape
+}
 
 func (m *actorModel) clone() *actorModel {
 	var r actorModel
@@ -1210,10 +2052,19 @@ func (m *actorModel) clone() *actorModel {
 			r.Criteria[k] = v
 		}
 		r.Keyboard = m.Keyboard
-		r.HeldItem = m.HeldItem
+		r.HeldItems = slices.Clone(m.HeldItems)
+		r.Reached = m.Reached
+		r.Placed = maps.Clone(m.Placed)
 	}
 	return &r
 }
+func (m *actorModel) heldItem() Sprite {
+	if len(m.HeldItems) == 0 {
+		return nil
+	}
+	return m.HeldItems[len(m.HeldItems)-1]
+}
+func (m *actorModel) holds(item Sprite) bool { return slices.Contains(m.HeldItems, item) }
 func (m *actorModel) sprite() *spriteModel {
 	if m != nil {
 		return m.Sprite
@@ -1249,8 +2100,25 @@ func (m *goalModel) sprite() *spriteModel {
 	return nil
 }
 
-func (x staticImage) Runes() []rune { return x }
-func (x staticImage) Expired() bool { return false }
+func (m *wallModel) clone() *wallModel {
+	var r wallModel
+	if m != nil {
+		r.Sprite = m.Sprite
+	}
+	return &r
+}
+func (m *wallModel) sprite() *spriteModel {
+	if m != nil {
+		return m.Sprite
+	}
+	return nil
+}
+
+func (x staticImage) Runes() []rune               { return x }
+func (x staticImage) Expired() bool               { return false }
+func (x staticImage) Styles() map[int]tcell.Style { return nil }
+
+func (x styledImage) Styles() map[int]tcell.Style { return x.styles }
 
 func (x imageExpiry) Expired() bool { return x.expired() }
 
@@ -17,8 +17,21 @@
 package sim
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	tcell "github.com/gdamore/tcell/v2"
+	"math"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_spriteModel_distance(t *testing.T) {
@@ -141,3 +154,1372 @@ func Test_spriteModel_distance(t *testing.T) {
 		})
 	}
 }
+
+func newTestSimulation(t testing.TB, config Config) Simulation {
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(baseWidth, baseHeight)
+	config.Screen = screen
+	simulation, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return simulation
+}
+
+func runTestSimulation(t *testing.T, simulation Simulation) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		if err := simulation.Run(ctx); err != nil && ctx.Err() == nil {
+			t.Error(err)
+		}
+	}()
+	return ctx
+}
+
+func Test_model_collider(t *testing.T) {
+	var (
+		names = make(map[*spriteModel]string)
+		n     = func(name string, space Space) *spriteModel {
+			v := &spriteModel{Width: 1, Height: 1, Shape: NewSpriteShape(0, 0, 1, 1), Space: space}
+			names[v] = name
+			return v
+		}
+		m = &model{
+			Goals:  []*goalModel{{Sprite: n(`g1`, goalSpace)}},
+			Cubes:  []*cubeModel{{Sprite: n(`c1`, cubeSpace)}, {Sprite: n(`c2`, cubeSpace)}},
+			Actors: []*actorModel{{Sprite: n(`a1`, actorSpace)}},
+		}
+		probe = n(`p`, Space{Room: true, Floor: true})
+	)
+	for _, tc := range []struct {
+		Downward   bool
+		Sprite     *spriteModel
+		Collider   string
+		Collisions string
+	}{
+		{false, probe, `g1`, `[g1 c1 c2 a1]`},
+		{true, probe, `a1`, `[a1 c2 c1 g1]`},
+		{false, m.Actors[0].Sprite, `c1`, `[c1 c2 a1]`},
+		{true, m.Actors[0].Sprite, `c2`, `[a1 c2 c1]`},
+		{false, m.Goals[0].Sprite, ``, `[g1]`},
+		{true, m.Goals[0].Sprite, ``, `[g1]`},
+	} {
+		t.Run(fmt.Sprintf(`%v_%s`, tc.Downward, names[tc.Sprite]), func(t *testing.T) {
+			if v := names[m.collider(tc.Downward, tc.Sprite)]; v != tc.Collider {
+				t.Errorf(`collider: %q`, v)
+			}
+			if v := m.collides(tc.Sprite); v != (tc.Collider != ``) {
+				t.Errorf(`collides: %v`, v)
+			}
+			var collisions []string
+			m.collisions(tc.Downward, tc.Sprite.Space, tc.Sprite.Shape, func(sprite *spriteModel) bool {
+				collisions = append(collisions, names[sprite])
+				return true
+			})
+			if v := fmt.Sprint(collisions); v != tc.Collisions {
+				t.Errorf(`collisions: %s`, v)
+			}
+		})
+	}
+}
+
+// describeState returns a sorted description of every sprite in state, for comparison between simulations
+func describeState(state *State) (b []string) {
+	for _, sprite := range state.Sprites {
+		var (
+			x, y   = sprite.Position()
+			w, h   = sprite.Size()
+			dx, dy = sprite.Velocity()
+			v      = fmt.Sprintf(`%T %v,%v %vx%v %v,%v %v %q`, sprite, x, y, w, h, dx, dy, sprite.Stopped(), string(sprite.Image()))
+		)
+		if sprite.Shape() == nil {
+			v += ` hidden`
+		}
+		if actor, ok := sprite.(Actor); ok {
+			for _, item := range actor.HeldItems() {
+				v += fmt.Sprintf(` holding %q`, string(item.Image()))
+			}
+		}
+		b = append(b, v)
+	}
+	sort.Strings(b)
+	return
+}
+
+func TestNew_rand(t *testing.T) {
+	for _, scenario := range []string{scenarioStatic, scenarioHumanVsRobot, scenarioMultiActor, scenarioAnyCube} {
+		t.Run(scenario, func(t *testing.T) {
+			var (
+				a = newTestSimulation(t, Config{Scenario: scenario, Rand: rand.New(rand.NewSource(42))}).(*service)
+				b = newTestSimulation(t, Config{Scenario: scenario, Rand: rand.New(rand.NewSource(42))}).(*service)
+			)
+			if da, db := describeState(a.State()), describeState(b.State()); len(da) == 0 || !reflect.DeepEqual(da, db) {
+				t.Errorf("%q\n%q", da, db)
+			}
+			if va, vb := a.model.Rand.Int63(), b.model.Rand.Int63(); va != vb {
+				t.Error(va, vb)
+			}
+		})
+	}
+	if simulation := newTestSimulation(t, Config{}).(*service); simulation.model.Rand == nil {
+		t.Error(`expected default rand`)
+	}
+}
+
+func TestNew_scenario(t *testing.T) {
+	for _, tc := range []struct {
+		Scenario string
+		// Planned is the number of actors in the PlanConfig
+		Planned int
+		// Keyboard is the number of keyboard controlled actors
+		Keyboard int
+		// Adversary is true if there is a keyboard controlled actor not in the PlanConfig
+		Adversary bool
+	}{
+		{``, 1, 1, false},
+		{scenarioStatic, 1, 1, false},
+		{scenarioHumanVsRobot, 1, 1, true},
+		{scenarioMultiActor, 2, 0, false},
+		{scenarioAnyCube, 1, 1, false},
+	} {
+		t.Run(fmt.Sprintf(`%q`, tc.Scenario), func(t *testing.T) {
+			simulation := newTestSimulation(t, Config{Scenario: tc.Scenario}).(*service)
+			planned := make(map[*actorModel]bool)
+			for _, actor := range simulation.State().PlanConfig.Actors {
+				planned[actor.actorState.model] = true
+			}
+			if len(planned) != tc.Planned {
+				t.Error(len(planned))
+			}
+			var (
+				keyboard  int
+				adversary bool
+			)
+			for _, actor := range simulation.model.Actors {
+				if actor.Keyboard {
+					keyboard++
+					if !planned[actor] {
+						adversary = true
+					}
+				}
+			}
+			if keyboard != tc.Keyboard || adversary != tc.Adversary {
+				t.Error(keyboard, adversary)
+			}
+		})
+	}
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	if _, err := New(Config{Screen: screen, Scenario: `unknown`}); err == nil || err.Error() != `invalid scenario: unknown` {
+		t.Error(err)
+	}
+}
+
+func TestSimulation_WouldCollide(t *testing.T) {
+	simulation := newTestSimulation(t, Config{})
+	var (
+		state   = simulation.State()
+		actor   = state.PlanConfig.Actors[0]
+		sprites = make(map[rune]Sprite)
+	)
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 {
+			sprites[image[0]] = k
+		}
+	}
+	for _, tc := range []struct {
+		X, Y    int32
+		Blocker rune
+	}{
+		{6, 10, 0},
+		{10, 3, 0},
+		{53, 10, 0},
+		{35, 7, '1'},
+		{36, 8, '1'},
+		{52, 13, '6'},
+		{50, 12, '5'},
+	} {
+		t.Run(fmt.Sprintf(`%d_%d`, tc.X, tc.Y), func(t *testing.T) {
+			blocker, ok := simulation.WouldCollide(actor, tc.X, tc.Y)
+			if tc.Blocker == 0 {
+				if ok || blocker != nil {
+					t.Error(blocker, ok)
+				}
+			} else if !ok || blocker != sprites[tc.Blocker] {
+				t.Error(blocker, ok)
+			}
+		})
+	}
+	if blocker, ok := simulation.WouldCollide(Cube{}, 10, 3); ok || blocker != nil {
+		t.Error(blocker, ok)
+	}
+}
+
+func TestSimulation_MoveBy(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	ctx := runTestSimulation(t, simulation)
+	actor := simulation.State().PlanConfig.Actors[0]
+	if x, y := actor.Position(); x != 6 || y != 10 {
+		t.Fatal(x, y)
+	}
+	for _, tc := range []struct {
+		DX, DY float64
+		X, Y   int32
+	}{
+		{4, 2, 10, 12},
+		{-3, 0, 7, 12},
+		{0, -5, 7, 7},
+	} {
+		if err := simulation.MoveBy(ctx, actor, tc.DX, tc.DY); err != nil {
+			t.Fatal(err)
+		}
+		if x, y := actor.Shape().Position(); x != tc.X || y != tc.Y {
+			t.Fatal(tc, x, y)
+		}
+	}
+	for _, tc := range []struct{ DX, DY float64 }{
+		{-8, 0},
+		{0, -8},
+		{spaceWidth, 0},
+		{0, spaceHeight},
+	} {
+		if err := simulation.MoveBy(ctx, actor, tc.DX, tc.DY); err == nil || !strings.HasPrefix(err.Error(), `target position invalid: `) {
+			t.Error(tc, err)
+		}
+	}
+	if x, y := actor.Shape().Position(); x != 7 || y != 7 {
+		t.Error(x, y)
+	}
+}
+
+func TestSimulation_MoveAll(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Scenario: scenarioMultiActor})
+	var (
+		actors  = simulation.State().PlanConfig.Actors
+		targets = map[Sprite][2]float64{actors[0]: {2, 8}, actors[1]: {51, 8}}
+	)
+	for _, actor := range actors {
+		if _, y := actor.Position(); y != 18 {
+			t.Fatal(y)
+		}
+	}
+
+	// in lockstep with the caller, see TestSimulation_Step
+	done := make(chan error, 1)
+	go func() { done <- simulation.MoveAll(context.Background(), targets) }()
+	var started int
+	for deadline := time.Now().Add(time.Second * 10); len(done) == 0; time.Sleep(time.Millisecond / 10) {
+		if time.Now().After(deadline) {
+			t.Fatal(`expected move to complete`)
+		}
+		_, y0 := actors[0].Position()
+		_, y1 := actors[1].Position()
+		if err := simulation.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		_, ny0 := actors[0].Position()
+		_, ny1 := actors[1].Position()
+		if ny0 == y0 && ny1 == y1 {
+			continue
+		}
+		started++
+		if ny0 >= y0 || ny1 >= y1 || ny0 != ny1 {
+			t.Fatalf(`expected both actors to advance: %v -> %v, %v -> %v`, y0, ny0, y1, ny1)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if started < 10 {
+		t.Error(started)
+	}
+	for actor, target := range targets {
+		if x, y := actor.Position(); math.Abs(x-target[0]) > 0.1 || math.Abs(y-target[1]) > 0.1 {
+			t.Error(x, y)
+		}
+		if !actor.Stopped() {
+			t.Error(`expected stopped`)
+		}
+	}
+
+	// the first error stops every sprite
+	ctx := runTestSimulation(t, simulation)
+	if err := simulation.MoveAll(ctx, map[Sprite][2]float64{actors[0]: {2, 18}, actors[1]: {51, -1}}); err == nil || err.Error() != `target position invalid: 51, -1` {
+		t.Fatal(err)
+	}
+	if err := simulation.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, actor := range actors {
+		if !actor.Stopped() {
+			t.Error(`expected stopped`)
+		}
+	}
+	if err := simulation.MoveAll(ctx, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSimulation_Pause(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	ctx := runTestSimulation(t, simulation)
+	actor := simulation.State().PlanConfig.Actors[0]
+	if x, y := actor.Shape().Position(); x != 6 || y != 10 {
+		t.Fatal(x, y)
+	}
+
+	if err := simulation.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- simulation.MoveBy(ctx, actor, 4, 2) }()
+	time.Sleep(time.Millisecond * 50)
+	select {
+	case err := <-done:
+		t.Fatal(`unexpected move while paused:`, err)
+	default:
+	}
+	if x, y := actor.Shape().Position(); x != 6 || y != 10 {
+		t.Fatal(x, y)
+	}
+
+	if err := simulation.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if x, y := actor.Shape().Position(); x != 10 || y != 12 {
+		t.Error(x, y)
+	}
+}
+
+func TestSimulation_Step(t *testing.T) {
+	simulation := newTestSimulation(t, Config{})
+	svc := simulation.(*service)
+	actor := simulation.State().PlanConfig.Actors[0]
+	if x, y := actor.Position(); x != 6 || y != 10 {
+		t.Fatal(x, y)
+	}
+
+	u := update{model: svc.model}
+	if !u.control(svc.model.Actors[0].Sprite, true, stepDistance, 0) {
+		t.Fatal(`expected control`)
+	}
+	svc.view(u)
+	const n = 10
+	for i := 0; i < n; i++ {
+		if err := simulation.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if x, y := actor.Position(); math.Abs(x-(6+float64(i+1)*stepDistance)) > 1e-9 || y != 10 {
+			t.Fatal(i, x, y)
+		}
+	}
+	if dx, dy := actor.Velocity(); dx != stepDistance || dy != 0 {
+		t.Fatal(dx, dy)
+	}
+
+	// in lockstep with the caller (stopped first, as the move may not be accepted until a later step)
+	u = update{model: svc.model}
+	u.control(svc.model.Actors[0].Sprite, true, 0, 0)
+	svc.view(u)
+	done := make(chan error, 1)
+	go func() { done <- simulation.MoveBy(context.Background(), actor, 0, 3) }()
+	for deadline := time.Now().Add(time.Second * 10); len(done) == 0; time.Sleep(time.Millisecond / 10) {
+		if time.Now().After(deadline) {
+			t.Fatal(`expected move to complete`)
+		}
+		if err := simulation.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if x, y := actor.Shape().Position(); x != 8 || y != 13 {
+		t.Error(x, y)
+	}
+
+	ctx := runTestSimulation(t, simulation)
+	// blocks until Run is active
+	if err := simulation.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.Step(ctx); err == nil || err.Error() != `simulation is running` {
+		t.Error(err)
+	}
+}
+
+func TestSimulation_SetInterval(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	svc := simulation.(*service)
+	if err := simulation.SetInterval(context.Background(), 0); err == nil || err.Error() != `invalid interval: 0s` {
+		t.Error(err)
+	}
+	ctx := runTestSimulation(t, simulation)
+
+	var ticks int32
+	go func() {
+		_ = svc.externalLogic(ctx, nil, func(ctx context.Context, u *update) bool {
+			atomic.AddInt32(&ticks, 1)
+			return false
+		})
+	}()
+	count := func() int32 {
+		v := atomic.LoadInt32(&ticks)
+		time.Sleep(time.Millisecond * 200)
+		return atomic.LoadInt32(&ticks) - v
+	}
+
+	if n := count(); n < 50 {
+		t.Fatal(`expected fast ticks:`, n)
+	}
+	if err := simulation.SetInterval(ctx, time.Millisecond*50); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n > 8 {
+		t.Error(`expected slow ticks:`, n)
+	}
+	if err := simulation.SetInterval(ctx, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n < 50 {
+		t.Error(`expected fast ticks:`, n)
+	}
+}
+
+func TestSimulation_MoveBy_movementMode(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Mode   MovementMode
+		DX, DY float64
+		// OnPath returns true if (x, y) is on the expected path, from (6, 10)
+		OnPath func(x, y int32) bool
+	}{
+		{
+			Name:   `cardinal4`,
+			Mode:   MovementCardinal4,
+			DX:     4,
+			DY:     -3,
+			OnPath: func(x, y int32) bool { return (y == 10 && x >= 6 && x <= 10) || (x == 10 && y >= 7 && y <= 10) },
+		},
+		{
+			Name:   `diagonal8`,
+			Mode:   MovementDiagonal8,
+			DX:     4,
+			DY:     -2,
+			OnPath: func(x, y int32) bool { return (x-6 == 10-y && x >= 6 && x <= 8) || (y == 8 && x >= 8 && x <= 10) },
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			simulation := newTestSimulation(t, Config{Interval: time.Millisecond, MovementMode: tc.Mode})
+			ctx := runTestSimulation(t, simulation)
+			actor := simulation.State().PlanConfig.Actors[0]
+			if x, y := actor.Position(); x != 6 || y != 10 {
+				t.Fatal(x, y)
+			}
+			if mode := simulation.State().MovementMode; mode != tc.Mode {
+				t.Fatal(mode)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- simulation.MoveBy(ctx, actor, tc.DX, tc.DY) }()
+			var samples int
+			for {
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatal(err)
+					}
+					if x, y := actor.Shape().Position(); x != 10 || y != int32(10+tc.DY) {
+						t.Error(x, y)
+					}
+					if samples == 0 {
+						t.Error(`expected samples`)
+					}
+					return
+				default:
+				}
+				if x, y := actor.Shape().Position(); !tc.OnPath(x, y) {
+					t.Fatal(`unexpected position:`, x, y)
+				}
+				if dx, dy := actor.Velocity(); !tc.Mode.allows(dx, dy) {
+					t.Fatal(`unexpected velocity:`, dx, dy)
+				}
+				samples++
+				time.Sleep(time.Millisecond / 4)
+			}
+		})
+	}
+}
+
+func TestNew_invalidMovementMode(t *testing.T) {
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	if _, err := New(Config{Screen: screen, MovementMode: MovementDiagonal8 + 1}); err == nil || err.Error() != `invalid movement mode: MovementMode(3)` {
+		t.Error(err)
+	}
+}
+
+func TestSimulation_externalLogicTimeout(t *testing.T) {
+	simulation := newTestSimulation(t, Config{ExternalLogicTimeout: time.Millisecond * 50})
+	actor := simulation.State().PlanConfig.Actors[0]
+	x, y := actor.Position()
+	start := time.Now()
+	// not running, so nothing will accept the move
+	if err := simulation.Move(context.Background(), actor, 10, 10); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Millisecond*50 || d > time.Second {
+		t.Error(d)
+	}
+	if nx, ny := actor.Position(); nx != x || ny != y {
+		t.Error(nx, ny)
+	}
+}
+
+func TestNew_invalidExternalLogicTimeout(t *testing.T) {
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	if _, err := New(Config{Screen: screen, ExternalLogicTimeout: -time.Second}); err == nil || err.Error() != `invalid external logic timeout: -1s` {
+		t.Error(err)
+	}
+}
+
+func TestNew_validateShapes(t *testing.T) {
+	// the default factory is valid, note the simulation is stopped (by cleanup) before NewSpriteShape is replaced
+	t.Run(`default`, func(t *testing.T) {
+		simulation := newTestSimulation(t, Config{ValidateShapes: true})
+		ctx := runTestSimulation(t, simulation)
+		if err := simulation.Move(ctx, simulation.State().PlanConfig.Actors[0], 10, 5); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	defer func(v func(x, y, w, h int32) Shape) { NewSpriteShape = v }(NewSpriteShape)
+	// circles are always square, e.g. the actor (3x2) would be 3x3
+	NewSpriteShape = func(x, y, w, h int32) Shape { return NewCircle(x+w/2, y+h/2, w/2) }
+
+	func() {
+		defer func() {
+			const expected = `sim: NewSpriteShape(6, 10, 3, 2) returned a shape of size 3x3, expected 3x2`
+			if r := recover(); r == nil || fmt.Sprint(r) != expected {
+				t.Errorf("expected panic %q, got %v", expected, r)
+			}
+		}()
+		_, _ = NewHeadless(HeadlessConfig{ValidateShapes: true})
+	}()
+
+	// disabled by default
+	if shape := newSpriteShape(false, 0, 0, 3, 2); shape == nil {
+		t.Error(shape)
+	} else if w, h := shape.Size(); w != 3 || h != 3 {
+		t.Error(w, h)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var recording bytes.Buffer
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond, Recorder: &recording})
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+		other Sprite
+	)
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 && image[0] == '1' {
+			cube = k
+		} else if len(image) == 1 && image[0] == '6' {
+			other = k
+		}
+	}
+	func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		done := make(chan error, 1)
+		go func() { done <- simulation.Run(ctx) }()
+		defer func() {
+			cancel()
+			<-done
+		}()
+		if err := simulation.Move(ctx, actor, 33, 8); err != nil {
+			t.Fatal(err)
+		}
+		if err := simulation.Grasp(ctx, actor, cube); err != nil {
+			t.Fatal(err)
+		}
+		if err := simulation.MoveBy(ctx, actor, -5, 4); err != nil {
+			t.Fatal(err)
+		}
+		if err := simulation.Release(ctx, actor, cube); err != nil {
+			t.Fatal(err)
+		}
+		// fails, but must still be replayed
+		if err := simulation.Grasp(ctx, actor, actor); err == nil {
+			t.Fatal(`expected error`)
+		}
+		if err := simulation.MoveBy(ctx, actor, 2, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := simulation.MoveAll(ctx, map[Sprite][2]float64{actor: {40, 13}, other: {53, 20}}); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	expected := describeState(simulation.State())
+
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(baseWidth, baseHeight)
+	replayed, err := Replay(bytes.NewReader(recording.Bytes()), screen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual := describeState(replayed.State()); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%s\nactual:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	// the recording is verified against the outcome of each tick
+	{
+		var (
+			decoder  = json.NewDecoder(bytes.NewReader(recording.Bytes()))
+			tampered bytes.Buffer
+			encoder  = json.NewEncoder(&tampered)
+			modified bool
+		)
+		for decoder.More() {
+			var event recordEvent
+			if err := decoder.Decode(&event); err != nil {
+				t.Fatal(err)
+			}
+			if !modified && len(event.Moved) != 0 {
+				event.Moved[0].X++
+				modified = true
+			}
+			if err := encoder.Encode(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := Replay(&tampered, screen); err == nil || !strings.HasPrefix(err.Error(), `replay diverged at tick `) {
+			t.Error(err)
+		}
+	}
+	if _, err := Replay(strings.NewReader(`{"tick":0,"op":"move"}`), screen); err == nil || err.Error() != `invalid recording: expected config got move` {
+		t.Error(err)
+	}
+}
+
+func TestSimulation_Snapshot(t *testing.T) {
+	const expected = `##########################################################
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                    1                2  #
+#                                                   3 !G!#
+#      0|0                                            !O!#
+#      0|0                                         4  !A!#
+#                                                     !L!#
+#                                                   5 !!!#
+#                                                     6  #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+#                                                        #
+##########################################################`
+	simulation := newTestSimulation(t, Config{})
+	var rows []string
+	for _, row := range simulation.Snapshot() {
+		rows = append(rows, string(row))
+	}
+	if actual := strings.Join(rows, "\n"); actual != expected {
+		t.Errorf("unexpected snapshot:\n%s", actual)
+	}
+}
+
+func TestSimulation_Distance(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+	)
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 && image[0] == '1' {
+			cube = k
+		}
+	}
+
+	// actor (6, 10) 3x2 and cube (36, 8) 1x1, closest points are (8, 10) and (36, 8)
+	if d, err := simulation.Distance(actor, cube); err != nil || d != math.Sqrt(28*28+2*2) {
+		t.Error(d, err)
+	}
+	if d, err := simulation.Distance(cube, actor); err != nil || d != math.Sqrt(28*28+2*2) {
+		t.Error(d, err)
+	}
+
+	if err := simulation.Move(ctx, actor, 33, 8); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := simulation.Distance(actor, cube); err != nil || d != 1 {
+		t.Error(d, err)
+	}
+
+	if _, err := simulation.GraspItem(ctx, actor, cube); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := simulation.Distance(actor, cube); err == nil || err.Error() != `sprite not visible` {
+		t.Error(d, err)
+	}
+	if d, err := simulation.Distance(actor, nil); err == nil || err.Error() != `sprite not found` {
+		t.Error(d, err)
+	}
+}
+
+func TestSimulation_GraspItem(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+	)
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 && image[0] == '1' {
+			cube = k
+		}
+	}
+	if cube == nil {
+		t.Fatal(`cube not found`)
+	}
+	cx, cy := cube.Shape().Position()
+
+	// too far away
+	if held, err := simulation.GraspItem(ctx, actor, cube); err == nil || held != nil {
+		t.Fatal(held, err)
+	}
+
+	if err := simulation.Move(ctx, actor, 33, 8); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := simulation.GraspItem(ctx, actor, cube); err != nil || held != cube {
+		t.Fatal(held, err)
+	}
+	if held := simulation.State().Sprites[actor].(Actor).HeldItem(); held != cube {
+		t.Fatal(held)
+	}
+
+	// already holding
+	if held, err := simulation.GraspItem(ctx, actor, cube); err == nil || held != nil {
+		t.Fatal(held, err)
+	}
+
+	if err := simulation.Move(ctx, actor, 33, 4); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := simulation.ReleaseItem(ctx, actor, cube); err != nil || held != nil {
+		t.Fatal(held, err)
+	}
+	if held := simulation.State().Sprites[actor].(Actor).HeldItem(); held != nil {
+		t.Fatal(held)
+	}
+
+	// not holding
+	if held, err := simulation.ReleaseItem(ctx, actor, cube); err == nil || held != nil {
+		t.Fatal(held, err)
+	}
+
+	// the released cube may be moved, e.g. back to where it was grasped from
+	if err := simulation.Move(ctx, actor, 40, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.Move(ctx, cube, float64(cx), float64(cy)); err != nil {
+		t.Fatal(err)
+	}
+	if x, y := simulation.State().Sprites[cube].Shape().Position(); x != cx || y != cy {
+		t.Fatal(x, y)
+	}
+}
+
+func TestSimulation_GraspItem_inventory(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond, InventorySize: 2})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cubes = make(map[rune]Sprite)
+	)
+	if state.InventorySize != 2 {
+		t.Fatal(state.InventorySize)
+	}
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 {
+			cubes[image[0]] = k
+		}
+	}
+	check := func(held ...Sprite) {
+		t.Helper()
+		actorValue := simulation.State().Sprites[actor].(Actor)
+		if items := actorValue.HeldItems(); !reflect.DeepEqual(items, held) && (len(items) != 0 || len(held) != 0) {
+			t.Fatal(items)
+		}
+		var top Sprite
+		if len(held) != 0 {
+			top = held[len(held)-1]
+		}
+		if v := actorValue.HeldItem(); v != top {
+			t.Fatal(v)
+		}
+		// the composite image shows the top item
+		image := []rune(`0|00|0`)
+		if top != nil {
+			image[1] = top.Image()[0]
+		}
+		if v := actorValue.Image(); string(v) != string(image) {
+			t.Fatalf(`%q`, string(v))
+		}
+	}
+
+	if err := simulation.Move(ctx, actor, 33, 8); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := simulation.GraspItem(ctx, actor, cubes['1']); err != nil || held != cubes['1'] {
+		t.Fatal(held, err)
+	}
+	check(cubes['1'])
+	if err := simulation.Move(ctx, actor, 47, 11); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := simulation.GraspItem(ctx, actor, cubes['4']); err != nil || held != cubes['4'] {
+		t.Fatal(held, err)
+	}
+	check(cubes['1'], cubes['4'])
+
+	// inventory full
+	if held, err := simulation.GraspItem(ctx, actor, cubes['3']); err == nil || held != nil {
+		t.Fatal(held, err)
+	}
+
+	// must be released in reverse order
+	if held, err := simulation.ReleaseItem(ctx, actor, cubes['1']); err == nil || held != nil {
+		t.Fatal(held, err)
+	}
+	if held, err := simulation.ReleaseItem(ctx, actor, cubes['4']); err != nil || held != cubes['1'] {
+		t.Fatal(held, err)
+	}
+	check(cubes['1'])
+	if x, y := cubes['4'].Shape().Position(); x != 48 || y != 10 {
+		t.Fatal(x, y)
+	}
+	if err := simulation.Move(ctx, actor, 33, 14); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := simulation.ReleaseItem(ctx, actor, cubes['1']); err != nil || held != nil {
+		t.Fatal(held, err)
+	}
+	check()
+	if x, y := cubes['1'].Shape().Position(); x != 34 || y != 13 {
+		t.Fatal(x, y)
+	}
+}
+
+func TestSimulation_OnCollision(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		collisions [][2]Sprite
+	)
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond, OnCollision: func(a, b Sprite) {
+		mu.Lock()
+		defer mu.Unlock()
+		collisions = append(collisions, [2]Sprite{a, b})
+	}})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+	)
+	for k := range state.Sprites {
+		if image := k.Image(); len(image) == 1 && image[0] == '1' {
+			cube = k
+		}
+	}
+
+	// unobstructed
+	if err := simulation.Move(ctx, actor, 30, 8); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(collisions) != 0 {
+		t.Error(collisions)
+	}
+	mu.Unlock()
+
+	// bumps into the cube
+	if err := simulation.Move(ctx, actor, 36, 8); err == nil {
+		t.Fatal(`expected error`)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(collisions) == 0 {
+		t.Fatal(`expected collision`)
+	}
+	for _, pair := range collisions {
+		if pair[0] != actor || pair[1] != cube {
+			t.Error(pair)
+		}
+	}
+	if x, y := actor.Shape().Position(); x != 33 || y != 8 {
+		t.Error(x, y)
+	}
+}
+
+func TestSimulation_wall(t *testing.T) {
+	simulation := newTestSimulation(t, Config{Interval: time.Millisecond})
+	{
+		svc := simulation.(*service)
+		u := update{model: svc.model}
+		if _, err := u.createWall(20, 4, 1, 12); err != nil {
+			t.Fatal(err)
+		}
+		// may not overlap other room sprites
+		if _, err := u.createWall(5, 10, 2, 2); err == nil {
+			t.Fatal(`expected error`)
+		}
+		svc.view(u)
+	}
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		wall  Sprite
+		cube  Sprite
+	)
+	for k := range state.Sprites {
+		switch k := k.(type) {
+		case Wall:
+			if wall != nil {
+				t.Fatal(`expected one wall`)
+			}
+			wall = k
+		case Cube:
+			if image := k.Image(); len(image) == 1 && image[0] == '1' {
+				cube = k
+			}
+		}
+	}
+	if wall == nil || cube == nil {
+		t.Fatal(wall, cube)
+	}
+	if x, y := wall.Shape().Position(); x != 20 || y != 4 {
+		t.Fatal(x, y)
+	}
+	if w, h := wall.Size(); w != 1 || h != 12 {
+		t.Fatal(w, h)
+	}
+	if image := string(wall.Image()); image != strings.Repeat(string(runeWall), 12) {
+		t.Fatalf(`%q`, image)
+	}
+
+	// the wall is between the actor and the cube
+	if err := simulation.Move(ctx, actor, 33, 8); err == nil || err.Error() != `sprite movement interrupted` {
+		t.Fatal(err)
+	}
+	if x, _ := actor.Shape().Position(); x >= 20 {
+		t.Error(x)
+	}
+
+	if err := simulation.Move(ctx, wall, 30, 4); err == nil || err.Error() != `sprite not movable` {
+		t.Error(err)
+	}
+	if _, err := simulation.GraspItem(ctx, actor, wall); err == nil {
+		t.Error(`expected error`)
+	}
+	if x, y := wall.Shape().Position(); x != 20 || y != 4 {
+		t.Error(x, y)
+	}
+}
+
+func TestSimulation_layer(t *testing.T) {
+	simulation, err := NewHeadless(HeadlessConfig{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := simulation.(*headless).service
+	u := update{model: svc.model}
+	// both goals overlap the actor (drawn as 0|0 at 30, 10), only the first is in a higher layer
+	above, err := u.createLayeredSprite(1, 31-hudWidth, 10, 1, 1, []rune(`X`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.createGoal(above); err != nil {
+		t.Fatal(err)
+	}
+	below, err := u.createSprite(31-hudWidth, 11, 1, 1, []rune(`Y`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.createGoal(below); err != nil {
+		t.Fatal(err)
+	}
+	u.Redraw = true
+	svc.view(u)
+
+	var order []*spriteModel
+	u.sprites(false, func(sprite *spriteModel) bool {
+		order = append(order, sprite)
+		return true
+	})
+	if len(order) == 0 || order[len(order)-1] != above {
+		t.Error(`expected the layered sprite to be last`)
+	}
+	var downward []*spriteModel
+	u.sprites(true, func(sprite *spriteModel) bool {
+		downward = append(downward, sprite)
+		return true
+	})
+	slices.Reverse(downward)
+	if !slices.Equal(order, downward) {
+		t.Error(`expected downward to be the reverse of upward`)
+	}
+	var hit *spriteModel
+	u.collisions(true, Space{Floor: true, Room: true}, above.Shape, func(sprite *spriteModel) bool {
+		hit = sprite
+		return false
+	})
+	if hit != above {
+		t.Error(`expected the layered sprite to take priority`)
+	}
+
+	grid := simulation.Grid()
+	if r := grid[10][31]; r != 'X' {
+		t.Errorf(`expected the layered goal to be drawn over the actor, got %q`, r)
+	}
+	if r := grid[11][31]; r != '|' {
+		t.Errorf(`expected the actor to be drawn over the goal, got %q`, r)
+	}
+	snapshot := simulation.Snapshot()
+	if r := snapshot[11][31-hudWidth+1]; r != 'X' {
+		t.Errorf(`unexpected snapshot rune %q`, r)
+	}
+	if r := snapshot[12][31-hudWidth+1]; r != '|' {
+		t.Errorf(`unexpected snapshot rune %q`, r)
+	}
+}
+
+func TestSimulation_mouse(t *testing.T) {
+	screen := tcell.NewSimulationScreen(``)
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(screen.Fini)
+	screen.SetSize(baseWidth, baseHeight)
+	simulation, err := New(Config{Screen: screen, Interval: time.Millisecond * 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTestSimulation(t, simulation)
+	actor := simulation.State().PlanConfig.Actors[0]
+	if x, y := actor.Position(); x != 30-hudWidth || y != 10 {
+		t.Fatal(x, y)
+	}
+	// clicks in the hud are ignored
+	screen.InjectMouse(2, 20, tcell.Button1, tcell.ModNone)
+	screen.InjectMouse(2, 20, tcell.ButtonNone, tcell.ModNone)
+	// down and to the right of the actor
+	screen.InjectMouse(hudWidth+20, 18, tcell.Button1, tcell.ModNone)
+	screen.InjectMouse(hudWidth+20, 18, tcell.ButtonNone, tcell.ModNone)
+	for deadline := time.Now().Add(time.Second * 5); ; {
+		if dx, dy := actor.Velocity(); dx != 0 || dy != 0 {
+			if dx <= 0 || dy <= 0 || math.Abs(dx/dy-(20-(30-hudWidth))/8.0) > 1e-6 {
+				t.Fatal(dx, dy)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(`expected the actor to move toward the click`)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSimulation_OnGoalReached(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		reached []Actor
+	)
+	simulation := newTestSimulation(t, Config{Scenario: scenarioMultiActor, Interval: time.Millisecond, OnGoalReached: func(actor Actor) {
+		mu.Lock()
+		defer mu.Unlock()
+		reached = append(reached, actor)
+	}})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		cube  Sprite
+	)
+	for pair := range actor.Criteria() {
+		cube = pair.Cube
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reached)
+	}
+
+	if err := simulation.Move(ctx, actor, 24, 14); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulation.GraspItem(ctx, actor, cube); err != nil {
+		t.Fatal(err)
+	}
+	// releases the cube within the goal
+	if err := simulation.Move(ctx, actor, 25, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulation.ReleaseItem(ctx, actor, cube); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); count() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second*5 {
+			t.Fatal(`expected callback`)
+		}
+	}
+
+	// moving away (many ticks later) must not re-trigger the callback
+	if err := simulation.Move(ctx, actor, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	// both actors need the same cube on the same goal
+	mu.Lock()
+	defer mu.Unlock()
+	if actors := state.PlanConfig.Actors; len(reached) != 2 || reached[0] != actors[0] || reached[1] != actors[1] {
+		t.Error(reached)
+	}
+}
+
+func TestSimulation_OnGoal(t *testing.T) {
+	type call struct {
+		actor Actor
+		cube  Cube
+		goal  Goal
+	}
+	var (
+		mu    sync.Mutex
+		calls []call
+	)
+	simulation := newTestSimulation(t, Config{Scenario: scenarioMultiActor, Interval: time.Millisecond, OnGoal: func(actor Actor, cube Cube, goal Goal) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call{actor, cube, goal})
+	}})
+	ctx := runTestSimulation(t, simulation)
+	var (
+		state = simulation.State()
+		actor = state.PlanConfig.Actors[0]
+		pair  CriteriaKey
+	)
+	for k := range actor.Criteria() {
+		pair = k
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls)
+	}
+
+	if err := simulation.Move(ctx, actor, 24, 14); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := simulation.GraspItem(ctx, actor, pair.Cube); err != nil {
+		t.Fatal(err)
+	}
+	// moving the held cube over the goal doesn't count
+	if err := simulation.Move(ctx, actor, 25, 5); err != nil {
+		t.Fatal(err)
+	}
+	if v := count(); v != 0 {
+		t.Fatal(v)
+	}
+	if _, err := simulation.ReleaseItem(ctx, actor, pair.Cube); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); count() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second*5 {
+			t.Fatal(`expected callback`)
+		}
+	}
+
+	// the cube remains on the goal (many ticks later)
+	if err := simulation.Move(ctx, actor, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// both actors need the same cube on the same goal
+	if actors := state.PlanConfig.Actors; len(calls) != 2 || calls[0] != (call{actors[0], pair.Cube, pair.Goal}) || calls[1] != (call{actors[1], pair.Cube, pair.Goal}) {
+		t.Error(calls)
+	}
+}
+
+func TestSimulation_OnGoal_anyCube(t *testing.T) {
+	var (
+		cubes   []string
+		reached int
+	)
+	simulation := newTestSimulation(t, Config{
+		Scenario:      scenarioAnyCube,
+		Interval:      time.Millisecond,
+		OnGoal:        func(actor Actor, cube Cube, goal Goal) { cubes = append(cubes, string(cube.Image())) },
+		OnGoalReached: func(actor Actor) { reached++ },
+	})
+	svc := simulation.(*service)
+	{
+		u := update{model: svc.model}
+		for _, cube := range u.Cubes {
+			if string(cube.Sprite.Image) == `2` {
+				if err := u.reposition(cube.Sprite, 54, 11); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		svc.view(u)
+	}
+	for i := 0; i < 3; i++ {
+		if err := simulation.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(cubes) != 1 || cubes[0] != `2` || reached != 1 {
+		t.Error(cubes, reached)
+	}
+}
+
+// screenText returns the contents of the screen, as rows of text, where unset cells are spaces, note that it must
+// not be called concurrently with the simulation drawing to the screen, see screenTextSync
+func screenText(screen tcell.SimulationScreen) string {
+	cells, w, h := screen.GetContents()
+	var b strings.Builder
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r := ' '
+			if runes := cells[y*w+x].Runes; len(runes) != 0 {
+				r = runes[0]
+			}
+			b.WriteRune(r)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// screenTextSync calls screenText on the simulation goroutine, between frames
+func screenTextSync(ctx context.Context, t *testing.T, simulation *service) (s string) {
+	screen := simulation.config.Screen.(tcell.SimulationScreen)
+	if err := simulation.externalLogic(ctx, nil, func(ctx context.Context, u *update) bool {
+		s = screenText(screen)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSimulation_SetPlanOverlay(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprint(enabled), func(t *testing.T) {
+			simulation := newTestSimulation(t, Config{Interval: time.Millisecond, PlanOverlay: enabled})
+			ctx := runTestSimulation(t, simulation)
+			var (
+				actor = simulation.State().PlanConfig.Actors[0]
+				wait  = time.Second
+			)
+			if !enabled {
+				// the overlay should never be displayed
+				wait = time.Millisecond * 50
+			}
+			for _, text := range []string{`move(3, 4)`, `pick(1)`} {
+				simulation.SetPlanOverlay(actor, text)
+				expected := `0.plan = ` + text
+				var s string
+				for start := time.Now(); time.Since(start) < wait; time.Sleep(time.Millisecond) {
+					if s = screenTextSync(ctx, t, simulation.(*service)); strings.Contains(s, expected) {
+						break
+					}
+				}
+				if strings.Contains(s, expected) != enabled || strings.Contains(s, `PLAN STATUS`) != enabled {
+					t.Errorf("unexpected screen:\n%s", s)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkState_concurrent models multiple planners taking snapshots, while the simulation publishes updates
+func BenchmarkState_concurrent(b *testing.B) {
+	simulation := newTestSimulation(b, Config{Scenario: scenarioMultiActor}).(*service)
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		done        = make(chan struct{})
+	)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			var u update
+			u.model = simulation.model
+			u.sprites(false, func(sprite *spriteModel) bool {
+				u.updateSprite(sprite)
+				return true
+			})
+			simulation.view(u)
+		}
+	}()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			state := simulation.State()
+			for k := range state.Sprites {
+				k.Position()
+			}
+		}
+	})
+}
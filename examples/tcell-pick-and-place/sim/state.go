@@ -18,8 +18,12 @@
 package sim
 
 import (
+	"cmp"
 	"fmt"
+	tcell "github.com/gdamore/tcell/v2"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
 type (
@@ -27,11 +31,17 @@ type (
 		SpaceWidth     int32
 		SpaceHeight    int32
 		PickupDistance float64
+		// MovementMode is the simulation's Config.MovementMode
+		MovementMode MovementMode
+		// InventorySize is the simulation's Config.InventorySize
+		InventorySize int
 		// Sprites will enumerate all sprites, note that each value will be one of Actor, Cube, or Goal, which may all
 		// be compared by equality (to identify the actual underlying thing they refer to), where the map key is
 		// the actual Sprite, and the value is a (detached) snapshot of the same
 		Sprites    map[Sprite]Sprite
 		PlanConfig PlanConfig
+		// validateShapes is the simulation's Config.ValidateShapes, see newSpriteShape
+		validateShapes bool
 	}
 
 	PlanConfig struct {
@@ -40,6 +50,8 @@ type (
 
 	Criteria map[CriteriaKey]CriteriaValue
 
+	// CriteriaKey is a cube that must be placed on a goal, where the zero value of either field is a wildcard, e.g.
+	// CriteriaKey{Goal: goal} is satisfied by any cube on goal, see also AnyCube and AnyGoal
 	CriteriaKey struct {
 		Cube Cube
 		Goal Goal
@@ -58,7 +70,6 @@ type (
 		Image() []rune
 		Collides(space Space, shape Shape) bool
 		Deleted() bool
-		snapshot() Sprite
 		sprite() *spriteModel
 	}
 
@@ -77,13 +88,31 @@ type (
 		goalState
 	}
 
+	// Wall is a static obstacle, that never moves, and may not be grasped
+	Wall struct {
+		spriteState
+		wallState
+	}
+
+	// state is copy-on-write, where readers load the (immutable) published data without locking, and the writer
+	// must hold mu while modifying next, see begin and commit
 	state struct {
-		plan    PlanConfig
-		mu      sync.RWMutex
-		sprites map[*spriteModel]*spriteModel
-		actors  map[*actorModel]*actorModel
-		cubes   map[*cubeModel]*cubeModel
-		goals   map[*goalModel]*goalModel
+		mu   sync.Mutex
+		data atomic.Pointer[stateData]
+		next *stateData
+	}
+
+	stateData struct {
+		plan      PlanConfig
+		movement  MovementMode
+		inventory int
+		// validateShapes is the simulation's Config.ValidateShapes, see newSpriteShape
+		validateShapes bool
+		sprites        map[*spriteModel]*spriteModel
+		actors         map[*actorModel]*actorModel
+		cubes          map[*cubeModel]*cubeModel
+		goals          map[*goalModel]*goalModel
+		walls          map[*wallModel]*wallModel
 	}
 
 	spriteState struct {
@@ -105,12 +134,18 @@ type (
 		state *state
 		model *goalModel
 	}
+
+	wallState struct {
+		state *state
+		model *wallModel
+	}
 )
 
 var (
 	_ Sprite = Actor{}
 	_ Sprite = Cube{}
 	_ Sprite = Goal{}
+	_ Sprite = Wall{}
 )
 
 // ActorHeldItemReleaseShape will return a Shape modeling where the Sprite (item) would be released, were it held by
@@ -140,7 +175,7 @@ func (s *State) ActorHeldItemReleaseShape(actor Actor, x, y int32, item Sprite)
 		rx, ry = actorHeldItemReleasePosition(x, y, w, rw, rh)
 	)
 
-	return NewSpriteShape(rx, ry, rw, rh)
+	return newSpriteShape(s.validateShapes, rx, ry, rw, rh)
 }
 
 // ValidateShape will return an error if shape is not within the bounds of the space (receiver's SpaceWidth and
@@ -157,22 +192,192 @@ func (s *State) ScreenPosition(x, y int32) (int, int) {
 	return int(x) + baseWidth - spaceWidth, int(y)
 }
 
+func newState() *state {
+	s := new(state)
+	s.data.Store(&stateData{
+		sprites: make(map[*spriteModel]*spriteModel),
+		actors:  make(map[*actorModel]*actorModel),
+		cubes:   make(map[*cubeModel]*cubeModel),
+		goals:   make(map[*goalModel]*goalModel),
+		walls:   make(map[*wallModel]*wallModel),
+	})
+	return s
+}
 func (s *state) State() *State {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	sprites := make(map[Sprite]Sprite, len(s.sprites))
-	for k, v := range s.sprites {
+	d := s.load()
+	sprites := make(map[Sprite]Sprite, len(d.sprites))
+	for k, v := range d.sprites {
 		sprite := s.new(k, v.Owner)
-		sprites[sprite] = sprite.snapshot()
+		sprites[sprite] = d.snapshot(sprite)
 	}
 	return &State{
 		SpaceWidth:     spaceWidth,
 		SpaceHeight:    spaceHeight,
 		PickupDistance: pickupDistance,
+		MovementMode:   d.movement,
+		InventorySize:  d.inventory,
+		validateShapes: d.validateShapes,
 		Sprites:        sprites,
-		PlanConfig:     s.plan,
+		PlanConfig:     d.plan,
+	}
+}
+func (s *state) WouldCollide(sprite Sprite, x, y int32) (Sprite, bool) {
+	d := s.load()
+	key := sprite.sprite()
+	value, ok := d.sprites[key]
+	if !ok || !value.visible() {
+		return nil, false
+	}
+	shape := value.shapeAt(x, y, d.validateShapes)
+	for k, v := range d.sprites {
+		if k != key && v.collides(value.Space, shape) {
+			return s.new(k, v.Owner), true
+		}
+	}
+	return nil, false
+}
+func (s *state) Distance(a, b Sprite) (float64, error) {
+	var (
+		d      = s.load()
+		shapes [2]Shape
+	)
+	for i, sprite := range [...]Sprite{a, b} {
+		if sprite == nil {
+			return 0, fmt.Errorf(`sprite not found`)
+		}
+		value, ok := d.sprites[sprite.sprite()]
+		if !ok {
+			return 0, fmt.Errorf(`sprite not found`)
+		}
+		if !value.visible() {
+			return 0, fmt.Errorf(`sprite not visible`)
+		}
+		shapes[i] = value.Shape
+	}
+	return shapes[0].Distance(shapes[1]), nil
+}
+func (s *state) Snapshot() [][]rune {
+	var (
+		d       = s.load()
+		grid    = make([][]rune, spaceHeight+2)
+		sprites = make([]*spriteModel, 0, len(d.sprites))
+	)
+	for y := range grid {
+		grid[y] = make([]rune, spaceWidth+2)
+		for x := range grid[y] {
+			if y == 0 || y == len(grid)-1 || x == 0 || x == len(grid[y])-1 {
+				grid[y][x] = runeExtra
+			} else {
+				grid[y][x] = ' '
+			}
+		}
+	}
+	for _, v := range d.sprites {
+		if v.visible() {
+			sprites = append(sprites, v)
+		}
+	}
+	// sprites within a layer can't overlap, so this is deterministic
+	slices.SortFunc(sprites, func(a, b *spriteModel) int {
+		if c := cmp.Compare(a.Layer, b.Layer); c != 0 {
+			return c
+		}
+		la, _ := spriteLayer(a.Owner)
+		lb, _ := spriteLayer(b.Owner)
+		return cmp.Compare(la, lb)
+	})
+	for _, sprite := range sprites {
+		sprite.draw(func(x int, y int, mainc rune, _ []rune, _ tcell.Style) {
+			grid[y+1][x-hudWidth+1] = mainc
+		})
+	}
+	return grid
+}
+func (s *state) load() *stateData { return s.data.Load() }
+
+// begin prepares a copy of the published data, to be modified via next, and must be called with mu held
+func (s *state) begin() {
+	d := s.load()
+	s.next = &stateData{
+		plan:           d.plan,
+		movement:       d.movement,
+		inventory:      d.inventory,
+		validateShapes: d.validateShapes,
+		sprites:        make(map[*spriteModel]*spriteModel, len(d.sprites)),
+		actors:         make(map[*actorModel]*actorModel, len(d.actors)),
+		cubes:          make(map[*cubeModel]*cubeModel, len(d.cubes)),
+		goals:          make(map[*goalModel]*goalModel, len(d.goals)),
+		walls:          make(map[*wallModel]*wallModel, len(d.walls)),
+	}
+	for k, v := range d.sprites {
+		s.next.sprites[k] = v
+	}
+	for k, v := range d.actors {
+		s.next.actors[k] = v
+	}
+	for k, v := range d.cubes {
+		s.next.cubes[k] = v
+	}
+	for k, v := range d.goals {
+		s.next.goals[k] = v
+	}
+	for k, v := range d.walls {
+		s.next.walls[k] = v
+	}
+}
+
+// commit publishes the data prepared via begin, and must be called with mu held
+func (s *state) commit() {
+	s.data.Store(s.next)
+	s.next = nil
+}
+
+// snapshot returns a detached copy of sprite (a key) from the receiver's data
+func (d *stateData) snapshot(sprite Sprite) Sprite {
+	switch sprite := sprite.(type) {
+	case Actor:
+		return Actor{spriteState{nil, d.sprite(sprite.spriteState.model)}, actorState{nil, d.actor(sprite.actorState.model)}}
+	case Cube:
+		return Cube{spriteState{nil, d.sprite(sprite.spriteState.model)}, cubeState{nil, d.cube(sprite.cubeState.model)}}
+	case Goal:
+		return Goal{spriteState{nil, d.sprite(sprite.spriteState.model)}, goalState{nil, d.goal(sprite.goalState.model)}}
+	case Wall:
+		return Wall{spriteState{nil, d.sprite(sprite.spriteState.model)}, wallState{nil, d.wall(sprite.wallState.model)}}
+	default:
+		panic(sprite)
+	}
+}
+func (d *stateData) sprite(k *spriteModel) *spriteModel {
+	if v, ok := d.sprites[k]; ok {
+		return v
+	}
+	return k
+}
+func (d *stateData) actor(k *actorModel) *actorModel {
+	if v, ok := d.actors[k]; ok {
+		return v
+	}
+	return k
+}
+func (d *stateData) cube(k *cubeModel) *cubeModel {
+	if v, ok := d.cubes[k]; ok {
+		return v
+	}
+	return k
+}
+func (d *stateData) goal(k *goalModel) *goalModel {
+	if v, ok := d.goals[k]; ok {
+		return v
+	}
+	return k
+}
+func (d *stateData) wall(k *wallModel) *wallModel {
+	if v, ok := d.walls[k]; ok {
+		return v
 	}
+	return k
 }
+
 func (s *state) new(sprite *spriteModel, owner any) Sprite {
 	switch owner := owner.(type) {
 	case *actorModel:
@@ -181,157 +386,103 @@ func (s *state) new(sprite *spriteModel, owner any) Sprite {
 		return Cube{spriteState{s, sprite}, cubeState{s, owner}}
 	case *goalModel:
 		return Goal{spriteState{s, sprite}, goalState{s, owner}}
+	case *wallModel:
+		return Wall{spriteState{s, sprite}, wallState{s, owner}}
 	default:
 		panic(owner)
 	}
 }
 
-func (x Actor) Deleted() bool    { return x.actorState.Deleted() || x.spriteState.Deleted() }
-func (x Actor) snapshot() Sprite { return Actor{x.spriteState.snapshot(), x.actorState.snapshot()} }
+func (x Actor) Deleted() bool { return x.actorState.Deleted() || x.spriteState.Deleted() }
+func (x Cube) Deleted() bool  { return x.cubeState.Deleted() || x.spriteState.Deleted() }
+func (x Goal) Deleted() bool  { return x.goalState.Deleted() || x.spriteState.Deleted() }
+func (x Wall) Deleted() bool  { return x.wallState.Deleted() || x.spriteState.Deleted() }
 
-func (x Cube) Deleted() bool    { return x.cubeState.Deleted() || x.spriteState.Deleted() }
-func (x Cube) snapshot() Sprite { return Cube{x.spriteState.snapshot(), x.cubeState.snapshot()} }
+// AnyCube indicates the criteria is satisfied by any cube, on the goal(s)
+func (x CriteriaKey) AnyCube() bool { return x.Cube == (Cube{}) }
 
-func (x Goal) Deleted() bool    { return x.goalState.Deleted() || x.spriteState.Deleted() }
-func (x Goal) snapshot() Sprite { return Goal{x.spriteState.snapshot(), x.goalState.snapshot()} }
+// AnyGoal indicates the criteria is satisfied by the cube(s) on any goal
+func (x CriteriaKey) AnyGoal() bool { return x.Goal == (Goal{}) }
 
 func (s spriteState) Deleted() bool {
 	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-		if _, ok := s.state.sprites[s.model]; ok {
+		if _, ok := s.state.load().sprites[s.model]; ok {
 			return false
 		}
 	}
 	return true
 }
-func (s spriteState) Shape() Shape { return s.getRLock().Shape }
-func (s spriteState) Space() Space { return s.getRLock().Space }
+func (s spriteState) Shape() Shape { return s.get().Shape }
+func (s spriteState) Space() Space { return s.get().Space }
 func (s spriteState) Velocity() (float64, float64) {
-	v := s.getRLock()
+	v := s.get()
 	return v.DX, v.DY
 }
-func (s spriteState) Stopped() bool { return s.getRLock().Stop }
-func (s spriteState) Image() []rune { return s.getRLock().Image }
+func (s spriteState) Stopped() bool { return s.get().Stop }
+func (s spriteState) Image() []rune { return s.get().Image }
 func (s spriteState) Position() (float64, float64) {
-	v := s.getRLock()
+	v := s.get()
 	return v.X, v.Y
 }
 func (s spriteState) Size() (int32, int32) {
-	v := s.getRLock()
+	v := s.get()
 	return v.Width, v.Height
 }
-func (s spriteState) Collides(space Space, shape Shape) bool {
-	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-	}
-	return s.get().collides(space, shape)
-}
-func (s spriteState) sprite() *spriteModel { return s.model }
-func (s spriteState) snapshot() spriteState {
-	if s.state != nil {
-		return spriteState{nil, s.get()}
-	}
-	return s
-}
+func (s spriteState) Collides(space Space, shape Shape) bool { return s.get().collides(space, shape) }
+func (s spriteState) sprite() *spriteModel                   { return s.model }
 func (s spriteState) get() *spriteModel {
 	if s.state != nil {
-		if v, ok := s.state.sprites[s.model]; ok {
-			return v
-		}
+		return s.state.load().sprite(s.model)
 	}
 	return s.model
 }
-func (s spriteState) getRLock() *spriteModel {
-	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-	}
-	return s.get()
-}
 
 func (s actorState) Deleted() bool {
 	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-		if _, ok := s.state.actors[s.model]; ok {
+		if _, ok := s.state.load().actors[s.model]; ok {
 			return false
 		}
 	}
 	return true
 }
-func (s actorState) Criteria() Criteria { return s.getRLock().Criteria }
-func (s actorState) Keyboard() bool     { return s.getRLock().Keyboard }
-func (s actorState) HeldItem() Sprite   { return s.getRLock().HeldItem }
-func (s actorState) snapshot() actorState {
-	if s.state != nil {
-		return actorState{nil, s.get()}
-	}
-	return s
-}
+func (s actorState) Criteria() Criteria { return s.get().Criteria }
+func (s actorState) Keyboard() bool     { return s.get().Keyboard }
+
+// HeldItem returns the top (most recently grasped) of HeldItems, or nil
+func (s actorState) HeldItem() Sprite { return s.get().heldItem() }
+
+// HeldItems returns the actor's inventory, in the order grasped, see Config.InventorySize
+func (s actorState) HeldItems() []Sprite { return slices.Clone(s.get().HeldItems) }
 func (s actorState) get() *actorModel {
 	if s.state != nil {
-		if v, ok := s.state.actors[s.model]; ok {
-			return v
-		}
+		return s.state.load().actor(s.model)
 	}
 	return s.model
 }
-func (s actorState) getRLock() *actorModel {
-	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-	}
-	return s.get()
-}
 
 func (s cubeState) Deleted() bool {
 	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-		if _, ok := s.state.cubes[s.model]; ok {
+		if _, ok := s.state.load().cubes[s.model]; ok {
 			return false
 		}
 	}
 	return true
 }
-func (s cubeState) snapshot() cubeState {
-	if s.state != nil {
-		return cubeState{nil, s.get()}
-	}
-	return s
-}
-func (s cubeState) get() *cubeModel {
-	if s.state != nil {
-		if v, ok := s.state.cubes[s.model]; ok {
-			return v
-		}
-	}
-	return s.model
-}
 
 func (s goalState) Deleted() bool {
 	if s.state != nil {
-		s.state.mu.RLock()
-		defer s.state.mu.RUnlock()
-		if _, ok := s.state.goals[s.model]; ok {
+		if _, ok := s.state.load().goals[s.model]; ok {
 			return false
 		}
 	}
 	return true
 }
-func (s goalState) snapshot() goalState {
-	if s.state != nil {
-		return goalState{nil, s.get()}
-	}
-	return s
-}
-func (s goalState) get() *goalModel {
+
+func (s wallState) Deleted() bool {
 	if s.state != nil {
-		if v, ok := s.state.goals[s.model]; ok {
-			return v
+		if _, ok := s.state.load().walls[s.model]; ok {
+			return false
 		}
 	}
-	return s.model
+	return true
 }
@@ -1,6 +1,6 @@
 module github.com/joeycumines/go-pabt
 
-go 1.22.1
+go 1.23
 
 require (
 	github.com/gdamore/tcell/v2 v2.1.0
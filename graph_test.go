@@ -27,6 +27,8 @@ type (
 		nodes []*graphNode
 		actor *graphNode
 		goal  []*graphNode
+		// frozen prevents the actor from moving, i.e. all actions will fail
+		frozen bool
 	}
 
 	graphNode struct {
@@ -60,6 +62,38 @@ func newGraphState() (state *graphState) {
 	return
 }
 
+// newGridGraphState initialises a w*h grid with 4-connected nodes, with the actor and goal at opposite corners
+func newGridGraphState(w, h int) (state *graphState) {
+	state = new(graphState)
+	grid := make([][]*graphNode, h)
+	for y := range grid {
+		grid[y] = make([]*graphNode, w)
+		for x := range grid[y] {
+			grid[y][x] = &graphNode{name: fmt.Sprintf(`x%dy%d`, x, y)}
+			state.nodes = append(state.nodes, grid[y][x])
+		}
+	}
+	for y := range grid {
+		for x, node := range grid[y] {
+			if x != 0 {
+				node.links = append(node.links, grid[y][x-1])
+			}
+			if x != w-1 {
+				node.links = append(node.links, grid[y][x+1])
+			}
+			if y != 0 {
+				node.links = append(node.links, grid[y-1][x])
+			}
+			if y != h-1 {
+				node.links = append(node.links, grid[y+1][x])
+			}
+		}
+	}
+	state.actor = grid[0][0]
+	state.goal = []*graphNode{grid[h-1][w-1]}
+	return
+}
+
 func (g *graphState) String() string {
 	var (
 		s strings.Builder
@@ -117,7 +151,7 @@ func (g *graphState) Actions(failed Condition) ([]IAction, error) {
 						effects:    Effects{&simpleEffect{key: "actor", value: failed}},
 						node: attachTreeMeta(bt.New(func([]bt.Node) (bt.Status, error) {
 							// could be a whole subtree or whatever
-							if g.actor != node {
+							if g.frozen || g.actor != node {
 								return bt.Failure, nil
 							}
 							var ok bool
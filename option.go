@@ -0,0 +1,338 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"context"
+	"fmt"
+)
+
+// optionFunc implements Option using a closure
+type optionFunc[T Condition] func(c *config[T]) error
+
+// WithEffectValidator configures a validator for [Effect] values, which will be called for each effect of each
+// candidate [Action], as it is considered for expansion. Any action with an effect that fails validation (e.g. a
+// value that is out of the domain of it's variable) will be pruned, as if it did not achieve the failed condition.
+func WithEffectValidator[T Condition](valid func(effect Effect) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if valid == nil {
+			return fmt.Errorf(`pabt: nil effect validator`)
+		}
+		c.effectValidator = valid
+		return nil
+	})
+}
+
+// WithConditionCheckInterval configures tagged [Condition] values to be evaluated (via [State.Variable] and
+// [Condition.Match]) only once every interval ticks, reusing the previous outcome in between. This trades
+// responsiveness for performance, and is intended for expensive conditions. An interval of 1 disables caching.
+func WithConditionCheckInterval[T Condition](interval int, tagged func(condition T) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if interval < 1 {
+			return fmt.Errorf(`pabt: invalid condition check interval: %d`, interval)
+		}
+		if tagged == nil {
+			return fmt.Errorf(`pabt: nil condition check tagger`)
+		}
+		c.checkInterval = interval
+		c.checkTagged = tagged
+		return nil
+	})
+}
+
+// WithMaxExpansions bounds the number of times the [Plan] may expand the tree (refine a failed condition), without
+// reaching success, after which ticks will fail with [ErrMaxExpansions]. The count is reset each time the [Plan]
+// succeeds.
+func WithMaxExpansions[T Condition](n int) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if n < 1 {
+			return fmt.Errorf(`pabt: invalid max expansions: %d`, n)
+		}
+		c.maxExpansions = n
+		return nil
+	})
+}
+
+// WithMaxDepth bounds the depth (distance from the root of the tree) of the failed conditions the [Plan] may expand,
+// after which ticks will fail with [ErrMaxDepthExceeded]. This is intended as a safety valve, e.g. for [State]
+// implementations with actions that have ever-deeper preconditions.
+func WithMaxDepth[T Condition](d int) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if d < 1 {
+			return fmt.Errorf(`pabt: invalid max depth: %d`, d)
+		}
+		c.maxDepth = d
+		return nil
+	})
+}
+
+// WithContext configures a context, which will be checked prior to each tick of the tree, and prior to each
+// expansion (which calls [State.Actions]), failing the tick with the context's error, once it is done.
+func WithContext[T Condition](ctx context.Context) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if ctx == nil {
+			return fmt.Errorf(`pabt: nil context`)
+		}
+		c.ctx = ctx
+		return nil
+	})
+}
+
+// WithMaxActionsPerCondition limits the number of actions used to refine each failed condition, where candidate
+// actions (from [State.Actions]) will be skipped once n of them have been found to achieve the condition. Note that
+// callers are responsible for ordering the actions by preference. See also [StreamingState], which avoids generating
+// the skipped actions.
+func WithMaxActionsPerCondition[T Condition](n int) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if n < 1 {
+			return fmt.Errorf(`pabt: invalid max actions per condition: %d`, n)
+		}
+		c.maxActions = n
+		return nil
+	})
+}
+
+// WithExpandObserver configures a callback, which will be called for each expansion (refinement of a failed
+// condition), with the failed condition and the actions returned by [State.Actions], prior to modifying the tree.
+func WithExpandObserver[T Condition](observer func(failed T, actions []Action[T])) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if observer == nil {
+			return fmt.Errorf(`pabt: nil expand observer`)
+		}
+		c.expandObserver = observer
+		return nil
+	})
+}
+
+// WithActionsCache enables caching of [State.Actions] results, keyed by the failed [Condition] value, which will be
+// reused for subsequent expansions of the same (equal) condition, until [Plan.Invalidate] is called. This is intended
+// for static or slowly-changing states, and requires that the cached [Action] values may be reused. Conditions that
+// are not comparable won't be cached. Errors are never cached.
+func WithActionsCache[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.cacheActions = true
+		return nil
+	})
+}
+
+// WithCycleDetection enables failing with [ErrNoFeasibleRefinement], rather than continuing to run, when the
+// [Plan] would refine the same failed condition as it previously did, to the same effect, without any action having
+// been ticked in between. Note that this is only suitable if the state is not modified externally, e.g. by other
+// agents, as the cycle may otherwise be a legitimate wait for the state to change.
+func WithCycleDetection[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.detectCycles = true
+		return nil
+	})
+}
+
+// WithNearestFirst configures the [Plan] to refine the failed condition that is nearest to being satisfied first, per
+// [DistanceCondition], rather than the shallowest (breadth-first). Conditions that don't implement
+// [DistanceCondition], or that report a NaN distance, are treated as infinitely distant. Ties are broken using the
+// default, breadth-first, order.
+func WithNearestFirst[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.nearestFirst = true
+		return nil
+	})
+}
+
+// WithValidateVariables configures the [Plan] to call [State.Variable] with the key of each goal [Condition], each
+// time the tree is initialised (including by [New]), failing if any return an error. This surfaces invalid keys (e.g.
+// of the wrong type) at construction, rather than when the condition is first ticked.
+func WithValidateVariables[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.validateVars = true
+		return nil
+	})
+}
+
+// WithMaintain configures the [Plan] to "maintain" the goal, rather than achieve it once, meaning it will return
+// [bt.Running] instead of [bt.Success], while the goal is satisfied. The goal will continue to be evaluated each
+// tick, and the tree refined as normal, should it become unsatisfied, e.g. due to external changes. Any refinements
+// made prior to satisfying the goal are discarded, as they may be stale, e.g. actions planned from prior positions.
+func WithMaintain[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.maintain = true
+		return nil
+	})
+}
+
+// WithActionErrorPolicy configures how errors from [Action.Node] ticks are handled, where the default is
+// [ActionErrorAbort]. Note that errors from other sources, e.g. [State.Variable], are always returned.
+func WithActionErrorPolicy[T Condition](policy ActionErrorPolicy) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		switch policy {
+		case ActionErrorAbort, ActionErrorReplan:
+		default:
+			return fmt.Errorf(`pabt: invalid action error policy: %d`, policy)
+		}
+		c.actionErrors = policy
+		return nil
+	})
+}
+
+// WithTimeline enables recording a [TimelineEntry] for each refinement (expansion) of a failed condition, across
+// all ticks, retrievable via [Plan.Timeline], e.g. to reconstruct how the tree was built, after a run. Note that the
+// timeline grows without bound, until [Plan.Reset] (or [Plan.SetGoal]) is called.
+func WithTimeline[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.timeline = true
+		return nil
+	})
+}
+
+// WithConflictStrategy replaces the check used to resolve conflicts, following each refinement, where returning true
+// indicates that the new subtree must be executed before the prior one, and will result in the new subtree being
+// moved leftward (or upward), ahead of prior. Candidates for prior are checked in tree order, starting with the
+// nearest prior subtree, and resuming from the new position after each move, until there are none remaining. The
+// default strategy is equivalent to [PPAInfo.Conflicts].
+func WithConflictStrategy[T Condition](fn func(new, prior *PPAInfo[T]) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if fn == nil {
+			return fmt.Errorf(`pabt: nil conflict strategy`)
+		}
+		c.conflictOrder = fn
+		return nil
+	})
+}
+
+// WithOrderingConstraint adds a constraint that actions matching before must be executed prior to actions matching
+// after, regardless of whether their effects and conditions conflict. It is checked alongside the conflict strategy
+// (see [WithConflictStrategy]), following each refinement, and will result in the new subtree being moved ahead of a
+// prior one, if any of the new subtree's actions match before, and all of the prior subtree's actions match after.
+// Note that, as subtrees are only ever moved leftward (or upward), a new subtree matching after can't be moved behind
+// a later one matching before, which results in [ErrOrderingConstraint]. This option may be provided multiple times.
+func WithOrderingConstraint[T Condition](before, after func(act Action[T]) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if before == nil || after == nil {
+			return fmt.Errorf(`pabt: nil ordering constraint`)
+		}
+		c.ordering = append(c.ordering, orderingConstraint[T]{before: before, after: after})
+		return nil
+	})
+}
+
+// WithActionSorter configures a less function, used to (stable) sort the actions returned by [State.Actions], prior
+// to refining the failed condition, e.g. to make planning reproducible, where the [State] builds the actions by
+// ranging over a map. Note that the slice returned by [State.Actions] is not modified, and that the sorted actions are
+// what is passed to any [WithExpandObserver] callback, and cached, per [WithActionsCache].
+func WithActionSorter[T Condition](less func(a, b Action[T]) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if less == nil {
+			return fmt.Errorf(`pabt: nil action sorter`)
+		}
+		c.actionSorter = less
+		return nil
+	})
+}
+
+// WithCostGuidedExpansion configures the [Plan] to (stable) sort the actions that may achieve each failed condition
+// by ascending cost, per [CostedAction], prior to adding them to the tree, meaning cheaper actions will be tried
+// first. Actions that don't implement [CostedAction] are treated as having a cost of 0. Note that this is applied
+// after any [WithActionSorter], and prior to any [WithMaxActionsPerCondition] limit.
+func WithCostGuidedExpansion[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.costGuided = true
+		return nil
+	})
+}
+
+// WithTieBreaker configures a function, used to reorder each run of (adjacent) actions with equal cost, per
+// [CostedAction], that may achieve a failed condition, prior to adding them to the tree, e.g. to inject a seeded
+// shuffle, or a domain heuristic. It is applied after any [WithCostGuidedExpansion] sorting, meaning ties are actions
+// with equal cost, and prior to any [WithMaxActionsPerCondition] limit. The function is passed a copy of each run of
+// two or more actions, and must return the same actions, in the desired order.
+func WithTieBreaker[T Condition](fn func(candidates []Action[T]) []Action[T]) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if fn == nil {
+			return fmt.Errorf(`pabt: nil tie breaker`)
+		}
+		c.tieBreaker = fn
+		return nil
+	})
+}
+
+// WithGoalPriority configures a less function, used to (stable) sort the goal [Conditions] by priority, once, by
+// [New], where i and j are indices of the goal as provided to [New]. The goal is modeled as a selector, meaning the
+// highest priority [Conditions] will be evaluated (and refined) first. Note that the goal provided to [New] is not
+// modified.
+func WithGoalPriority[T Condition](less func(i, j int) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if less == nil {
+			return fmt.Errorf(`pabt: nil goal priority`)
+		}
+		c.goalPriority = less
+		return nil
+	})
+}
+
+// WithConflictObserver configures a callback, which will be called each time a conflict is resolved, following a
+// refinement, with the subtree that was moved, and the (conflicting) subtree it was moved ahead of.
+func WithConflictObserver[T Condition](observer func(moved, before *PPAInfo[T])) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if observer == nil {
+			return fmt.Errorf(`pabt: nil conflict observer`)
+		}
+		c.conflictObs = observer
+		return nil
+	})
+}
+
+// WithInvalidate configures a channel, which will be checked (without blocking) prior to each tick, where a receive
+// will discard the tree, re-initialising it from the goal, i.e. a full re-plan. This allows proactive re-planning,
+// e.g. when the state is changed by an external agent, rather than waiting for an action to fail. Note that closing
+// the channel will result in a re-plan on every tick.
+func WithInvalidate[T Condition](ch <-chan struct{}) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if ch == nil {
+			return fmt.Errorf(`pabt: nil invalidate channel`)
+		}
+		c.invalidate = ch
+		return nil
+	})
+}
+
+// WithActionDeduplication configures an equality function, used to skip actions (that may achieve a failed
+// condition) which are equal to an earlier one, prior to adding them to the tree. This is intended to reduce the size
+// of the tree, where the [State] may generate many equivalent actions, noting that the caller is responsible for
+// ensuring that skipping such actions cannot change which goals are reachable.
+func WithActionDeduplication[T Condition](equal func(a, b Action[T]) bool) Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		if equal == nil {
+			return fmt.Errorf(`pabt: nil action equality`)
+		}
+		c.actionEqual = equal
+		return nil
+	})
+}
+
+// WithSubtreeReuse configures the [Plan] to retain the refinements of the tree, when it is discarded due to a stale
+// refinement (i.e. an action failed, without any failed conditions), such that the action subtrees are reused when
+// the same condition is next refined, provided [State.Actions] returned the same candidate actions, per
+// [WithActionDeduplication] (if configured), or otherwise ==. Reused subtrees retain their state, including the node
+// returned by [Action.Node], and the last status of each condition, but not the refinements of their preconditions,
+// which are only reused as each is refined again. This is intended to reduce the cost of replanning large trees, in
+// combination with [WithActionsCache] or [WithActionDeduplication], as [State.Actions] is still called.
+func WithSubtreeReuse[T Condition]() Option[T] {
+	return optionFunc[T](func(c *config[T]) error {
+		c.reuse = true
+		return nil
+	})
+}
+
+func (f optionFunc[T]) applyOption(c *config[T]) error { return f(c) }
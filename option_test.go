@@ -0,0 +1,1445 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"testing"
+)
+
+func failureNode() bt.Node {
+	return bt.New(func([]bt.Node) (bt.Status, error) { return bt.Failure, nil })
+}
+
+func TestWithEffectValidator(t *testing.T) {
+	var (
+		valid = &simpleAction{
+			effects: Effects{&simpleEffect{key: `x`, value: 1}},
+			node:    failureNode(),
+		}
+		invalid = &simpleAction{
+			effects: Effects{&simpleEffect{key: `x`, value: 1}, &simpleEffect{key: `y`, value: -1}},
+			node:    failureNode(),
+		}
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{invalid, valid}, nil
+			},
+		}
+	)
+	plan, err := INew(
+		state,
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithEffectValidator[Condition](func(effect Effect) bool {
+			v, _ := effect.Value().(int)
+			return v >= 0
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if ppa := plan.root.first.ppa; ppa == nil ||
+		len(ppa.actions) != 1 ||
+		len(ppa.actions[0].effects) != 1 ||
+		ppa.actions[0].effects[`x`] != valid.effects[0] {
+		t.Fatal(ppa)
+	}
+}
+
+func TestWithEffectValidator_nil(t *testing.T) {
+	if _, err := INew(&mockState{}, nil, WithEffectValidator[Condition](nil)); err == nil || err.Error() != `pabt: nil effect validator` {
+		t.Error(err)
+	}
+}
+
+func TestWithConditionCheckInterval(t *testing.T) {
+	var (
+		calls = make(map[any]int)
+		x     = 1
+		state = &mockState{
+			variable: func(key any) (any, error) {
+				calls[key]++
+				if key == `x` {
+					return x, nil
+				}
+				return 1, nil
+			},
+			actions: func(failed Condition) ([]IAction, error) { return nil, nil },
+		}
+	)
+	plan, err := INew(
+		state,
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 1}}},
+		WithConditionCheckInterval[Condition](3, func(condition Condition) bool { return condition.Key() == `x` }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+			t.Fatal(i, status, err)
+		}
+	}
+	if calls[`x`] != 4 || calls[`y`] != 10 {
+		t.Fatal(calls)
+	}
+	// the cached outcome is used until the next check
+	x = 2
+	for i := 0; i < 2; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+			t.Fatal(i, status, err)
+		}
+	}
+	if calls[`x`] != 4 {
+		t.Fatal(calls)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if calls[`x`] != 5 {
+		t.Fatal(calls)
+	}
+}
+
+func TestWithConditionCheckInterval_invalid(t *testing.T) {
+	tagged := func(condition Condition) bool { return true }
+	if _, err := INew(&mockState{}, nil, WithConditionCheckInterval[Condition](0, tagged)); err == nil || err.Error() != `pabt: invalid condition check interval: 0` {
+		t.Error(err)
+	}
+	if _, err := INew(&mockState{}, nil, WithConditionCheckInterval[Condition](1, nil)); err == nil || err.Error() != `pabt: nil condition check tagger` {
+		t.Error(err)
+	}
+}
+
+func TestWithMaxExpansions(t *testing.T) {
+	var (
+		calls int
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return []IAction{&simpleAction{
+					conditions: []IConditions{{&simpleCondition{key: fmt.Sprint(`c`, calls), value: 1}}},
+					effects:    Effects{&simpleEffect{key: failed.Key().(string), value: 1}},
+					node:       failureNode(),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithMaxExpansions[Condition](5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status, err := plan.Node().Tick(); err != ErrMaxExpansions || status != bt.Failure {
+		t.Fatal(status, err)
+	}
+	if calls != 5 {
+		t.Fatal(calls)
+	}
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	var (
+		calls int
+		// each action requires a new condition, i.e. the tree grows deeper with each expansion
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return []IAction{&simpleAction{
+					conditions: []IConditions{{&simpleCondition{key: fmt.Sprint(`c`, calls), value: 1}}},
+					effects:    Effects{&simpleEffect{key: failed.Key().(string), value: 1}},
+					node:       failureNode(),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithMaxDepth[Condition](4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expands x (depth 1) then c1 (depth 3)
+	for i := 0; i < 2; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status, err := plan.Node().Tick(); err != ErrMaxDepthExceeded || status != bt.Failure {
+		t.Fatal(status, err)
+	}
+	if calls != 2 {
+		t.Fatal(calls)
+	}
+	cf, ok := plan.root.goal.search()
+	if !ok || cf.condition.Key() != `c2` {
+		t.Fatal(cf, ok)
+	}
+	if depth, ok := cf.root.depth(plan.root); !ok || depth != 5 {
+		t.Fatal(depth, ok)
+	}
+
+	if _, err := INew(state, nil, WithMaxDepth[Condition](0)); err == nil || err.Error() != `pabt: invalid max depth: 0` {
+		t.Error(err)
+	}
+}
+
+func TestWithMaxExpansions_reset(t *testing.T) {
+	var (
+		x     int
+		state = &mockState{
+			variable: func(key any) (any, error) { return x, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						x = 1
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithMaxExpansions[Condition](1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		// discard the tree, to force a re-expansion
+		plan.root = nil
+		x = 0
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+			t.Fatal(i, status, err)
+		}
+		if plan.expansions != 0 {
+			t.Fatal(i, plan.expansions)
+		}
+	}
+}
+
+func TestWithMaxExpansions_invalid(t *testing.T) {
+	if _, err := INew(&mockState{}, nil, WithMaxExpansions[Condition](0)); err == nil || err.Error() != `pabt: invalid max expansions: 0` {
+		t.Error(err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		calls int
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return nil, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithContext[Condition](ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running || calls != 1 {
+		t.Fatal(status, err, calls)
+	}
+	cancel()
+	if status, err := plan.Node().Tick(); err != context.Canceled || status != bt.Failure || calls != 1 {
+		t.Fatal(status, err, calls)
+	}
+	// also before re-initialising
+	plan.root = nil
+	if status, err := plan.Node().Tick(); err != context.Canceled || status != bt.Failure || calls != 1 || plan.root != nil {
+		t.Fatal(status, err, calls)
+	}
+}
+
+func TestWithContext_expand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		calls int
+		state = &mockState{
+			variable: func(key any) (any, error) {
+				// cancelled mid-tick, after evaluating conditions
+				cancel()
+				return 0, nil
+			},
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return nil, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithContext[Condition](ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != context.Canceled || status != bt.Failure || calls != 0 {
+		t.Fatal(status, err, calls)
+	}
+}
+
+func TestWithContext_nil(t *testing.T) {
+	if _, err := INew(&mockState{}, nil, WithContext[Condition](nil)); err == nil || err.Error() != `pabt: nil context` {
+		t.Error(err)
+	}
+}
+
+func TestWithMaxActionsPerCondition(t *testing.T) {
+	var actions []IAction
+	// actions that don't match the post-condition don't count towards the limit
+	actions = append(actions, &simpleAction{
+		effects: Effects{&simpleEffect{key: `x`, value: 2}},
+		node:    failureNode(),
+	})
+	for i := 0; i < 10; i++ {
+		actions = append(actions, &simpleAction{
+			effects: Effects{&simpleEffect{key: `x`, value: 1}},
+			node:    failureNode(),
+		})
+	}
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithMaxActionsPerCondition[Condition](3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	ppa := plan.root.first.ppa
+	if ppa == nil || len(ppa.actions) != 3 {
+		t.Fatal(ppa)
+	}
+	for i, act := range ppa.actions {
+		if act.effects[`x`] != actions[i+1].Effects()[0] {
+			t.Error(i)
+		}
+	}
+	// post-condition then the memorized selector of actions
+	if selector := ppa.post.next; selector == nil || selector.next != nil {
+		t.Fatal(selector)
+	} else {
+		var n int
+		for node := selector.first; node != nil; node = node.next {
+			if node != ppa.actions[n].root {
+				t.Error(n)
+			}
+			n++
+		}
+		if n != 3 {
+			t.Error(n)
+		}
+	}
+}
+
+func TestWithMaxActionsPerCondition_invalid(t *testing.T) {
+	if _, err := INew(&mockState{}, nil, WithMaxActionsPerCondition[Condition](0)); err == nil || err.Error() != `pabt: invalid max actions per condition: 0` {
+		t.Error(err)
+	}
+}
+
+func TestWithActionsCache(t *testing.T) {
+	var (
+		calls int
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node:    failureNode(),
+				}}, nil
+			},
+		}
+		goal = &simpleCondition{key: `x`, value: 1}
+	)
+	plan, err := INew(state, []IConditions{{goal}}, WithActionsCache[Condition]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expand := func(n int) []*action[Condition] {
+		t.Helper()
+		if err := plan.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(status, err)
+		}
+		if calls != n {
+			t.Fatal(calls)
+		}
+		return plan.root.first.ppa.actions
+	}
+	a := expand(1)
+	b := expand(1)
+	if len(a) != 1 || len(b) != 1 || a[0] == b[0] || a[0].effects[`x`] != b[0].effects[`x`] {
+		t.Fatal(a, b)
+	}
+	plan.Invalidate()
+	c := expand(2)
+	if len(c) != 1 || c[0].effects[`x`] == b[0].effects[`x`] {
+		t.Fatal(c)
+	}
+	expand(2)
+	// equal conditions share the cache
+	plan.goal = []IConditions{{&simpleCondition{key: `x`, value: 1}}}
+	expand(3)
+	// errors aren't cached
+	plan.Invalidate()
+	expected := fmt.Errorf(`some error`)
+	state.actions = func(failed Condition) ([]IAction, error) {
+		calls++
+		return nil, expected
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if status, err := plan.Node().Tick(); err != expected || status != bt.Failure {
+			t.Fatal(status, err)
+		}
+	}
+	if calls != 5 {
+		t.Error(calls)
+	}
+}
+
+func benchmarkActionsCache(b *testing.B, opts ...IOption) {
+	state := newGridGraphState(20, 20)
+	state.frozen = true
+	plan, err := INew(state, state.Goal(), opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	node := plan.Node()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := plan.Reset(); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			if _, err := node.Tick(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWithActionsCache_disabled(b *testing.B) { benchmarkActionsCache(b) }
+
+func BenchmarkWithActionsCache_enabled(b *testing.B) {
+	benchmarkActionsCache(b, WithActionsCache[Condition]())
+}
+
+func TestWithExpandObserver(t *testing.T) {
+	var (
+		calls    int
+		observed []string
+		plan     *IPlan
+		state    = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				calls++
+				return []IAction{&simpleAction{
+					conditions: []IConditions{{&simpleCondition{key: fmt.Sprint(`c`, calls), value: 1}}},
+					effects:    Effects{&simpleEffect{key: failed.Key().(string), value: 1}},
+					node:       failureNode(),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(
+		state,
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithExpandObserver[Condition](func(failed Condition, actions []IAction) {
+			// called prior to modifying the tree
+			if cf, ok := plan.root.goal.search(); !ok || cf.condition != failed || cf.root.node == nil {
+				t.Error(cf, ok)
+			}
+			if len(actions) != 1 || actions[0].Effects()[0].Key() != failed.Key() {
+				t.Error(actions)
+			}
+			observed = append(observed, failed.Key().(string))
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+		if len(observed) != i+1 || calls != i+1 {
+			t.Fatal(i, observed, calls)
+		}
+	}
+	if fmt.Sprint(observed) != `[x c1 c2]` {
+		t.Error(observed)
+	}
+}
+
+func TestWithExpandObserver_nil(t *testing.T) {
+	if _, err := INew(&mockState{}, nil, WithExpandObserver[Condition](nil)); err == nil || err.Error() != `pabt: nil expand observer` {
+		t.Error(err)
+	}
+}
+
+type distanceCondition struct {
+	simpleCondition
+	distance float64
+}
+
+func (c *distanceCondition) Distance() float64 { return c.distance }
+
+func TestWithNearestFirst(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Opts     []IOption
+		Expected string
+	}{
+		{`disabled`, nil, `[a b c d]`},
+		{`enabled`, []IOption{WithNearestFirst[Condition]()}, `[c a d b]`},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				keys  []any
+				state = &mockState{
+					variable: func(key any) (any, error) { return 0, nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						if failed.Key() != `a` {
+							return nil, nil
+						}
+						// d is deeper than b, but nearer
+						return []IAction{&simpleAction{
+							conditions: []IConditions{{&distanceCondition{simpleCondition{key: `d`, value: 1}, 0.5}}},
+							effects:    Effects{&simpleEffect{key: `a`, value: 1}},
+							node:       failureNode(),
+						}}, nil
+					},
+				}
+			)
+			plan, err := INew(
+				state,
+				[]IConditions{
+					{&distanceCondition{simpleCondition{key: `a`, value: 1}, 2}},
+					{&simpleCondition{key: `b`, value: 1}},
+					{&distanceCondition{simpleCondition{key: `c`, value: 1}, 1}},
+				},
+				append(tc.Opts, WithExpandObserver[Condition](func(failed Condition, actions []IAction) {
+					keys = append(keys, failed.Key())
+				}))...,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 10; i++ {
+				if status, err := plan.Node().Tick(); err != nil {
+					t.Fatal(err)
+				} else if status != bt.Running {
+					break
+				}
+			}
+			if s := fmt.Sprint(keys); s != tc.Expected {
+				t.Error(s)
+			}
+		})
+	}
+}
+
+func TestWithValidateVariables(t *testing.T) {
+	state := &mockState{variable: func(key any) (any, error) {
+		if key != `x` {
+			return nil, fmt.Errorf(`unknown variable`)
+		}
+		return 0, nil
+	}}
+	if _, err := INew(state, []IConditions{{&simpleCondition{key: `x`}}, {&simpleCondition{key: `y`}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := INew(state, []IConditions{{&simpleCondition{key: `x`}}}, WithValidateVariables[Condition]()); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`}}, {&simpleCondition{key: `y`}}}, WithValidateVariables[Condition]())
+	if err == nil || err.Error() != `pabt: unresolvable goal variable (string, y): unknown variable` || plan != nil {
+		t.Fatal(plan, err)
+	}
+}
+
+func TestWithMaintain(t *testing.T) {
+	var (
+		x       int
+		ticks   int
+		actions int
+		state   = &mockState{
+			variable: func(key any) (any, error) { return x, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				actions++
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						ticks++
+						x = 1
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+		tick = func(plan *IPlan, n int) {
+			t.Helper()
+			for i := 0; i < n; i++ {
+				if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+					t.Fatal(i, status, err)
+				}
+			}
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithMaintain[Condition]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// achieves the goal, then keeps running
+	tick(plan, 5)
+	if x != 1 || ticks != 1 || actions != 1 {
+		t.Fatal(x, ticks, actions)
+	}
+	// disturbed, e.g. by an external agent, and re-achieved, refining a new tree (rather than the stale one)
+	x = 0
+	tick(plan, 5)
+	if x != 1 || ticks != 2 || actions != 2 {
+		t.Fatal(x, ticks, actions)
+	}
+	// the default behavior is to succeed
+	plan, err = INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+}
+
+func TestWithActionErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Opts   []IOption
+		Status bt.Status
+		Err    string
+	}{
+		{`default`, nil, bt.Failure, `some error`},
+		{`abort`, []IOption{WithActionErrorPolicy[Condition](ActionErrorAbort)}, bt.Failure, `some error`},
+		// like any other failed action, the (stale) tree fails, and is discarded
+		{`replan`, []IOption{WithActionErrorPolicy[Condition](ActionErrorReplan)}, bt.Failure, ``},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				x     int
+				ticks int
+				state = &mockState{
+					variable: func(key any) (any, error) { return x, nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						return []IAction{&simpleAction{
+							effects: Effects{&simpleEffect{key: `x`, value: 1}},
+							node: bt.New(func([]bt.Node) (bt.Status, error) {
+								ticks++
+								if ticks == 1 {
+									return bt.Failure, errors.New(`some error`)
+								}
+								x = 1
+								return bt.Success, nil
+							}),
+						}}, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, tc.Opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// refines x
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			// the action errors
+			status, err := plan.Node().Tick()
+			if status != tc.Status || (err == nil) != (tc.Err == ``) || (err != nil && err.Error() != tc.Err) {
+				t.Fatal(status, err)
+			}
+			if tc.Err != `` {
+				if plan.Err() == nil {
+					t.Error(`expected err`)
+				}
+				return
+			}
+			// then re-plans, and succeeds
+			if plan.Phase() != PhasePlanning || plan.Err() != nil {
+				t.Error(plan.Phase())
+			}
+			for i := 0; x != 1; i++ {
+				if i == 3 {
+					t.Fatal(`expected the action to succeed`)
+				}
+				if status, err := plan.Node().Tick(); err != nil || status == bt.Failure {
+					t.Fatal(status, err)
+				}
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Success || ticks != 2 {
+				t.Fatal(status, err, ticks)
+			}
+		})
+	}
+
+	if _, err := INew(&mockState{}, nil, WithActionErrorPolicy[Condition](ActionErrorReplan+1)); err == nil || err.Error() != `pabt: invalid action error policy: 2` {
+		t.Error(err)
+	}
+}
+
+// newConflictPlan returns a plan that has refined x, then y, then z, where the z action requires w=1, which conflicts
+// with both the x and y actions, which set w=0
+func newConflictPlan(t *testing.T, opts ...IOption) *IPlan {
+	t.Helper()
+	plan := newUnrefinedConflictPlan(t, opts...)
+	// refines x, then y, then z (resolving the conflicts)
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	return plan
+}
+
+// newUnrefinedConflictPlan is newConflictPlan, without ticking the plan
+func newUnrefinedConflictPlan(t *testing.T, opts ...IOption) *IPlan {
+	t.Helper()
+	vars := map[any]any{`w`: 0, `x`: 0, `y`: 0, `z`: 0}
+	action := func(conditions []IConditions, effects ...*simpleEffect) IAction {
+		a := &simpleAction{conditions: conditions, node: bt.New(func([]bt.Node) (bt.Status, error) {
+			for _, effect := range effects {
+				vars[effect.key] = effect.value
+			}
+			return bt.Success, nil
+		})}
+		for _, effect := range effects {
+			a.effects = append(a.effects, effect)
+		}
+		return a
+	}
+	actions := map[any]IAction{
+		`w`: action(nil, &simpleEffect{`w`, 1}),
+		`x`: action(nil, &simpleEffect{`x`, 1}, &simpleEffect{`w`, 0}),
+		`y`: action(nil, &simpleEffect{`y`, 1}, &simpleEffect{`w`, 0}),
+		`z`: action([]IConditions{{&simpleCondition{`w`, 1}}}, &simpleEffect{`z`, 1}),
+	}
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return vars[key], nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{actions[failed.Key()]}, nil
+			},
+		},
+		[]IConditions{{&simpleCondition{`x`, 1}, &simpleCondition{`y`, 1}, &simpleCondition{`z`, 1}}},
+		opts...,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func TestWithConflictStrategy(t *testing.T) {
+	order := func(plan *IPlan) (keys []any) {
+		for n := plan.root.first; n != nil; n = n.next {
+			keys = append(keys, n.ppa.post.precondition.condition.Key())
+		}
+		return
+	}
+
+	// by default, z is moved before y, then x, as it conflicts with both
+	if v := fmt.Sprint(order(newConflictPlan(t))); v != `[z x y]` {
+		t.Error(v)
+	}
+
+	// the strategy only considers the conflict with y
+	var calls []string
+	plan := newConflictPlan(t, WithConflictStrategy[Condition](func(new, prior *PPAInfo[Condition]) bool {
+		if len(new.Actions()) != 1 || len(prior.Actions()) != 1 {
+			t.Error(new.Actions(), prior.Actions())
+		}
+		calls = append(calls, fmt.Sprintf(`%v<%v`, new.Condition().Key(), prior.Condition().Key()))
+		return prior.Condition().Key() == `y` && new.Conflicts(prior)
+	}))
+	if v := fmt.Sprint(order(plan)); v != `[x z y]` {
+		t.Error(v)
+	}
+	if v := fmt.Sprint(calls); v != `[y<x z<y z<x]` {
+		t.Error(v)
+	}
+
+	if _, err := INew(&mockState{}, nil, WithConflictStrategy[Condition](nil)); err == nil || err.Error() != `pabt: nil conflict strategy` {
+		t.Error(err)
+	}
+}
+
+func TestWithOrderingConstraint(t *testing.T) {
+	order := func(plan *IPlan) (keys []any) {
+		for n := plan.root.first; n != nil; n = n.next {
+			keys = append(keys, n.ppa.post.precondition.condition.Key())
+		}
+		return
+	}
+	effects := func(key any) func(act IAction) bool {
+		return func(act IAction) bool {
+			for _, effect := range act.Effects() {
+				if effect.Key() == key {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	// x and y don't conflict, but y must precede x, then z is moved before both, as it conflicts with them
+	var moves []string
+	plan := newConflictPlan(t,
+		WithOrderingConstraint[Condition](effects(`y`), effects(`x`)),
+		WithConflictObserver[Condition](func(moved, before *PPAInfo[Condition]) {
+			moves = append(moves, fmt.Sprintf(`%v<%v`, moved.Condition().Key(), before.Condition().Key()))
+		}),
+	)
+	if v := fmt.Sprint(order(plan)); v != `[z y x]` {
+		t.Error(v)
+	}
+	if v := fmt.Sprint(moves); v != `[y<x z<x z<y]` {
+		t.Error(v)
+	}
+
+	// constraints are applied in addition to the conflict strategy
+	plan = newConflictPlan(t,
+		WithConflictStrategy[Condition](func(new, prior *PPAInfo[Condition]) bool { return false }),
+		WithOrderingConstraint[Condition](effects(`z`), effects(`x`)),
+		WithOrderingConstraint[Condition](effects(`y`), effects(`x`)),
+	)
+	if v := fmt.Sprint(order(plan)); v != `[y z x]` {
+		t.Error(v)
+	}
+
+	// the reverse case, x must precede z, but z is moved ahead of x (as they conflict), and can't be moved back
+	plan = newUnrefinedConflictPlan(t, WithOrderingConstraint[Condition](effects(`x`), effects(`z`)))
+	for i := 0; i < 2; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status, err := plan.Node().Tick(); !errors.Is(err, ErrOrderingConstraint) || err.Error() != `pabt: ordering constraint violated: (string) z` || status != bt.Failure {
+		t.Error(status, err)
+	}
+
+	// similarly, z must precede w, but w is refined as a condition of z's action
+	plan = newUnrefinedConflictPlan(t, WithOrderingConstraint[Condition](effects(`z`), effects(`w`)))
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status, err := plan.Node().Tick(); !errors.Is(err, ErrOrderingConstraint) || err.Error() != `pabt: ordering constraint violated: (string) w` || status != bt.Failure {
+		t.Error(status, err)
+	}
+
+	if _, err := INew(&mockState{}, nil, WithOrderingConstraint[Condition](nil, effects(`x`))); err == nil || err.Error() != `pabt: nil ordering constraint` {
+		t.Error(err)
+	}
+}
+
+func TestWithActionSorter(t *testing.T) {
+	var (
+		rank    = make(map[IAction]int)
+		actions []IAction
+	)
+	for _, v := range []int{3, 1, 2, 1, 0} {
+		act := &simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}}, node: failureNode()}
+		rank[act] = v
+		actions = append(actions, act)
+	}
+	original := append([]IAction(nil), actions...)
+	var observed []IAction
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithActionSorter[Condition](func(a, b IAction) bool { return rank[a] < rank[b] }),
+		WithExpandObserver[Condition](func(failed Condition, actions []IAction) { observed = actions }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	var expanded []IAction
+	for _, act := range plan.root.first.ppa.actions {
+		expanded = append(expanded, act.value)
+	}
+	// stable, i.e. the two rank 1 actions retain their relative order
+	expected := []IAction{original[4], original[1], original[3], original[2], original[0]}
+	equal := func(a, b []IAction) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	if !equal(expanded, expected) || !equal(observed, expected) {
+		t.Error(expanded, observed)
+	}
+	if !equal(actions, original) {
+		t.Error(`unexpected modification`)
+	}
+
+	if _, err := INew(&mockState{}, nil, WithActionSorter[Condition](nil)); err == nil || err.Error() != `pabt: nil action sorter` {
+		t.Error(err)
+	}
+}
+
+type costedAction struct {
+	simpleAction
+	cost float64
+}
+
+func (a *costedAction) Cost() float64 { return a.cost }
+
+func TestWithCostGuidedExpansion(t *testing.T) {
+	var actions []IAction
+	for _, cost := range []float64{3, 1, -1, 2} {
+		act := simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}}, node: failureNode()}
+		if cost < 0 {
+			// not costed, treated as 0
+			actions = append(actions, &act)
+		} else {
+			actions = append(actions, &costedAction{simpleAction: act, cost: cost})
+		}
+	}
+	for _, tc := range []struct {
+		Name     string
+		Opts     []IOption
+		Expected []int
+	}{
+		{`default`, nil, []int{0, 1, 2, 3}},
+		{`cost guided`, []IOption{WithCostGuidedExpansion[Condition]()}, []int{2, 1, 3, 0}},
+		{`max actions`, []IOption{WithCostGuidedExpansion[Condition](), WithMaxActionsPerCondition[Condition](2)}, []int{2, 1}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			plan, err := INew(
+				&mockState{
+					variable: func(key any) (any, error) { return 0, nil },
+					actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+				},
+				[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+				tc.Opts...,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			// the children of the (memorized) selector, following the post-condition, in order
+			var order []int
+			for n := plan.root.first.last.first; n != nil; n = n.next {
+				order = append(order, indexOfAction(actions, n.action.value))
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.Expected) {
+				t.Error(order)
+			}
+		})
+	}
+}
+
+func TestWithTieBreaker(t *testing.T) {
+	var actions []IAction
+	for _, cost := range []float64{1, -1, 1, 1, -1} {
+		act := simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}}, node: failureNode()}
+		if cost < 0 {
+			// not costed, treated as 0
+			actions = append(actions, &act)
+		} else {
+			actions = append(actions, &costedAction{simpleAction: act, cost: cost})
+		}
+	}
+	var runs [][]int
+	reverse := WithTieBreaker[Condition](func(candidates []IAction) []IAction {
+		var run []int
+		for _, act := range candidates {
+			run = append(run, indexOfAction(actions, act))
+		}
+		runs = append(runs, run)
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+		return candidates
+	})
+	for _, tc := range []struct {
+		Name     string
+		Opts     []IOption
+		Expected []int
+		Runs     [][]int
+	}{
+		{`default`, nil, []int{0, 1, 2, 3, 4}, nil},
+		{`cost guided`, []IOption{WithCostGuidedExpansion[Condition](), reverse}, []int{4, 1, 3, 2, 0}, [][]int{{1, 4}, {0, 2, 3}}},
+		{`adjacent`, []IOption{reverse}, []int{0, 1, 3, 2, 4}, [][]int{{2, 3}}},
+		{`max actions`, []IOption{WithCostGuidedExpansion[Condition](), reverse, WithMaxActionsPerCondition[Condition](3)}, []int{4, 1, 3}, [][]int{{1, 4}, {0, 2, 3}}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			runs = nil
+			plan, err := INew(
+				&mockState{
+					variable: func(key any) (any, error) { return 0, nil },
+					actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+				},
+				[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+				tc.Opts...,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			var order []int
+			for n := plan.root.first.last.first; n != nil; n = n.next {
+				order = append(order, indexOfAction(actions, n.action.value))
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.Expected) {
+				t.Error(order)
+			}
+			if fmt.Sprint(runs) != fmt.Sprint(tc.Runs) {
+				t.Error(runs)
+			}
+		})
+	}
+
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithTieBreaker[Condition](func(candidates []IAction) []IAction { return candidates[1:] }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); status != bt.Failure || err == nil || err.Error() != `pabt: tie breaker returned 1 of 2 actions` {
+		t.Error(status, err)
+	}
+
+	if _, err := INew(&mockState{}, nil, WithTieBreaker[Condition](nil)); err == nil || err.Error() != `pabt: nil tie breaker` {
+		t.Error(err)
+	}
+}
+
+func indexOfAction(actions []IAction, act IAction) int {
+	for i, v := range actions {
+		if v == act {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestWithGoalPriority(t *testing.T) {
+	var (
+		state = &mockState{variable: func(key any) (any, error) { return 0, nil }}
+		goal  = []IConditions{
+			{&simpleCondition{key: `a`, value: 1}},
+			{&simpleCondition{key: `b`, value: 1}, &simpleCondition{key: `d`, value: 1}},
+			{&simpleCondition{key: `c`, value: 1}},
+		}
+		priority = map[int]int{0: 1, 1: 2, 2: 0}
+	)
+	plan, err := INew(state, goal, WithGoalPriority[Condition](func(i, j int) bool { return priority[i] < priority[j] }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := tickKind(plan.root.tick); v != `Selector` {
+		t.Fatal(v)
+	}
+	var order []string
+	for n := plan.root.first; n != nil; n = n.next {
+		var keys []any
+		for leaf := n.first; leaf != nil; leaf = leaf.next {
+			keys = append(keys, leaf.precondition.condition.Key())
+		}
+		order = append(order, fmt.Sprint(keys))
+	}
+	if v := fmt.Sprint(order); v != `[[c] [a] [b d]]` {
+		t.Error(v)
+	}
+	if goal[0][0].Key() != `a` || goal[2][0].Key() != `c` {
+		t.Error(`unexpected modification`)
+	}
+
+	if _, err := INew(state, goal, WithGoalPriority[Condition](nil)); err == nil || err.Error() != `pabt: nil goal priority` {
+		t.Error(err)
+	}
+}
+
+func TestWithConflictObserver(t *testing.T) {
+	var moves []string
+	newConflictPlan(t, WithConflictObserver[Condition](func(moved, before *PPAInfo[Condition]) {
+		moves = append(moves, fmt.Sprintf(`%v<%v`, moved.Condition().Key(), before.Condition().Key()))
+	}))
+	// z is moved before y, then x
+	if v := fmt.Sprint(moves); v != `[z<y z<x]` {
+		t.Error(v)
+	}
+
+	if _, err := INew(&mockState{}, nil, WithConflictObserver[Condition](nil)); err == nil || err.Error() != `pabt: nil conflict observer` {
+		t.Error(err)
+	}
+}
+
+func TestWithTimeline(t *testing.T) {
+	var (
+		state    = newGraphState()
+		observed []int
+	)
+	plan, err := INew(state, state.Goal(), WithTimeline[Condition](), WithExpandObserver[Condition](func(failed Condition, actions []IAction) {
+		observed = append(observed, len(actions))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ticks int
+	for ; ; ticks++ {
+		status, err := plan.Node().Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == bt.Success {
+			break
+		}
+		if status != bt.Running || ticks > 100 {
+			t.Fatal(ticks, status)
+		}
+	}
+	timeline := plan.Timeline()
+	if stats := plan.Stats(); len(timeline) != stats.Expansions || len(timeline) != len(observed) || len(timeline) < 2 {
+		t.Fatal(timeline, stats, observed)
+	}
+	var conflicts int
+	for i, entry := range timeline {
+		if entry.Key != `actor` || entry.Actions != observed[i] || entry.Tick < 0 || entry.Tick > ticks ||
+			(i != 0 && entry.Tick <= timeline[i-1].Tick) {
+			t.Error(i, entry)
+		}
+		conflicts += entry.Conflicts
+	}
+	if timeline[0].Tick != 0 || conflicts != plan.Stats().ConflictsResolved {
+		t.Error(timeline[0], conflicts)
+	}
+	// a copy is returned
+	timeline[0].Key = nil
+	if plan.Timeline()[0].Key != `actor` {
+		t.Error(plan.Timeline())
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if v := plan.Timeline(); v != nil {
+		t.Error(v)
+	}
+
+	// disabled by default
+	state = newGraphState()
+	plan, err = INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plan.Node().Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if v := plan.Timeline(); v != nil || plan.Stats().Expansions == 0 {
+		t.Error(v)
+	}
+}
+
+func TestWithInvalidate(t *testing.T) {
+	var (
+		ch    = make(chan struct{}, 1)
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node:    bt.New(func([]bt.Node) (bt.Status, error) { return bt.Running, nil }),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithInvalidate[Condition](ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	// note the goal identifies the tree, as nodes may be reused
+	goal := plan.root.goal
+	if plan.root.first.ppa == nil || plan.Phase() != PhaseExecuting {
+		t.Fatal(`expected expanded tree`)
+	}
+	ch <- struct{}{}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if plan.root.goal == goal || plan.Phase() != PhasePlanning {
+		t.Fatal(`expected rebuilt tree`)
+	}
+	// the channel is only checked once per tick
+	goal = plan.root.goal
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if plan.root.goal != goal {
+		t.Error(`unexpected rebuild`)
+	}
+
+	if _, err := INew(state, nil, WithInvalidate[Condition](nil)); err == nil || err.Error() != `pabt: nil invalidate channel` {
+		t.Error(err)
+	}
+}
+
+func TestWithActionDeduplication(t *testing.T) {
+	// actions are identified by the value of their y effect, where equal values are equivalent
+	var actions []IAction
+	for _, y := range []int{1, 2, 1, 3, 2, 1} {
+		actions = append(actions, &simpleAction{
+			effects: Effects{&simpleEffect{key: `x`, value: 1}, &simpleEffect{key: `y`, value: y}},
+			node:    failureNode(),
+		})
+	}
+	y := func(a IAction) any { return a.Effects()[1].Value() }
+	for _, tc := range []struct {
+		Name     string
+		Opts     []IOption
+		Expected []int
+	}{
+		{`default`, nil, []int{0, 1, 2, 3, 4, 5}},
+		{`deduplicated`, []IOption{WithActionDeduplication[Condition](func(a, b IAction) bool { return y(a) == y(b) })}, []int{0, 1, 3}},
+		{`max actions`, []IOption{WithActionDeduplication[Condition](func(a, b IAction) bool { return y(a) == y(b) }), WithMaxActionsPerCondition[Condition](2)}, []int{0, 1}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			plan, err := INew(
+				&mockState{
+					variable: func(key any) (any, error) { return 0, nil },
+					actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+				},
+				[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+				tc.Opts...,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			var wired []int
+			for n := plan.root.first.last.first; n != nil; n = n.next {
+				wired = append(wired, indexOfAction(actions, n.action.value))
+			}
+			if fmt.Sprint(wired) != fmt.Sprint(tc.Expected) {
+				t.Error(wired)
+			}
+		})
+	}
+
+	if _, err := INew(&mockState{}, nil, WithActionDeduplication[Condition](nil)); err == nil || err.Error() != `pabt: nil action equality` {
+		t.Error(err)
+	}
+}
+
+func TestWithSubtreeReuse(t *testing.T) {
+	// x is achieved by a, which requires y, which is achieved by b, neither of which succeed (stale)
+	var (
+		vars = map[any]any{`x`: 0, `y`: 0}
+		b    = &simpleAction{effects: Effects{&simpleEffect{key: `y`, value: 1}}, node: failureNode()}
+		a    = &simpleAction{
+			conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+			effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+			node:       failureNode(),
+		}
+		actions = map[any][]IAction{`x`: {a}, `y`: {b}}
+	)
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return vars[key], nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions[failed.Key()], nil },
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		WithSubtreeReuse[Condition](),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick := func(expected bt.Status) {
+		t.Helper()
+		if status, err := plan.Node().Tick(); err != nil || status != expected {
+			t.Fatal(status, err)
+		}
+	}
+	actionX := func() *action[Condition] { return plan.root.first.ppa.actions[0] }
+	ppaY := func() *ppa[Condition] { return actionX().or[0].and[`y`].root.ppa }
+
+	// refine x then y, then b fails (stale)
+	tick(bt.Running)
+	tick(bt.Running)
+	x1, y1 := actionX(), ppaY().actions[0]
+	tick(bt.Failure)
+
+	// a is reused, without the refinement of y, which is then refined again, reusing b
+	tick(bt.Running)
+	if x2 := actionX(); x1 != x2 || x2.root.goal != plan.root.goal || x2.root.parent != plan.root.first ||
+		x2.or[0].and[`y`].root.node == nil || x2.root.first.next != x2.node || x2.root.last != x2.node {
+		t.Fatal(x1 == x2)
+	}
+	tick(bt.Running)
+	if y2 := ppaY().actions[0]; y1 != y2 || y2.root.goal != plan.root.goal || y2.root.ppa != ppaY() {
+		t.Fatal(y1 == y2)
+	}
+
+	// an equivalent (but not equal) action is not reused
+	a2 := *a
+	actions[`x`] = []IAction{&a2}
+	tick(bt.Failure)
+	tick(bt.Running)
+	if x3 := actionX(); x3 == x1 || x3.value != &a2 {
+		t.Fatal(x3 == x1)
+	}
+}
+
+func TestWithSubtreeReuse_equivalent(t *testing.T) {
+	// the conflict scenario (z is moved before x and y, w is refined within z), but z fails, after w succeeds
+	trace := func(opts ...IOption) (trace []string) {
+		vars := map[any]any{`w`: 0, `x`: 0, `y`: 0, `z`: 0}
+		action := func(conditions []IConditions, fail bool, effects ...*simpleEffect) IAction {
+			a := &simpleAction{conditions: conditions, node: bt.New(func([]bt.Node) (bt.Status, error) {
+				if fail {
+					return bt.Failure, nil
+				}
+				for _, effect := range effects {
+					vars[effect.key] = effect.value
+				}
+				return bt.Success, nil
+			})}
+			for _, effect := range effects {
+				a.effects = append(a.effects, effect)
+			}
+			return a
+		}
+		actions := map[any]IAction{
+			`w`: action(nil, false, &simpleEffect{`w`, 1}),
+			`x`: action(nil, false, &simpleEffect{`x`, 1}, &simpleEffect{`w`, 0}),
+			`y`: action(nil, false, &simpleEffect{`y`, 1}, &simpleEffect{`w`, 0}),
+			`z`: action([]IConditions{{&simpleCondition{`w`, 1}}}, true, &simpleEffect{`z`, 1}),
+		}
+		plan, err := INew(
+			&mockState{
+				variable: func(key any) (any, error) { return vars[key], nil },
+				actions: func(failed Condition) ([]IAction, error) {
+					return []IAction{actions[failed.Key()]}, nil
+				},
+			},
+			[]IConditions{{&simpleCondition{`x`, 1}, &simpleCondition{`y`, 1}, &simpleCondition{`z`, 1}}},
+			opts...,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stale int
+		for i := 0; i < 20; i++ {
+			status, err := plan.Node().Tick()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status == bt.Failure {
+				stale++
+			}
+			trace = append(trace, fmt.Sprint(status, plan.Phase(), vars, replacePointers(plan.Node().String())))
+		}
+		if stale < 2 {
+			t.Error(stale)
+		}
+		return
+	}
+	expected := trace()
+	actual := trace(WithSubtreeReuse[Condition]())
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("tick %d: expected:\n%s\nactual:\n%s", i, expected[i], actual[i])
+		}
+	}
+}
+
+func benchmarkSubtreeReuse(b *testing.B, opts ...IOption) {
+	const n = 50
+	node := newChainPlan(b, n, opts...).Node()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// refines the whole chain, then discards the tree
+		for j := 0; j <= n; j++ {
+			if _, err := node.Tick(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkWithSubtreeReuse_disabled(b *testing.B) { benchmarkSubtreeReuse(b) }
+
+func BenchmarkWithSubtreeReuse_enabled(b *testing.B) {
+	benchmarkSubtreeReuse(b, WithSubtreeReuse[Condition]())
+}
@@ -17,8 +17,66 @@
 package pabt
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	bt "github.com/joeycumines/go-behaviortree"
+	"iter"
+	"sync"
+)
+
+var (
+	// ErrMaxExpansions is returned by the [Plan.Node] tick if a refinement would exceed the limit configured via
+	// [WithMaxExpansions].
+	ErrMaxExpansions = errors.New(`pabt: max expansions exceeded`)
+
+	// ErrNoFeasibleRefinement is returned by the [Plan.Node] tick if the same failed condition would be refined
+	// again, without any action having been ticked, and without the tree having grown since the last time that
+	// condition was refined, i.e. the planner would otherwise cycle (returning Running) forever. This detection
+	// must be enabled via [WithCycleDetection].
+	ErrNoFeasibleRefinement = errors.New(`pabt: no feasible refinement`)
+
+	// ErrDuplicateEffectKey is returned (wrapped, with the key) when an [Action] has multiple [Effect] values with
+	// the same key.
+	ErrDuplicateEffectKey = errors.New(`pabt: duplicate effect key`)
+
+	// ErrDuplicateConditionKey is returned (wrapped, with the key) when a [Conditions] value has multiple
+	// [Condition] values with the same key.
+	ErrDuplicateConditionKey = errors.New(`pabt: duplicate condition key`)
+
+	// ErrMaxDepthExceeded is returned by the [Plan.Node] tick if a refinement would expand a failed condition
+	// deeper in the tree than the limit configured via [WithMaxDepth].
+	ErrMaxDepthExceeded = errors.New(`pabt: max depth exceeded`)
+
+	// ErrIrreversibleConflict is returned (wrapped, with the key of the refined condition) by the [Plan.Node] tick if
+	// a refinement conflicts with a prior subtree that includes an [IrreversibleAction], which would otherwise be
+	// resolved by reordering.
+	ErrIrreversibleConflict = errors.New(`pabt: irreversible conflict`)
+
+	// ErrOrderingConstraint is returned (wrapped, with the key of the refined condition) by the [Plan.Node] tick if a
+	// refinement would be executed prior to a subtree that an ordering constraint requires it to follow, which can't be
+	// resolved by reordering, see [WithOrderingConstraint].
+	ErrOrderingConstraint = errors.New(`pabt: ordering constraint violated`)
+
+	// ErrContradictoryConditions is returned (wrapped, with both keys) when a [Conditions] value has a pair of
+	// [Condition] values that contradict each other, see [ContradictoryCondition].
+	ErrContradictoryConditions = errors.New(`pabt: contradictory conditions`)
+)
+
+const (
+	// PhasePlanning indicates the tick (re)initialised, expanded, or discarded (for refinement) the tree, and is the
+	// initial phase.
+	PhasePlanning Phase = iota
+	// PhaseExecuting indicates the tick only ticked the existing tree, i.e. conditions and committed actions.
+	PhaseExecuting
+)
+
+const (
+	// ActionErrorAbort returns any error from an [Action.Node] tick from the [Plan.Node] tick, and is the default.
+	ActionErrorAbort ActionErrorPolicy = iota
+	// ActionErrorReplan treats any error from an [Action.Node] tick as [bt.Failure], e.g. for transient errors,
+	// meaning the [Plan] will continue, and refine the tree, as it would for any other failed action.
+	ActionErrorReplan
 )
 
 type (
@@ -36,6 +94,20 @@ type (
 	// IState is an alias for a [State] without a more-specific [Condition] type.
 	IState = State[Condition]
 
+	// StreamingState is an optional extension of [State], which may be used to generate actions lazily, such that
+	// refinement may stop consuming actions early, once enough have been generated to reach the limit, see
+	// [WithMaxActionsPerCondition]. All actions are consumed if there is no limit, or if they may be reordered, e.g.
+	// by [WithActionSorter]. [State.Actions] will not be called, if implemented.
+	StreamingState[T Condition] interface {
+		State[T]
+
+		// ActionsSeq is equivalent to [State.Actions], where the first non-nil error will stop the refinement.
+		ActionsSeq(failed T) iter.Seq2[Action[T], error]
+	}
+
+	// IStreamingState is an alias for a [StreamingState] without a more-specific [Condition] type.
+	IStreamingState = StreamingState[Condition]
+
 	// Action models a templated action to achieve a failed condition.
 	Action[T Condition] interface {
 		// Conditions may be used to indicate that at least one of the returned [Conditions] must match / pass prior to
@@ -58,6 +130,45 @@ type (
 	// IAction is an alias for an [Action] without a more-specific [Condition] type.
 	IAction = Action[Condition]
 
+	// ResourceAction is an optional extension of [Action], which may be used to model shared resources (e.g. a single
+	// charging dock), that at most one action may use at a time. Actions that declare the same resource are treated as
+	// conflicting, during conflict resolution, meaning they will be serialized, even if their effects and conditions
+	// are otherwise compatible.
+	ResourceAction[T Condition] interface {
+		Action[T]
+
+		// Resources returns the (comparable) keys of any resources used by this action.
+		Resources() []any
+	}
+
+	// IResourceAction is an alias for a [ResourceAction] without a more-specific [Condition] type.
+	IResourceAction = ResourceAction[Condition]
+
+	// CostedAction is an optional extension of [Action], which may be used to estimate the cost of performing the
+	// action (e.g. the distance of a move), in order to prefer cheaper actions, see [WithCostGuidedExpansion].
+	CostedAction[T Condition] interface {
+		Action[T]
+
+		// Cost returns the estimated cost of the action, where lower is cheaper.
+		Cost() float64
+	}
+
+	// ICostedAction is an alias for a [CostedAction] without a more-specific [Condition] type.
+	ICostedAction = CostedAction[Condition]
+
+	// IrreversibleAction is an optional extension of [Action], which may be used to indicate that the effects of the
+	// action cannot be undone (e.g. releasing an item into an unreachable position), meaning conflicts with it cannot
+	// be resolved by reordering, and will instead fail the refinement, with [ErrIrreversibleConflict].
+	IrreversibleAction[T Condition] interface {
+		Action[T]
+
+		// Irreversible returns true if the effects of the action cannot be undone.
+		Irreversible() bool
+	}
+
+	// IIrreversibleAction is an alias for an [IrreversibleAction] without a more-specific [Condition] type.
+	IIrreversibleAction = IrreversibleAction[Condition]
+
 	// Variable models a unique variable within the [State], identifiable by means of a comparable key.
 	// The variable mechanism is how [Condition] and [Effect] values interact with the [State].
 	Variable interface {
@@ -70,7 +181,7 @@ type (
 	// Note that values of this type will be passed into [State.Actions] as-is, in order to facilitate handling of
 	// condition and/or failure specific action templating behavior. Failure-specific behavior MAY require stateful
 	// conditions or similar, along with a way to differentiate calls to [Condition.Match] with values from the actual
-	// state ([State.Variable]) vs values from effects ([Effect.Value]).
+	// state ([State.Variable]) vs values from effects ([Effect.Value]), see [ContextualCondition].
 	Condition interface {
 		Variable
 
@@ -79,6 +190,59 @@ type (
 		Match(value any) bool
 	}
 
+	// HysteresisCondition is an optional extension of [Condition], which may be used to prevent oscillation, e.g. due
+	// to minor fluctuations in continuous values, near the boundary of the constraint.
+	HysteresisCondition interface {
+		Condition
+
+		// Retain is used in place of Match, to evaluate values from the actual state ([State.Variable]) while the
+		// condition last passed, and should be a looser constraint than Match (e.g. a greater tolerance).
+		Retain(value any) bool
+	}
+
+	// ContextualCondition is an optional extension of [Condition], which may be used to evaluate values from effects
+	// ([Effect.Value]) differently to values from the actual state, which will continue to use [Condition.Match].
+	ContextualCondition interface {
+		Condition
+
+		// MatchEffect is used in place of Match, to evaluate values from effects, e.g. when checking if an action
+		// achieves the condition, or if it conflicts with another.
+		MatchEffect(value any) bool
+	}
+
+	// GuardCondition is an optional extension of [Condition], which may be used to supply a behavior tree node, to be
+	// used to evaluate the condition against the actual state, in place of [State.Variable] and [Condition.Match].
+	// This allows temporal checks, e.g. polling a sensor over multiple ticks, as the node may return [bt.Running].
+	// The node must return [bt.Success] if the condition passes, or [bt.Failure] if it fails.
+	GuardCondition interface {
+		Condition
+
+		// Guard returns the node used to evaluate the condition, and will be called once per [Condition] value.
+		Guard() bt.Node
+	}
+
+	// DistanceCondition is an optional extension of [Condition], which may be used to estimate how close the
+	// condition is to being satisfied, in order to prioritise the refinement of failed conditions, see
+	// [WithNearestFirst].
+	DistanceCondition interface {
+		Condition
+
+		// Distance returns a non-negative estimate of how far the actual state is from satisfying the condition,
+		// where lower values are nearer. It will be called each time the failed conditions are searched.
+		Distance() float64
+	}
+
+	// ContradictoryCondition is an optional extension of [Condition], which may be used to detect conditions that
+	// can never pass together, e.g. on the same physical quantity, via different (derived) variables. [Conditions]
+	// containing such a pair will be rejected, with [ErrContradictoryConditions], as they could never be satisfied.
+	ContradictoryCondition interface {
+		Condition
+
+		// Contradicts returns true if this condition and other can never both pass, where other is another condition
+		// from the same [Conditions] value. It need only be implemented by one of the pair.
+		Contradicts(other Condition) bool
+	}
+
 	// Effect models the expected changed in value of a state variable for a given action.
 	Effect interface {
 		Variable
@@ -105,13 +269,56 @@ type (
 	// Plan models the planning implementation, see the [New] factory function for initialisation.
 	Plan[T Condition] struct {
 		config[T]
-		root    *node[T]
-		running bool // running due to an Action.Node tick?
+		root     *node[T]
+		running  bool    // running due to an Action.Node tick?
+		phase    Phase   // what the last tick did
+		expanded [][]int // path to each expanded node (at the time), in order, see Plan.Save
+		stats    PlanStats
+		err      error // the last error returned by a tick, see Plan.Err
+		ticks    int   // ticks since the last reset, see TimelineEntry.Tick
 	}
 
 	// IPlan is an alias for a [Plan] without a more-specific [Condition] type.
 	IPlan = Plan[Condition]
 
+	// PlanStats models introspection of a [Plan]'s refinement progress, see [Plan.Stats].
+	PlanStats struct {
+		// Expansions is the total number of expansions (refinements of a failed condition).
+		Expansions int
+		// ConflictsResolved is the total number of conflicts resolved, by moving subtrees.
+		ConflictsResolved int
+		// Nodes is the number of nodes in the current tree.
+		Nodes int
+		// Depth is the maximum depth of the current tree, where a tree with only a root node has a depth of 0.
+		Depth int
+	}
+
+	// TimelineEntry models a single refinement (expansion) of a failed condition, see [WithTimeline].
+	TimelineEntry struct {
+		// Tick is the (zero-based) index of the tick that refined the condition, counting every tick of
+		// [Plan.Node], since the [Plan] was constructed or last reset.
+		Tick int
+		// Key is the key of the refined condition.
+		Key any
+		// Actions is the number of actions that were added to the tree, to achieve the condition.
+		Actions int
+		// Conflicts is the number of conflicts that were resolved, following the refinement.
+		Conflicts int
+	}
+
+	// Phase models what a [Plan] did during it's last tick, see [Plan.Phase].
+	Phase int
+
+	// ActionErrorPolicy models how errors from [Action.Node] ticks are handled, see [WithActionErrorPolicy].
+	ActionErrorPolicy int
+
+	// PPAInfo is a read-only view of a subtree added by refining a failed condition, comprised of the condition
+	// (the post-condition) and the actions that may achieve it, see [WithConflictStrategy]. It must not be retained
+	// beyond the call it was provided to, as the subtree may be discarded.
+	PPAInfo[T Condition] struct {
+		ppa *ppa[T]
+	}
+
 	// Option models a planner configuration option and is used by [New] / option implementations.
 	Option[T Condition] interface {
 		applyOption(c *config[T]) error
@@ -121,8 +328,49 @@ type (
 	IOption = Option[Condition]
 
 	config[T Condition] struct {
-		state State[T]
-		goal  []Conditions[T]
+		state           State[T]
+		goal            []Conditions[T]
+		effectValidator func(effect Effect) bool
+		checkInterval   int
+		checkTagged     func(condition T) bool
+		ctx             context.Context
+		maxExpansions   int
+		maxActions      int
+		expandObserver  func(failed T, actions []Action[T])
+		conflictOrder   func(new, prior *PPAInfo[T]) bool
+		ordering        []orderingConstraint[T]
+		actionSorter    func(a, b Action[T]) bool
+		tieBreaker      func(candidates []Action[T]) []Action[T]
+		goalPriority    func(i, j int) bool
+		conflictObs     func(moved, before *PPAInfo[T])
+		maxDepth        int
+		invalidate      <-chan struct{}
+		actionEqual     func(a, b Action[T]) bool
+		cacheActions    bool
+		detectCycles    bool
+		nearestFirst    bool
+		validateVars    bool
+		maintain        bool
+		timeline        bool
+		actionErrors    ActionErrorPolicy
+		costGuided      bool
+		reuse           bool
+		actionsCache    map[any]cachedActions[T] // see cacheActions
+		expansions      int                      // expansions since the last success, see maxExpansions
+		refined         map[any]int              // condition key to tree size after refinement, see detectCycles
+		ticked          bool                     // an action was ticked since refined was last cleared
+		maintained      bool                     // the goal was satisfied as of the last tick, see maintain
+		reusable        map[any]*ppa[T]          // condition to ppa of the discarded tree, see reuse
+		entries         []TimelineEntry          // see timeline
+		nodes           *sync.Pool               // released nodes, see config.newNode
+
+		simulate func(act Action[T]) bt.Node // replaces the node of each action, see Plan.DryRun
+	}
+
+	// orderingConstraint requires actions matching before to be executed prior to actions matching after, see
+	// WithOrderingConstraint
+	orderingConstraint[T Condition] struct {
+		before, after func(act Action[T]) bool
 	}
 
 	// node is 1-1 with a bt node, with additional embedded metadata and links to handle the traversal behavior
@@ -152,29 +400,47 @@ type (
 	goal[T Condition] struct {
 		root    *node[T]
 		state   State[T]
+		config  *config[T]
 		running *bool
 		or      []*preconditions[T]
+		// failed indexes every precondition that last evaluated to bt.Failure, see precondition.observe
+		failed map[*precondition[T]]struct{}
 	}
 	ppa[T Condition] struct {
-		root    *node[T]
-		post    *node[T]
-		actions []*action[T]
+		root       *node[T]
+		post       *node[T]
+		actions    []*action[T]
+		candidates []Action[T] // considered by expand, in order, see config.reusable
 	}
 	action[T Condition] struct {
-		root    *node[T]
-		node    *node[T]
-		effects map[any]Effect
-		or      []*preconditions[T]
+		value     Action[T]
+		root      *node[T]
+		node      *node[T]
+		effects   map[any]Effect
+		resources []any // distinct, in order
+		or        []*preconditions[T]
 	}
 	preconditions[T Condition] struct {
 		root *node[T]
 		and  map[any]*precondition[T]
+		keys []any // keys of and, in order, for deterministic iteration
+		// status is the last status of the root, only recorded for the goal's (if more than one), see Plan.Progress
+		status bt.Status
 	}
 	precondition[T Condition] struct {
+		// root is the node at the precondition's position in the tree, which is the condition node (that records
+		// status) until expanded, after which it is the ppa root, and the ppa's post node records status, noting
+		// that the node itself (rather than the position) is preserved by expand, and moved as-is by resolve
 		root      *node[T]
 		condition T
 		status    bt.Status
 	}
+
+	// cachedActions is a State.Actions result, see config.actionsCache
+	cachedActions[T Condition] struct {
+		actions []Action[T]
+		index   map[any][]int // see indexEffects
+	}
 )
 
 // INew is an alias for the [New] factory function without a more-specific [Condition] type.
@@ -187,7 +453,7 @@ func INew(state IState, goal []IConditions, opts ...IOption) (*IPlan, error) {
 // [Conditions], at least one of which must eventually match, in order for the planning BT to succeed. An error will be
 // returned for any invalid configuration.
 //
-// WARNING: Mutating the goal after this call may result in undefined behavior.
+// WARNING: Mutating the goal after this call may result in undefined behavior, see [Plan.SetGoal].
 func New[T Condition](
 	state State[T],
 	goal []Conditions[T],
@@ -199,12 +465,16 @@ func New[T Condition](
 	p := Plan[T]{config: config[T]{
 		state: state,
 		goal:  goal,
+		nodes: new(sync.Pool),
 	}}
 	for _, opt := range opts {
 		if err := opt.applyOption(&p.config); err != nil {
 			return nil, err
 		}
 	}
+	if p.goalPriority != nil {
+		p.goal = sortGoal(p.goal, p.goalPriority)
+	}
 	if err := p.init(); err != nil {
 		return nil, err
 	}
@@ -225,32 +495,414 @@ func (p *Plan[T]) Running() bool {
 	return p.running
 }
 
+// Phase returns the [Phase] of the [Plan]'s last tick, i.e. [PhasePlanning] if
+// it (re)initialised, expanded, or discarded the tree, otherwise
+// [PhaseExecuting].
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+// The purpose of this method is to facilitate distinguishing planning
+// (searching) vs executing, e.g. for display purposes.
+func (p *Plan[T]) Phase() Phase {
+	return p.phase
+}
+
+// Reset discards the current tree, including any refinements, re-initialising
+// it from the goal, such that the next tick will start from the unexpanded
+// goal tree. The error is the same as would be returned by [New].
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Reset() error {
+	p.discard()
+	p.reset()
+	return p.init()
+}
+
+// Goal returns a copy of the goal, in priority order, if [WithGoalPriority] was configured.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Goal() []Conditions[T] {
+	goal := make([]Conditions[T], len(p.goal))
+	for i, conditions := range p.goal {
+		goal[i] = append(Conditions[T](nil), conditions...)
+	}
+	return goal
+}
+
+// SetGoal replaces the goal, then resets the [Plan], as per [Plan.Reset], retaining all options, e.g. for an
+// objective that changes over time. Any [WithGoalPriority] will be applied to the new goal (by index). If the new
+// goal is invalid, the error is the same as would be returned by [New], and the [Plan] is left unmodified.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+//
+// WARNING: Mutating the goal after this call may result in undefined behavior.
+func (p *Plan[T]) SetGoal(goal []Conditions[T]) error {
+	if p.goalPriority != nil {
+		goal = sortGoal(goal, p.goalPriority)
+	}
+	var (
+		prev     = p.goal
+		root     = p.root
+		expanded = p.expanded
+	)
+	p.goal = goal
+	if err := p.init(); err != nil {
+		p.goal, p.root, p.expanded = prev, root, expanded
+		return err
+	}
+	if root != nil && !p.reuse {
+		p.release(root)
+	}
+	p.reset()
+	return nil
+}
+
+// reset clears everything accumulated by ticking the tree, except the tree itself, see Plan.Reset
+func (p *Plan[T]) reset() {
+	p.running = false
+	p.phase = PhasePlanning
+	p.expansions = 0
+	p.refined = nil
+	p.ticked = false
+	p.maintained = false
+	p.stats = PlanStats{}
+	p.err = nil
+	p.reusable = nil
+	p.ticks = 0
+	p.entries = nil
+}
+
+// Timeline returns a copy of every refinement since the [Plan] was constructed or last reset, in order, see
+// [WithTimeline], or nil if not enabled.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Timeline() []TimelineEntry {
+	return append([]TimelineEntry(nil), p.entries...)
+}
+
+// Stats returns [PlanStats] for the [Plan], where the counters accumulate
+// across refinements, until [Plan.Reset] is called.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Stats() (stats PlanStats) {
+	stats = p.stats
+	if p.root != nil {
+		p.root.walk(0, func(n *node[T], depth int) {
+			stats.Nodes++
+			if depth > stats.Depth {
+				stats.Depth = depth
+			}
+		})
+	}
+	return
+}
+
+// CountNodes walks the current tree, returning the total number of nodes, the number of leaf nodes, and how many of
+// those leaves are conditions (including post-conditions), and actions, which is intended to support structural
+// assertions, e.g. in tests. All counts will be 0 if the tree has been discarded, pending re-initialisation.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) CountNodes() (total, leaves, conditions, actions int) {
+	if p.root == nil {
+		return
+	}
+	p.root.walk(0, func(n *node[T], _ int) {
+		total++
+		if n.node == nil {
+			return
+		}
+		leaves++
+		switch {
+		case n.precondition != nil:
+			conditions++
+		case n.action != nil && n.action.node == n:
+			actions++
+		}
+	})
+	return
+}
+
+// Actions calls yield with the [Action] of each action node in the current tree, in depth-first (tree) order,
+// stopping if yield returns false, and is compatible with range-over-func. Nothing will be yielded if the tree has
+// been discarded, pending re-initialisation. Note that actions may be yielded more than once, if they were returned
+// by [State.Actions] for multiple conditions.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Actions(yield func(Action[T]) bool) {
+	if p.root == nil {
+		return
+	}
+	stop := false
+	p.root.walk(0, func(n *node[T], _ int) {
+		if !stop && n.action != nil && n.action.node == n {
+			stop = !yield(n.action.value)
+		}
+	})
+}
+
+// Err returns the last error returned by ticking the root [Plan.Node], e.g. from [State.Variable] or
+// [State.Actions], or nil if there has been no such error since the last tick that returned [bt.Success] (or since
+// [Plan.Reset]). This allows planning errors to be distinguished from action failures, without intercepting each tick.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Err() error {
+	return p.err
+}
+
+// Invalidate clears any cached [State.Actions] results, see [WithActionsCache].
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Invalidate() {
+	p.actionsCache = nil
+}
+
+// PendingCondition returns the failed, unexpanded [Condition] that would be refined by the next tick, if the tree
+// were to return [bt.Failure], without modifying the tree. The boolean will be false if there is no such condition,
+// e.g. no condition has been evaluated since the tree was (re-)initialised.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) PendingCondition() (condition T, ok bool) {
+	if p.root == nil {
+		return
+	}
+	var cf *precondition[T]
+	// note the failed index may be pruned, but that doesn't modify the tree
+	if cf, ok = p.root.goal.search(); ok {
+		condition = cf.condition
+	}
+	return
+}
+
+// Satisfied evaluates the goal directly against the [State], via [State.Variable] and [Condition.Match], returning
+// true if all the conditions of any of the goal's [Conditions] pass, without ticking or modifying the tree. This is
+// intended as a cheap check, e.g. prior to ticking a newly-created [Plan], for a goal that is usually already met.
+// Note that any [Conditions] including a [GuardCondition] will never be considered satisfied, as guards may only be
+// evaluated by ticking the tree, and that the evaluation stops at the first error, like ticking the tree would. Like
+// the tree, [HysteresisCondition.Retain] is used in place of [Condition.Match], for goal conditions that passed when
+// last ticked.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Satisfied() (bool, error) {
+	return p.check(p.goal, p.goalPreconditions())
+}
+
+// Progress evaluates the goal [Conditions] currently being pursued directly against the [State], via
+// [State.Variable] and [Condition.Match], returning how many of its conditions pass, out of the total, without ticking
+// or modifying the tree. This is intended as a coarse progress indicator, e.g. "3 of 5 conditions met". The
+// pursued [Conditions] is the first (in priority order, see [WithGoalPriority]) that did not fail the last tick,
+// or, if they all failed, the one containing the condition that was refined as a result. Like [Plan.Satisfied], any
+// [GuardCondition] will never be considered to pass, the evaluation stops at the first error, and hysteresis is
+// applied (see [HysteresisCondition]).
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Progress() (satisfied, total int, err error) {
+	if len(p.goal) == 0 {
+		return
+	}
+	var (
+		pursued    = p.pursued()
+		conditions = p.goal[pursued]
+		tree       = p.goalPreconditions()
+	)
+	for _, condition := range conditions {
+		if _, ok := any(condition).(GuardCondition); ok {
+			continue
+		}
+		var value any
+		value, err = p.state.Variable(condition.Key())
+		if err != nil {
+			return 0, 0, err
+		}
+		if preconditionMatch(tree, pursued, condition, value) {
+			satisfied++
+		}
+	}
+	total = len(conditions)
+	return
+}
+
+// pursued returns the index of the goal Conditions currently being pursued, see Plan.Progress
+func (p *Plan[T]) pursued() int {
+	if p.root == nil || len(p.root.goal.or) < 2 {
+		return 0
+	}
+	or := p.root.goal.or
+	for i, preconditions := range or {
+		if preconditions.status != bt.Failure {
+			return i
+		}
+	}
+	// every Conditions failed, meaning the last tick refined the tree, under the one now being pursued
+	if n := len(p.expanded); n != 0 && len(p.expanded[n-1]) != 0 && p.expanded[n-1][0] < len(or) {
+		return p.expanded[n-1][0]
+	}
+	return 0
+}
+
+// CheckActionConditions evaluates the [Action.Conditions] of the given action directly against the [State], in the
+// same way as [Plan.Satisfied], returning true if there are no conditions, or if all the conditions of any of the
+// [Conditions] pass. This allows checking if an action's guards would currently pass, without ticking it's node.
+// Note that, unlike [Plan.Satisfied], hysteresis is not applied, i.e. [HysteresisCondition.Retain] is never used, as
+// the action need not be part of the tree (which records the last status of each condition).
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) CheckActionConditions(a Action[T]) (bool, error) {
+	return p.check(a.Conditions(), nil)
+}
+
+// check implements Plan.Satisfied and Plan.CheckActionConditions, noting that an empty or is consistent with the
+// tree, which will return success, where tree (if non-nil) is used to apply hysteresis, see preconditionMatch
+func (p *Plan[T]) check(or []Conditions[T], tree []*preconditions[T]) (bool, error) {
+	if len(or) == 0 {
+		return true, nil
+	}
+or:
+	for i, conditions := range or {
+		for _, condition := range conditions {
+			if _, ok := any(condition).(GuardCondition); ok {
+				continue or
+			}
+			value, err := p.state.Variable(condition.Key())
+			if err != nil {
+				return false, err
+			}
+			if !preconditionMatch(tree, i, condition, value) {
+				continue or
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// goalPreconditions returns the preconditions of the goal (1-1 with Plan.goal), or nil if there is no tree
+func (p *Plan[T]) goalPreconditions() []*preconditions[T] {
+	if p.root == nil {
+		return nil
+	}
+	return p.root.goal.or
+}
+
+// preconditionMatch evaluates value against the condition, at index i of the or, like precondition.match, i.e.
+// applying hysteresis if the corresponding precondition (in tree) passed when last evaluated, where tree may be nil
+func preconditionMatch[T Condition](tree []*preconditions[T], i int, condition T, value any) bool {
+	if i < len(tree) {
+		if p := tree[i].and[condition.Key()]; p != nil {
+			return p.match(value)
+		}
+	}
+	return condition.Match(value)
+}
+
 func (p *Plan[T]) init() (err error) {
-	p.root = &node[T]{goal: &goal[T]{state: p.state, running: &p.running}}
+	p.expanded = nil
+	p.root = p.newNode(node[T]{goal: &goal[T]{state: p.state, config: &p.config, running: &p.running}})
 	p.root.goal.root = p.root
 	p.root.goal.or, err = p.root.generateOr(p.goal)
+	if err == nil && p.validateVars {
+		err = p.validateVariables()
+	}
 	if err != nil {
 		p.root = nil
 	}
 	return
 }
+
+// validateVariables checks that the key of each goal condition may be resolved via State.Variable, see
+// WithValidateVariables
+func (p *Plan[T]) validateVariables() error {
+	for _, conditions := range p.goal {
+		for _, condition := range conditions {
+			key := condition.Key()
+			if _, err := p.state.Variable(key); err != nil {
+				return fmt.Errorf(`pabt: unresolvable goal variable (%T, %v): %w`, key, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// discard drops the tree, releasing it's nodes for reuse, unless they may be reused as-is, see WithSubtreeReuse
+func (p *Plan[T]) discard() {
+	if p.root != nil && !p.reuse {
+		p.release(p.root)
+	}
+	p.root = nil
+}
 func (p *Plan[T]) bt() (bt.Tick, []bt.Node) {
+	tickIndex := p.ticks
+	p.ticks++
+	if err := p.ctxErr(); err != nil {
+		return func(children []bt.Node) (bt.Status, error) {
+			p.err = err
+			return bt.Failure, err
+		}, nil
+	}
+	if p.invalidate != nil {
+		select {
+		case <-p.invalidate:
+			p.discard()
+		default:
+		}
+	}
+	if p.maintained {
+		// the tree was refined against the state prior to achieving the goal, and may no longer be valid
+		p.maintained = false
+		p.discard()
+	}
+	phase := PhaseExecuting
 	if p.root == nil {
+		phase = PhasePlanning
 		if err := p.init(); err != nil {
-			return func(children []bt.Node) (bt.Status, error) { return bt.Failure, err }, nil
+			return func(children []bt.Node) (bt.Status, error) {
+				p.phase = phase
+				p.err = err
+				return bt.Failure, err
+			}, nil
 		}
 	}
 	var (
 		node           = p.root
 		tick, children = node.bt()()
 	)
+	if or := node.goal.or; len(or) > 1 && len(or) == len(children) {
+		// record the status of each of the goal's Conditions, see Plan.Progress
+		for i := range children {
+			children[i] = or[i].record(children[i])
+		}
+	}
 	return func(children []bt.Node) (status bt.Status, err error) {
+		defer func() {
+			if err != nil {
+				p.err = err
+			}
+		}()
 		p.running = false
+		p.phase = phase
+		if err = p.ctxErr(); err != nil {
+			status = bt.Failure
+			return
+		}
 		status, err = tick(children)
+		if err == nil && status == bt.Success {
+			p.expansions = 0
+			p.refined = nil
+			p.err = nil
+			p.reusable = nil
+			if p.maintain {
+				// keep monitoring the goal, re-refining the tree if it fails, e.g. due to external changes
+				status = bt.Running
+				p.maintained = true
+			}
+		}
+		if p.ticked {
+			// actions may have changed the state, meaning refinements are not necessarily cyclic
+			p.refined = nil
+			p.ticked = false
+		}
 		if err != nil || status != bt.Failure {
 			return
 		}
-		cf, ok := p.root.search()
+		cf, ok := p.root.goal.search()
 		if !ok {
 			// Relevant excerpt:
 			//
@@ -265,15 +917,87 @@ func (p *Plan[T]) bt() (bt.Tick, []bt.Node) {
 			// in the next loop (Algorithm 5 Line 5). For example, if the robot planned to place the object in a
 			// particular position on the desk but this position was no longer feasible (e.g. another object was
 			// placed in that position by an external agent).
-			p.root = nil
+			if p.reuse {
+				p.reusable = p.root.reusable()
+			}
+			p.discard()
+			p.phase = PhasePlanning
 			return
 		}
+		if p.maxExpansions > 0 && p.expansions >= p.maxExpansions {
+			err = ErrMaxExpansions
+			return
+		}
+		if err = p.ctxErr(); err != nil {
+			return
+		}
+		p.expansions++
+		p.stats.Expansions++
+		p.phase = PhasePlanning
+		p.expanded = append(p.expanded, cf.root.path())
 		err = cf.expand()
 		if err != nil {
 			return
 		}
-		cf.root.ppa.resolve()
+		var conflicts int
+		conflicts, err = cf.root.ppa.resolve()
+		p.stats.ConflictsResolved += conflicts
+		if err != nil {
+			return
+		}
+		if p.timeline {
+			p.entries = append(p.entries, TimelineEntry{
+				Tick:      tickIndex,
+				Key:       cf.condition.Key(),
+				Actions:   len(cf.root.ppa.actions),
+				Conflicts: conflicts,
+			})
+		}
+		if p.detectCycles {
+			if err = p.detectCycle(cf.condition.Key()); err != nil {
+				return
+			}
+		}
 		status = bt.Running
 		return
 	}, children
 }
+
+// detectCycle records the size of the tree following a refinement of the failed condition identified by key,
+// returning ErrNoFeasibleRefinement if the same key was previously refined, and the tree has not grown since.
+// Note that the stale refinement case (an action failing) is not a cycle, and is handled via the ticked flag.
+func (p *Plan[T]) detectCycle(key any) error {
+	var size int
+	p.root.walk(0, func(*node[T], int) { size++ })
+	if last, ok := p.refined[key]; ok && size <= last {
+		return ErrNoFeasibleRefinement
+	}
+	if p.refined == nil {
+		p.refined = make(map[any]int)
+	}
+	p.refined[key] = size
+	return nil
+}
+func (p *Plan[T]) ctxErr() error {
+	if p.ctx != nil {
+		return p.ctx.Err()
+	}
+	return nil
+}
+
+// Condition returns the condition that the subtree achieves, i.e. the refined condition.
+func (x *PPAInfo[T]) Condition() T { return x.ppa.post.precondition.condition }
+
+// Actions returns the actions that may achieve [PPAInfo.Condition], in order, as returned by [State.Actions].
+func (x *PPAInfo[T]) Actions() []Action[T] {
+	actions := make([]Action[T], len(x.ppa.actions))
+	for i, act := range x.ppa.actions {
+		actions[i] = act.value
+	}
+	return actions
+}
+
+// Conflicts returns true if the conditions of the receiver's actions (or the resources they use) conflict with the
+// effects (or resources) of prior's actions, including any actions refining their conditions, which is the default
+// conflict check, see [WithConflictStrategy].
+func (x *PPAInfo[T]) Conflicts(prior *PPAInfo[T]) bool { return x.ppa.conflicts(prior.ppa) }
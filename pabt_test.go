@@ -20,6 +20,9 @@ import (
 	"errors"
 	"fmt"
 	bt "github.com/joeycumines/go-behaviortree"
+	"iter"
+	"math"
+	"math/rand"
 	"regexp"
 	"strings"
 	"testing"
@@ -35,6 +38,15 @@ func (m *mockState) Actions(failed Condition) ([]IAction, error) {
 	return m.actions(failed)
 }
 
+type streamingState struct {
+	mockState
+	actionsSeq func(failed Condition) iter.Seq2[IAction, error]
+}
+
+func (s *streamingState) ActionsSeq(failed Condition) iter.Seq2[IAction, error] {
+	return s.actionsSeq(failed)
+}
+
 func TestNew_nilState(t *testing.T) {
 	p, err := INew(nil, nil)
 	if err == nil || p != nil || err.Error() != `pabt: nil state` {
@@ -197,7 +209,7 @@ func TestNew_initialStructure(t *testing.T) {
 		{
 			Name: `condition key not comparable`,
 			Goal: []IConditions{{&mockCondition{key: func() any { return func() {} }}}},
-			Err:  errors.New(`pabt: invalid conditions`),
+			Err:  errors.New(`pabt: invalid conditions: key 0 of type func() is not comparable`),
 		},
 		{
 			Name: `condition key duplicated`,
@@ -205,7 +217,7 @@ func TestNew_initialStructure(t *testing.T) {
 				&mockCondition{key: func() any { return true }},
 				&mockCondition{key: func() any { return true }},
 			}},
-			Err: errors.New(`pabt: invalid conditions`),
+			Err: errors.New(`pabt: duplicate condition key: (bool) true`),
 		},
 		{
 			Name: `preconditions`,
@@ -305,6 +317,31 @@ func (a *simpleAction) Conditions() []IConditions { return a.conditions }
 func (a *simpleAction) Effects() Effects          { return a.effects }
 func (a *simpleAction) Node() bt.Node             { return a.node }
 
+// Flaky wraps an action such that each tick of its node fails, without ticking the underlying node, with the given
+// probability, using rng, to simulate unreliable actions.
+func Flaky[T Condition](a Action[T], failRate float64, rng *rand.Rand) Action[T] {
+	return &flakyAction[T]{Action: a, failRate: failRate, rng: rng}
+}
+
+type flakyAction[T Condition] struct {
+	Action[T]
+	failRate float64
+	rng      *rand.Rand
+}
+
+func (a *flakyAction[T]) Node() bt.Node {
+	node := a.Action.Node()
+	return func() (bt.Tick, []bt.Node) {
+		tick, children := node()
+		return func(children []bt.Node) (bt.Status, error) {
+			if a.rng.Float64() < a.failRate {
+				return bt.Failure, nil
+			}
+			return tick(children)
+		}, children
+	}
+}
+
 func patchTreeMeta() func() {
 	old := bt.DefaultPrinter
 	bt.DefaultPrinter = bt.TreePrinter{
@@ -323,3 +360,1283 @@ func patchTreeMeta() func() {
 func attachTreeMeta(node bt.Node, meta ...any) bt.Node {
 	return node.WithValue(treeMetaKey{}, meta)
 }
+
+type toleranceCondition struct {
+	key        string
+	value, tol float64
+	retain     bool
+}
+
+func (c *toleranceCondition) Key() any { return c.key }
+func (c *toleranceCondition) Match(value any) bool {
+	return math.Abs(value.(float64)-c.value) <= c.tol
+}
+func (c *toleranceCondition) Retain(value any) bool {
+	if !c.retain {
+		return c.Match(value)
+	}
+	return math.Abs(value.(float64)-c.value) <= c.tol*2
+}
+
+func TestHysteresisCondition(t *testing.T) {
+	for _, tc := range []struct {
+		Name   string
+		Retain bool
+	}{
+		{`without hysteresis`, false},
+		{`with hysteresis`, true},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				values = []float64{0, 0.15, 0.05, 0.15, 0.05, 0.15, 0.05, 0.15}
+				i      int
+				state  = &mockState{
+					variable: func(key any) (any, error) { return values[i], nil },
+					actions:  func(failed Condition) ([]IAction, error) { return nil, nil },
+				}
+			)
+			plan, err := INew(state, []IConditions{{&toleranceCondition{key: `x`, tol: 0.1, retain: tc.Retain}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var oscillated bool
+			for i = range values {
+				status, err := plan.Node().Tick()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if status != bt.Success {
+					oscillated = true
+				}
+			}
+			if oscillated == tc.Retain {
+				t.Error(oscillated)
+			}
+		})
+	}
+	// ... but a value outside the looser constraint still fails
+	var x float64
+	plan, err := INew(&mockState{
+		variable: func(key any) (any, error) { return x, nil },
+		actions:  func(failed Condition) ([]IAction, error) { return nil, nil },
+	}, []IConditions{{&toleranceCondition{key: `x`, tol: 0.1, retain: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+	x = 0.25
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+}
+
+func TestHysteresisCondition_check(t *testing.T) {
+	var (
+		x         float64
+		condition = &toleranceCondition{key: `x`, tol: 0.1, retain: true}
+		action    = &simpleAction{conditions: []IConditions{{condition}}}
+	)
+	plan, err := INew(&mockState{
+		variable: func(key any) (any, error) { return x, nil },
+		actions:  func(failed Condition) ([]IAction, error) { return nil, nil },
+	}, []IConditions{{condition}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(satisfied, progress, actionConditions bool) {
+		t.Helper()
+		if ok, err := plan.Satisfied(); err != nil || ok != satisfied {
+			t.Error(ok, err)
+		}
+		var expected int
+		if progress {
+			expected = 1
+		}
+		if s, n, err := plan.Progress(); err != nil || s != expected || n != 1 {
+			t.Error(s, n, err)
+		}
+		if ok, err := plan.CheckActionConditions(action); err != nil || ok != actionConditions {
+			t.Error(ok, err)
+		}
+	}
+	// not yet ticked, so the stricter Match applies
+	x = 0.15
+	check(false, false, false)
+	x = 0
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+	// passed when last ticked, so Retain applies, except for the action (which isn't part of the tree)
+	x = 0.15
+	check(true, true, false)
+	x = 0.25
+	check(false, false, false)
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	// failed when last ticked, so back to Match
+	x = 0.15
+	check(false, false, false)
+}
+
+// pendingCondition matches a value from an effect that will (eventually) satisfy it, but not the equivalent value
+// from the state, e.g. a request that must still be acknowledged
+type pendingCondition struct{ key string }
+
+func (c *pendingCondition) Key() any                   { return c.key }
+func (c *pendingCondition) Match(value any) bool       { return value == `acknowledged` }
+func (c *pendingCondition) MatchEffect(value any) bool { return value == `requested` }
+
+func TestContextualCondition(t *testing.T) {
+	var (
+		x     any = `idle`
+		ticks int
+		state = &mockState{
+			variable: func(key any) (any, error) { return x, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: `requested`}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						ticks++
+						x = `requested`
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&pendingCondition{key: `x`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the action is only feasible via MatchEffect...
+	for i := 0; ticks == 0; i++ {
+		if i == 3 {
+			t.Fatal(`expected the action to be ticked`)
+		}
+		if _, err := plan.Node().Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ... but the state must still pass Match
+	if ok, err := plan.Satisfied(); err != nil || ok {
+		t.Fatal(ok, err)
+	}
+	x = `acknowledged`
+	if ok, err := plan.Satisfied(); err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	// ... whereas Match alone rejects the action
+	x, ticks = `idle`, 0
+	plan, err = INew(state, []IConditions{{Cond(`x`, (&pendingCondition{}).Match)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status == bt.Success {
+			t.Fatal(i, status, err)
+		}
+	}
+	if ticks != 0 {
+		t.Error(ticks)
+	}
+}
+
+type countingState struct {
+	*graphState
+	actions int
+}
+
+func (c *countingState) Actions(failed Condition) ([]IAction, error) {
+	c.actions++
+	return c.graphState.Actions(failed)
+}
+
+func TestPlan_Phase(t *testing.T) {
+	state := &countingState{graphState: newGraphState()}
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phase := plan.Phase(); phase != PhasePlanning {
+		t.Fatal(phase)
+	}
+	node := plan.Node()
+	phases := make(map[Phase]int)
+	for i := 0; ; i++ {
+		actions := state.actions
+		status, err := node.Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := PhaseExecuting
+		if state.actions != actions {
+			expected = PhasePlanning
+		}
+		if phase := plan.Phase(); phase != expected {
+			t.Fatal(i, status, phase)
+		}
+		phases[plan.Phase()]++
+		if status != bt.Running {
+			if status != bt.Success || plan.Phase() != PhaseExecuting {
+				t.Fatal(i, status, plan.Phase())
+			}
+			break
+		}
+	}
+	if phases[PhasePlanning] == 0 || phases[PhaseExecuting] == 0 {
+		t.Error(phases)
+	}
+	// discarding the tree re-initialises it on the next tick
+	plan.root = nil
+	if status, err := node.Tick(); err != nil || status != bt.Success || plan.Phase() != PhasePlanning {
+		t.Error(status, err, plan.Phase())
+	}
+}
+
+type guardCondition struct {
+	simpleCondition
+	guard bt.Node
+}
+
+func (c *guardCondition) Guard() bt.Node { return c.guard }
+
+func TestGuardCondition(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Outcome  bt.Status
+		Statuses []bt.Status
+	}{
+		{`success`, bt.Success, []bt.Status{bt.Running, bt.Running, bt.Success}},
+		// the failed condition is expanded, which gives the (no actions) running status
+		{`failure`, bt.Failure, []bt.Status{bt.Running, bt.Running, bt.Running}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				polls, actions int
+				condition      = &guardCondition{
+					simpleCondition: simpleCondition{key: `x`, value: 1},
+					guard: bt.New(func([]bt.Node) (bt.Status, error) {
+						polls++
+						if polls < 3 {
+							return bt.Running, nil
+						}
+						return tc.Outcome, nil
+					}),
+				}
+				state = &mockState{
+					variable: func(key any) (any, error) { panic(`unexpected call`) },
+					actions: func(failed Condition) ([]IAction, error) {
+						if failed != condition {
+							t.Error(failed)
+						}
+						actions++
+						return nil, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{condition}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			precondition := plan.root.first.precondition
+			for i, expected := range tc.Statuses {
+				if status, err := plan.Node().Tick(); err != nil || status != expected {
+					t.Fatal(i, status, err)
+				}
+				if status := precondition.status; (i < 2 && status != bt.Running) || (i == 2 && status != tc.Outcome) {
+					t.Fatal(i, status)
+				}
+			}
+			if (tc.Outcome == bt.Failure) != (actions == 1) {
+				t.Error(actions)
+			}
+		})
+	}
+}
+
+func TestGuardCondition_nil(t *testing.T) {
+	if _, err := INew(&mockState{}, []IConditions{{&guardCondition{}}}); err == nil || err.Error() != `pabt: invalid condition guard` {
+		t.Error(err)
+	}
+}
+
+func TestPlan_Reset(t *testing.T) {
+	state := newGraphState()
+	state.frozen = true
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := plan.Node()
+	initial := replacePointers(node.String())
+	for i := 0; i < 3; i++ {
+		if status, err := node.Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if v := replacePointers(node.String()); v == initial {
+		t.Fatal(v)
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if v := replacePointers(node.String()); v != initial {
+		t.Errorf("expected:\n%s\nactual:\n%s", initial, v)
+	}
+	if plan.expansions != 0 || plan.Phase() != PhasePlanning {
+		t.Error(plan.expansions, plan.Phase())
+	}
+	// the reset plan works as normal
+	state.frozen = false
+	for i := 0; ; i++ {
+		status, err := node.Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == bt.Success {
+			break
+		}
+		if status != bt.Running || i > 100 {
+			t.Fatal(i, status)
+		}
+	}
+	if state.actor != state.goal[0] {
+		t.Error(state.actor.name)
+	}
+}
+
+func TestPlan_SetGoal(t *testing.T) {
+	var (
+		vars   = map[any]any{`x`: 0, `y`: 0}
+		failed []any
+		state  = &mockState{
+			variable: func(key any) (any, error) { return vars[key], nil },
+			actions: func(condition Condition) ([]IAction, error) {
+				key := condition.Key().(string)
+				failed = append(failed, key)
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: key, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						vars[key] = 1
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+		x = &simpleCondition{key: `x`, value: 1}
+		y = &simpleCondition{key: `y`, value: 1}
+	)
+	plan, err := INew(state, []IConditions{{x}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// refines x
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+
+	// the goal is copied
+	goal := plan.Goal()
+	if len(goal) != 1 || len(goal[0]) != 1 || goal[0][0] != x {
+		t.Fatal(goal)
+	}
+	goal[0][0] = y
+	if plan.Goal()[0][0] != x {
+		t.Error(plan.Goal())
+	}
+
+	// an invalid goal is rejected, leaving the plan as-is
+	if err := plan.SetGoal([]IConditions{{}}); err == nil || err.Error() != `pabt: invalid conditions` {
+		t.Fatal(err)
+	}
+	if goal := plan.Goal(); len(goal) != 1 || goal[0][0] != x || plan.root.first.ppa == nil {
+		t.Fatal(goal)
+	}
+
+	if err := plan.SetGoal([]IConditions{{y}}); err != nil {
+		t.Fatal(err)
+	}
+	if goal := plan.Goal(); len(goal) != 1 || goal[0][0] != y || plan.Phase() != PhasePlanning || plan.Stats().Expansions != 0 {
+		t.Fatal(goal, plan.Phase(), plan.Stats())
+	}
+	for i := 0; ; i++ {
+		status, err := plan.Node().Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == bt.Success {
+			break
+		}
+		if status != bt.Running || i > 10 {
+			t.Fatal(i, status)
+		}
+	}
+	// only planned toward the new goal
+	if vars[`x`] != 0 || vars[`y`] != 1 || fmt.Sprint(failed) != `[x y]` {
+		t.Error(vars, failed)
+	}
+}
+
+func TestPlan_Reset_err(t *testing.T) {
+	plan, err := INew(&mockState{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan.goal = []IConditions{{}}
+	if err := plan.Reset(); err == nil || err.Error() != `pabt: invalid conditions` || plan.root != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlan_Stats(t *testing.T) {
+	state := &countingState{graphState: newGraphState()}
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := plan.Stats(); stats != (PlanStats{Nodes: 2, Depth: 1}) {
+		t.Fatal(stats)
+	}
+	node := plan.Node()
+	for i := 0; ; i++ {
+		status, err := node.Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == bt.Success {
+			break
+		}
+		if status != bt.Running || i > 100 {
+			t.Fatal(i, status)
+		}
+	}
+	if stats := plan.Stats(); stats.Expansions != state.actions ||
+		stats.Nodes != strings.Count(strings.TrimSpace(node.String()), "\n")+1 ||
+		stats != (PlanStats{Expansions: 9, ConflictsResolved: 0, Nodes: 92, Depth: 10}) {
+		t.Error(stats)
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := plan.Stats(); stats != (PlanStats{Nodes: 2, Depth: 1}) {
+		t.Error(stats)
+	}
+}
+
+func TestPlan_noFeasibleRefinement(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			if failed.Key() != `x` {
+				return nil, nil
+			}
+			// the action's own precondition can never be satisfied
+			return []IAction{&simpleAction{
+				conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+				effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+				node:       failureNode(),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithCycleDetection[Condition]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []bt.Status
+	for i := 0; i < 10; i++ {
+		status, err := plan.Node().Tick()
+		if err != nil {
+			if err != ErrNoFeasibleRefinement || status != bt.Failure {
+				t.Fatal(status, err)
+			}
+			break
+		}
+		statuses = append(statuses, status)
+	}
+	if fmt.Sprint(statuses) != fmt.Sprint([]bt.Status{bt.Running, bt.Running, bt.Failure}) {
+		t.Error(statuses)
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Error(status, err)
+	}
+}
+
+func TestPlan_noFeasibleRefinement_stale(t *testing.T) {
+	var (
+		x, ticks int
+		state    = &mockState{
+			variable: func(key any) (any, error) { return x, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						ticks++
+						if ticks == 1 {
+							// the refinement is no longer valid, e.g. due to an external agent
+							return bt.Failure, nil
+						}
+						x = 1
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithCycleDetection[Condition]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []bt.Status{bt.Running, bt.Failure, bt.Running, bt.Success} {
+		if status, err := plan.Node().Tick(); err != nil || status != expected {
+			t.Fatal(i, status, err)
+		}
+	}
+}
+
+func TestPlan_noFeasibleRefinement_disabled(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			if failed.Key() != `x` {
+				return nil, nil
+			}
+			return []IAction{&simpleAction{
+				conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+				effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+				node:       failureNode(),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// e.g. waiting for an external agent to satisfy y, the plan refines x, then y (which has no actions), then fails
+	// (as the refinement is stale), discarding the tree, and starting over, each cycle
+	for i := 0; i < 9; i++ {
+		expected := bt.Running
+		if i%3 == 2 {
+			expected = bt.Failure
+		}
+		if status, err := plan.Node().Tick(); err != nil || status != expected {
+			t.Fatal(i, status, err)
+		}
+	}
+}
+
+func TestPlan_flakyActions(t *testing.T) {
+	var (
+		rng      = rand.New(rand.NewSource(2))
+		vars     = map[any]any{`y`: 0, `z`: 0}
+		failures int
+		set      = func(key string) bt.Node {
+			return bt.New(func([]bt.Node) (bt.Status, error) {
+				vars[key] = 1
+				return bt.Success, nil
+			})
+		}
+		// counts the ticks of the underlying nodes, to determine how many times the flaky wrapper failed
+		count = func(a IAction) IAction {
+			node := a.Node()
+			return &simpleAction{
+				conditions: a.Conditions(),
+				effects:    a.Effects(),
+				node: func() (bt.Tick, []bt.Node) {
+					tick, children := node()
+					return func(children []bt.Node) (bt.Status, error) {
+						status, err := tick(children)
+						if status == bt.Failure {
+							failures++
+						}
+						return status, err
+					}, children
+				},
+			}
+		}
+		// z requires y, and both actions are unreliable
+		setZ = count(Flaky[Condition](&simpleAction{
+			conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+			effects:    Effects{&simpleEffect{key: `z`, value: 1}},
+			node:       set(`z`),
+		}, 0.5, rng))
+		setY = count(Flaky[Condition](&simpleAction{
+			effects: Effects{&simpleEffect{key: `y`, value: 1}},
+			node:    set(`y`),
+		}, 0.5, rng))
+		state = &mockState{
+			variable: func(key any) (any, error) { return vars[key], nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				switch failed.Key() {
+				case `y`:
+					return []IAction{setY}, nil
+				case `z`:
+					return []IAction{setZ}, nil
+				}
+				return nil, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `z`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status bt.Status
+	for i := 0; i < 100 && status != bt.Success; i++ {
+		if status, err = plan.Node().Tick(); err != nil {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status != bt.Success || vars[`y`] != 1 || vars[`z`] != 1 {
+		t.Fatal(status, vars)
+	}
+	if failures == 0 {
+		t.Fatal(`expected failures`)
+	}
+	// each failure discards the tree, which then requires (at most) one expansion per condition to re-refine
+	if expansions := plan.Stats().Expansions; expansions > 2*(failures+1) {
+		t.Error(expansions, failures)
+	}
+}
+
+func TestPlan_duplicateEffectKey(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			return []IAction{&simpleAction{
+				effects: Effects{&simpleEffect{key: `x`, value: 1}, &simpleEffect{key: `x`, value: 2}},
+				node:    failureNode(),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := plan.Node().Tick()
+	if status != bt.Failure || !errors.Is(err, ErrDuplicateEffectKey) {
+		t.Fatal(status, err)
+	}
+	if err.Error() != `pabt: duplicate effect key: (string) x` {
+		t.Error(err)
+	}
+}
+
+type irreversibleAction struct {
+	simpleAction
+	irreversible bool
+}
+
+func (a *irreversibleAction) Irreversible() bool { return a.irreversible }
+
+func TestPlan_irreversibleConflict(t *testing.T) {
+	for _, irreversible := range []bool{false, true} {
+		t.Run(fmt.Sprint(irreversible), func(t *testing.T) {
+			var (
+				vars    = map[any]any{`w`: 0, `x`: 0, `z`: 0}
+				actions = map[any]IAction{
+					// x sets w=0, which conflicts with z
+					`x`: &irreversibleAction{
+						simpleAction: simpleAction{
+							effects: Effects{&simpleEffect{`x`, 1}, &simpleEffect{`w`, 0}},
+							node: bt.New(func([]bt.Node) (bt.Status, error) {
+								vars[`x`], vars[`w`] = 1, 0
+								return bt.Success, nil
+							}),
+						},
+						irreversible: irreversible,
+					},
+					`z`: &simpleAction{
+						conditions: []IConditions{{&simpleCondition{`w`, 1}}},
+						effects:    Effects{&simpleEffect{`z`, 1}},
+						node:       failureNode(),
+					},
+				}
+				state = &mockState{
+					variable: func(key any) (any, error) { return vars[key], nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						return []IAction{actions[failed.Key()]}, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{&simpleCondition{`x`, 1}, &simpleCondition{`z`, 1}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// refines x
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			// ticks x, then refines z, which conflicts with x
+			status, err := plan.Node().Tick()
+			if !irreversible {
+				if err != nil || status != bt.Running || plan.Stats().ConflictsResolved != 1 {
+					t.Fatal(status, err, plan.Stats())
+				}
+				return
+			}
+			if status != bt.Failure || !errors.Is(err, ErrIrreversibleConflict) {
+				t.Fatal(status, err)
+			}
+			if err.Error() != `pabt: irreversible conflict: (string) z` {
+				t.Error(err)
+			}
+			if plan.Stats().ConflictsResolved != 0 {
+				t.Error(plan.Stats())
+			}
+		})
+	}
+}
+
+func TestNew_duplicateConditionKey(t *testing.T) {
+	state := &mockState{variable: func(key any) (any, error) { return 0, nil }}
+	_, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `x`, value: 2}}})
+	if !errors.Is(err, ErrDuplicateConditionKey) {
+		t.Fatal(err)
+	}
+	if err.Error() != `pabt: duplicate condition key: (string) x` {
+		t.Error(err)
+	}
+}
+
+// signCondition matches the sign of the quantity of, which may be modeled by several (derived) variables
+type signCondition struct {
+	key, of  string
+	positive bool
+}
+
+func (c *signCondition) Key() any             { return c.key }
+func (c *signCondition) Match(value any) bool { return (value.(int) > 0) == c.positive }
+func (c *signCondition) Contradicts(other Condition) bool {
+	o, ok := other.(*signCondition)
+	return ok && o.of == c.of && o.positive != c.positive
+}
+
+func TestNew_contradictoryConditions(t *testing.T) {
+	state := &mockState{variable: func(key any) (any, error) { return 1, nil }}
+	_, err := INew(state, []IConditions{
+		{&signCondition{key: `x`, of: `x`, positive: true}},
+		{&signCondition{key: `x`, of: `x`, positive: true}, &signCondition{key: `dx`, of: `x`, positive: false}},
+	})
+	if !errors.Is(err, ErrContradictoryConditions) {
+		t.Fatal(err)
+	}
+	if err.Error() != `pabt: contradictory conditions: (string) x and (string) dx` {
+		t.Error(err)
+	}
+	if _, err := INew(state, []IConditions{
+		{&signCondition{key: `x`, of: `x`, positive: true}, &signCondition{key: `dx`, of: `x`, positive: true}},
+		{&signCondition{key: `x`, of: `x`, positive: true}, &signCondition{key: `y`, of: `y`, positive: false}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNew_nonComparableConditionKey(t *testing.T) {
+	state := &mockState{variable: func(key any) (any, error) { return 0, nil }}
+	_, err := INew(state, []IConditions{
+		{&simpleCondition{key: `x`, value: 1}},
+		{&simpleCondition{key: `x`, value: 1}, &mockCondition{key: func() any { return []int{1} }}},
+	})
+	if err == nil || err.Error() != `pabt: invalid conditions: key 1 of type []int is not comparable` {
+		t.Fatal(err)
+	}
+}
+
+func TestPlan_PendingCondition(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			return []IAction{&simpleAction{
+				conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+				effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+				node:       failureNode(),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, WithMaxExpansions[Condition](1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condition, ok := plan.PendingCondition(); ok || condition != nil {
+		t.Fatal(condition, ok)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	// y hasn't been evaluated yet
+	if condition, ok := plan.PendingCondition(); ok || condition != nil {
+		t.Fatal(condition, ok)
+	}
+	if status, err := plan.Node().Tick(); err != ErrMaxExpansions || status != bt.Failure {
+		t.Fatal(status, err)
+	}
+	before := plan.Node().String()
+	for i := 0; i < 2; i++ {
+		if condition, ok := plan.PendingCondition(); !ok || condition.Key() != `y` {
+			t.Fatal(i, condition, ok)
+		}
+	}
+	if after := plan.Node().String(); after != before || plan.Stats().Expansions != 1 {
+		t.Errorf("tree modified:\n%s\n%s", before, after)
+	}
+	plan.root = nil
+	if condition, ok := plan.PendingCondition(); ok || condition != nil {
+		t.Error(condition, ok)
+	}
+}
+
+func TestPlan_Err(t *testing.T) {
+	var (
+		varErr = errors.New(`some error`)
+		value  any
+		fail   bool
+		state  = &mockState{
+			variable: func(key any) (any, error) {
+				if fail {
+					return nil, varErr
+				}
+				return value, nil
+			},
+			actions: func(failed Condition) ([]IAction, error) { return nil, nil },
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	fail = true
+	if status, err := plan.Node().Tick(); err != varErr || status != bt.Failure {
+		t.Fatal(status, err)
+	}
+	if err := plan.Err(); err != varErr {
+		t.Fatal(err)
+	}
+	// retained until success
+	fail = false
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if err := plan.Err(); err != varErr {
+		t.Fatal(err)
+	}
+	value = 1
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+	if err := plan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// cleared by reset
+	fail = true
+	if status, err := plan.Node().Tick(); err != varErr || status != bt.Failure || plan.Err() != varErr {
+		t.Fatal(status, err)
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlan_Satisfied(t *testing.T) {
+	var (
+		vars  = map[any]any{`x`: 1, `y`: 2, `z`: 0}
+		state = &mockState{
+			variable: func(key any) (any, error) {
+				if key == `e` {
+					return nil, errors.New(`some error`)
+				}
+				return vars[key], nil
+			},
+			actions: func(failed Condition) ([]IAction, error) {
+				t.Error(`unexpected actions call`)
+				return nil, nil
+			},
+		}
+		guard = &guardCondition{simpleCondition: simpleCondition{key: `x`, value: 1}, guard: bt.New(func([]bt.Node) (bt.Status, error) {
+			t.Error(`unexpected guard tick`)
+			return bt.Success, nil
+		})}
+	)
+	for _, tc := range []struct {
+		Name      string
+		Goal      []IConditions
+		Satisfied bool
+		Err       string
+	}{
+		{`empty`, nil, true, ``},
+		{`match`, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 2}}}, true, ``},
+		{`mismatch`, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `z`, value: 3}}}, false, ``},
+		{`second`, []IConditions{{&simpleCondition{key: `z`, value: 3}}, {&simpleCondition{key: `y`, value: 2}}}, true, ``},
+		{`guard`, []IConditions{{guard}}, false, ``},
+		{`error`, []IConditions{{&simpleCondition{key: `e`, value: 1}}, {&simpleCondition{key: `x`, value: 1}}}, false, `some error`},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			plan, err := INew(state, tc.Goal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			satisfied, err := plan.Satisfied()
+			if satisfied != tc.Satisfied || (err == nil) != (tc.Err == ``) || (err != nil && err.Error() != tc.Err) {
+				t.Fatal(satisfied, err)
+			}
+		})
+	}
+}
+
+func TestPlan_Progress(t *testing.T) {
+	var (
+		vars  = map[any]any{`a`: 0, `b`: 1, `x`: 1, `y`: 2, `z`: 0}
+		state = &mockState{
+			variable: func(key any) (any, error) {
+				if key == `e` {
+					return nil, errors.New(`some error`)
+				}
+				return vars[key], nil
+			},
+			actions: func(failed Condition) ([]IAction, error) {
+				if failed.Key() != `z` {
+					return nil, nil
+				}
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `z`, value: 3}},
+					node:    bt.New(func([]bt.Node) (bt.Status, error) { return bt.Running, nil }),
+				}}, nil
+			},
+		}
+		progress = func(plan *IPlan, satisfied, total int) {
+			t.Helper()
+			if s, n, err := plan.Progress(); err != nil || s != satisfied || n != total {
+				t.Fatal(s, n, err)
+			}
+		}
+	)
+
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 2}, &simpleCondition{key: `z`, value: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress(plan, 2, 3)
+
+	// a cannot be achieved, so z (in the second Conditions) is pursued, once the first Conditions fails
+	plan, err = INew(state, []IConditions{
+		{&simpleCondition{key: `a`, value: 1}, &simpleCondition{key: `b`, value: 1}},
+		{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 2}, &simpleCondition{key: `z`, value: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress(plan, 1, 2)
+	// refines a
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	progress(plan, 1, 2)
+	// refines z, as the a subtree has no actions
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	progress(plan, 2, 3)
+	// ticks the z action
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running || !plan.running {
+		t.Fatal(status, err)
+	}
+	progress(plan, 2, 3)
+	vars[`z`] = 3
+	progress(plan, 3, 3)
+
+	plan, err = INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `e`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, n, err := plan.Progress(); err == nil || err.Error() != `some error` || s != 0 || n != 0 {
+		t.Fatal(s, n, err)
+	}
+	plan, err = INew(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	progress(plan, 0, 0)
+}
+
+func TestPlan_Satisfied_tick(t *testing.T) {
+	var calls int
+	state := &mockState{
+		variable: func(key any) (any, error) {
+			calls++
+			return 1, nil
+		},
+		actions: func(failed Condition) ([]IAction, error) {
+			t.Error(`unexpected actions call`)
+			return nil, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if satisfied, err := plan.Satisfied(); err != nil || !satisfied || calls != 2 {
+		t.Fatal(satisfied, err, calls)
+	}
+	// the tree consists of only the goal conditions, and evaluates them the same way
+	stats := plan.Stats()
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Success || calls != 4 {
+		t.Fatal(status, err, calls)
+	}
+	if v := plan.Stats(); v != stats || v.Nodes != 3 || v.Expansions != 0 {
+		t.Error(v)
+	}
+}
+
+func TestPlan_CountNodes(t *testing.T) {
+	var (
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					conditions: []IConditions{{&simpleCondition{key: `y`, value: 1}}},
+					effects:    Effects{&simpleEffect{key: `x`, value: 1}},
+					node:       failureNode(),
+				}}, nil
+			},
+		}
+		cond1 = &mockCondition{key: func() any { return 1 }}
+		cond2 = &mockCondition{key: func() any { return 2 }}
+		cond3 = &mockCondition{key: func() any { return 3 }}
+	)
+
+	// mirrors the preconditions case of TestNew_initialStructure, i.e. a selector of three sequences
+	plan, err := INew(state, []IConditions{{cond2}, {cond1, cond3}, {cond1, cond3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, leaves, conditions, actions := plan.CountNodes(); total != 9 || leaves != 5 || conditions != 5 || actions != 0 {
+		t.Error(total, leaves, conditions, actions)
+	}
+
+	// the expanded goal is a selector of the post-condition and a sequence of the action's condition and the action
+	plan, err = INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if total, leaves, conditions, actions := plan.CountNodes(); total != 6 || leaves != 3 || conditions != 2 || actions != 1 {
+		t.Error(total, leaves, conditions, actions)
+	}
+
+	plan.root = nil
+	if total, leaves, conditions, actions := plan.CountNodes(); total != 0 || leaves != 0 || conditions != 0 || actions != 0 {
+		t.Error(total, leaves, conditions, actions)
+	}
+}
+
+func TestPlan_Actions(t *testing.T) {
+	plan := newConflictPlan(t)
+	keys := func(limit int) (keys []any) {
+		plan.Actions(func(a IAction) bool {
+			keys = append(keys, a.Effects()[0].Key())
+			return len(keys) != limit
+		})
+		return
+	}
+	// z was moved before x and y, the action for w is not yet wired (w is unexpanded)
+	if v := fmt.Sprint(keys(0)); v != `[z x y]` {
+		t.Error(v)
+	}
+	if v := fmt.Sprint(keys(2)); v != `[z x]` {
+		t.Error(v)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	if v := fmt.Sprint(keys(0)); v != `[w z x y]` {
+		t.Error(v)
+	}
+	plan.discard()
+	if v := keys(0); v != nil {
+		t.Error(v)
+	}
+}
+
+func TestPlan_CheckActionConditions(t *testing.T) {
+	var (
+		vars  = map[any]any{`x`: 1, `y`: 0}
+		state = &mockState{variable: func(key any) (any, error) {
+			if key == `e` {
+				return nil, errors.New(`some error`)
+			}
+			return vars[key], nil
+		}}
+		ticked bool
+		action = func(conditions ...IConditions) IAction {
+			return &simpleAction{
+				conditions: conditions,
+				effects:    Effects{&simpleEffect{key: `z`, value: 1}},
+				node: bt.New(func([]bt.Node) (bt.Status, error) {
+					ticked = true
+					return bt.Success, nil
+				}),
+			}
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `z`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		Name   string
+		Action IAction
+		Pass   bool
+		Err    string
+	}{
+		{`no conditions`, action(), true, ``},
+		{`pass`, action(IConditions{&simpleCondition{key: `x`, value: 1}}), true, ``},
+		{`fail`, action(IConditions{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `y`, value: 1}}), false, ``},
+		{`any`, action(IConditions{&simpleCondition{key: `y`, value: 1}}, IConditions{&simpleCondition{key: `x`, value: 1}}), true, ``},
+		{`error`, action(IConditions{&simpleCondition{key: `e`, value: 1}}), false, `some error`},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			pass, err := plan.CheckActionConditions(tc.Action)
+			if pass != tc.Pass || (err == nil) != (tc.Err == ``) || (err != nil && err.Error() != tc.Err) {
+				t.Error(pass, err)
+			}
+		})
+	}
+	if ticked {
+		t.Error(`unexpected tick`)
+	}
+}
+
+// newChainPlan initialises a plan for a chain of n actions, where each requires the condition achieved by the
+// previous, and the first always fails, i.e. the tree is discarded (as stale) after every n+1 ticks
+func newChainPlan(tb testing.TB, n int, opts ...IOption) *IPlan {
+	tb.Helper()
+	actions := make(map[any][]IAction, n)
+	for i := 1; i <= n; i++ {
+		actions[fmt.Sprint(i)] = []IAction{&simpleAction{
+			conditions: []IConditions{{&simpleCondition{key: fmt.Sprint(i - 1), value: 1}}},
+			effects:    Effects{&simpleEffect{key: fmt.Sprint(i), value: 1}},
+			node:       failureNode(),
+		}}
+	}
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) {
+				if key == `0` {
+					return 1, nil
+				}
+				return 0, nil
+			},
+			actions: func(failed Condition) ([]IAction, error) { return actions[failed.Key()], nil },
+		},
+		[]IConditions{{&simpleCondition{key: fmt.Sprint(n), value: 1}}},
+		opts...,
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return plan
+}
+
+func BenchmarkPlan_staleRefinement(b *testing.B) {
+	node := newChainPlan(b, 50).Node()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := node.Tick(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestStreamingState(t *testing.T) {
+	// yields an action for y, then actions for x (value i), with a duplicate of each, up to n (or unbounded)
+	newAction := func(key string, value int) IAction {
+		return &simpleAction{effects: Effects{&simpleEffect{key: key, value: value}}, node: failureNode()}
+	}
+	equal := func(a, b IAction) bool { return a.Effects()[0] == b.Effects()[0] }
+	for _, tc := range []struct {
+		Name     string
+		Opts     []IOption
+		N        int
+		Consumed int
+		Wired    int
+	}{
+		{`unlimited`, nil, 3, 7, 6},
+		{`limited`, []IOption{WithMaxActionsPerCondition[Condition](2)}, 0, 3, 2},
+		{`limited deduplicated`, []IOption{WithMaxActionsPerCondition[Condition](2), WithActionDeduplication[Condition](equal)}, 0, 4, 2},
+		{`limited sorted`, []IOption{WithMaxActionsPerCondition[Condition](2), WithActionSorter[Condition](func(a, b IAction) bool { return false })}, 3, 7, 2},
+		{`limited cost guided`, []IOption{WithMaxActionsPerCondition[Condition](2), WithCostGuidedExpansion[Condition]()}, 3, 7, 2},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var consumed int
+			state := &streamingState{
+				mockState: mockState{variable: func(key any) (any, error) { return 0, nil }},
+				actionsSeq: func(failed Condition) iter.Seq2[IAction, error] {
+					return func(yield func(IAction, error) bool) {
+						consumed++
+						if !yield(newAction(`y`, 1), nil) {
+							return
+						}
+						for i := 1; tc.N <= 0 || i <= tc.N; i++ {
+							effect := &simpleEffect{key: `x`, value: i}
+							for j := 0; j < 2; j++ {
+								consumed++
+								if !yield(&simpleAction{effects: Effects{effect}, node: failureNode()}, nil) {
+									return
+								}
+							}
+						}
+					}
+				},
+			}
+			plan, err := INew(
+				state,
+				[]IConditions{{&mockCondition{key: func() any { return `x` }, match: func(value any) bool { return value != 0 }}}},
+				tc.Opts...,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			if consumed != tc.Consumed || len(plan.root.first.ppa.actions) != tc.Wired {
+				t.Error(consumed, len(plan.root.first.ppa.actions))
+			}
+		})
+	}
+
+	t.Run(`error`, func(t *testing.T) {
+		expected := errors.New(`some error`)
+		state := &streamingState{
+			mockState: mockState{variable: func(key any) (any, error) { return 0, nil }},
+			actionsSeq: func(failed Condition) iter.Seq2[IAction, error] {
+				return func(yield func(IAction, error) bool) {
+					if yield(newAction(`x`, 1), nil) {
+						yield(nil, expected)
+					}
+				}
+			},
+		}
+		plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, err := plan.Node().Tick(); err != expected || status != bt.Failure {
+			t.Fatal(status, err)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabtgrid_test
+
+import (
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"github.com/joeycumines/go-pabt"
+	"github.com/joeycumines/go-pabt/pabtgrid"
+)
+
+// Example reproduces the graph traversal from Example 7.3 (Fig. 7.6).
+func Example() {
+	links := map[string][]string{
+		`s0`: {`s1`},
+		`s1`: {`s4`, `s3`, `s2`, `s0`},
+		`s2`: {`s5`, `s1`},
+		`s3`: {`sg`, `s4`, `s1`},
+		`s4`: {`s5`, `s3`, `s1`},
+		`s5`: {`sg`, `s4`, `s2`},
+		`sg`: {`s5`, `s3`},
+	}
+
+	state, err := pabtgrid.New(pabtgrid.Config[string]{
+		Neighbours: func(cell string) []string { return links[cell] },
+		Move: func(from, to string) (bool, error) {
+			fmt.Printf("actor %s -> %s\n", from, to)
+			return true, nil
+		},
+	}, `s0`, `sg`)
+	if err != nil {
+		panic(err)
+	}
+
+	plan, err := pabt.INew(state, state.Goal())
+	if err != nil {
+		panic(err)
+	}
+	node := plan.Node()
+
+	status, err := node.Tick()
+	for err == nil && status == bt.Running {
+		status, err = node.Tick()
+	}
+
+	fmt.Printf("status = %s, err = %v, actor = %s\n", status, err, state.Actor())
+
+	// output:
+	// actor s0 -> s1
+	// actor s1 -> s3
+	// actor s3 -> sg
+	// status = success, err = <nil>, actor = sg
+}
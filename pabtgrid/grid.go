@@ -0,0 +1,171 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package pabtgrid implements a generic [pabt.State], modeling a single actor moving between the cells of a
+// discrete graph (e.g. a grid), to reach a goal cell.
+package pabtgrid
+
+import (
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"github.com/joeycumines/go-pabt"
+)
+
+type (
+	// Config models the domain-specific behavior of a [State], where only Neighbours is required.
+	Config[C comparable] struct {
+		// Neighbours must return the cells adjacent to cell, i.e. reachable in a single move, where adjacency must be
+		// symmetric, as the actions to reach a cell are generated from it's neighbours.
+		Neighbours func(cell C) []C
+
+		// Cost may be used to provide the cost of moving from one cell to an adjacent cell, which will be used as the
+		// [pabt.CostedAction.Cost], see [pabt.WithCostGuidedExpansion]. Defaults to 1 for every move.
+		Cost func(from, to C) float64
+
+		// Occupied may be used to indicate cells that can't currently be entered, which won't be planned through,
+		// and moves into which will fail (e.g. if a cell becomes occupied), and therefore be replanned around.
+		Occupied func(cell C) bool
+
+		// Move may be used to perform each move, e.g. to drive an actual actor, where returning false will fail the
+		// move, and an error will be propagated by the [pabt.Plan]. The actor's cell will be updated on success.
+		Move func(from, to C) (bool, error)
+	}
+
+	// State implements [pabt.IState], for a single actor, where the only variable is the actor's cell, identified by
+	// [ActorKey]. It's not safe for concurrent use, and is intended to be accessed only from the ticks of the
+	// [pabt.Plan.Node].
+	State[C comparable] struct {
+		config Config[C]
+		actor  C
+		goal   C
+	}
+
+	// ActorKey is the key of the variable modeling the actor's cell, see [State.Variable].
+	ActorKey struct{}
+
+	// atCondition implements At, noting that it's always used as a pointer, to ensure it's comparable
+	atCondition[C comparable] struct {
+		cell C
+	}
+
+	// moveAction is generated by State.Actions, moving the actor from one cell to another
+	moveAction[C comparable] struct {
+		state      *State[C]
+		from, to   C
+		conditions []pabt.IConditions
+		effects    pabt.Effects
+		node       bt.Node
+	}
+)
+
+var (
+	_ pabt.IState        = (*State[int])(nil)
+	_ pabt.ICostedAction = (*moveAction[int])(nil)
+)
+
+// New initialises a [State], with the actor at start, which must reach goal.
+func New[C comparable](config Config[C], start, goal C) (*State[C], error) {
+	if config.Neighbours == nil {
+		return nil, fmt.Errorf(`pabtgrid: nil neighbours`)
+	}
+	return &State[C]{config: config, actor: start, goal: goal}, nil
+}
+
+// At returns a [pabt.Condition] that matches when the actor is at cell.
+func At[C comparable](cell C) pabt.Condition {
+	return &atCondition[C]{cell: cell}
+}
+
+// Actor returns the actor's current cell.
+func (s *State[C]) Actor() C { return s.actor }
+
+// Goal returns the goal for use with [pabt.INew], i.e. the actor at the goal cell.
+func (s *State[C]) Goal() []pabt.IConditions {
+	return []pabt.IConditions{{At(s.goal)}}
+}
+
+// Variable implements [pabt.State.Variable], supporting only [ActorKey].
+func (s *State[C]) Variable(key any) (any, error) {
+	if key != (ActorKey{}) {
+		return nil, fmt.Errorf(`pabtgrid: invalid key (%T): %v`, key, key)
+	}
+	return s.actor, nil
+}
+
+// Actions implements [pabt.State.Actions], supporting only conditions returned by [At], generating a move to the
+// failed condition's cell from each of it's neighbours, unless it's occupied.
+func (s *State[C]) Actions(failed pabt.Condition) ([]pabt.IAction, error) {
+	cond, ok := failed.(*atCondition[C])
+	if !ok {
+		return nil, fmt.Errorf(`pabtgrid: invalid condition (%T): %v`, failed, failed)
+	}
+	if s.config.Occupied != nil && s.config.Occupied(cond.cell) {
+		return nil, nil
+	}
+	var actions []pabt.IAction
+	for _, from := range s.config.Neighbours(cond.cell) {
+		actions = append(actions, s.newMoveAction(from, cond.cell))
+	}
+	return actions, nil
+}
+
+func (s *State[C]) newMoveAction(from, to C) *moveAction[C] {
+	a := &moveAction[C]{
+		state:      s,
+		from:       from,
+		to:         to,
+		conditions: []pabt.IConditions{{At(from)}},
+		effects:    pabt.Effects{pabt.Eff(ActorKey{}, to)},
+	}
+	a.node = bt.New(a.tick)
+	return a
+}
+
+func (a *moveAction[C]) Conditions() []pabt.IConditions { return a.conditions }
+func (a *moveAction[C]) Effects() pabt.Effects          { return a.effects }
+func (a *moveAction[C]) Node() bt.Node                  { return a.node }
+
+func (a *moveAction[C]) Cost() float64 {
+	if a.state.config.Cost == nil {
+		return 1
+	}
+	return a.state.config.Cost(a.from, a.to)
+}
+
+func (a *moveAction[C]) tick([]bt.Node) (bt.Status, error) {
+	s := a.state
+	if s.actor != a.from || (s.config.Occupied != nil && s.config.Occupied(a.to)) {
+		return bt.Failure, nil
+	}
+	if s.config.Move != nil {
+		if ok, err := s.config.Move(a.from, a.to); err != nil {
+			return bt.Failure, err
+		} else if !ok {
+			return bt.Failure, nil
+		}
+	}
+	s.actor = a.to
+	return bt.Success, nil
+}
+
+func (c *atCondition[C]) Key() any { return ActorKey{} }
+
+func (c *atCondition[C]) Match(value any) bool {
+	v, ok := value.(C)
+	return ok && v == c.cell
+}
+
+func (c *atCondition[C]) String() string { return fmt.Sprintf(`at(%v)`, c.cell) }
@@ -0,0 +1,149 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabtgrid
+
+import (
+	"errors"
+	bt "github.com/joeycumines/go-behaviortree"
+	"github.com/joeycumines/go-pabt"
+	"reflect"
+	"testing"
+)
+
+// newTestGrid returns a config for a w*h 4-connected grid, recording each move
+func newTestGrid(w, h int, moves *[][2]int) Config[[2]int] {
+	return Config[[2]int]{
+		Neighbours: func(cell [2]int) (cells [][2]int) {
+			for _, d := range [...][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				if x, y := cell[0]+d[0], cell[1]+d[1]; x >= 0 && x < w && y >= 0 && y < h {
+					cells = append(cells, [2]int{x, y})
+				}
+			}
+			return
+		},
+		Move: func(from, to [2]int) (bool, error) {
+			*moves = append(*moves, to)
+			return true, nil
+		},
+	}
+}
+
+func runPlan(t *testing.T, state *State[[2]int], opts ...pabt.IOption) {
+	t.Helper()
+	plan, err := pabt.INew(state, state.Goal(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := plan.Node()
+	status, err := node.Tick()
+	for i := 0; err == nil && status == bt.Running; i++ {
+		if i > 100 {
+			t.Fatal(`too many ticks`)
+		}
+		status, err = node.Tick()
+	}
+	if err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+}
+
+func TestNew_nilNeighbours(t *testing.T) {
+	if v, err := New(Config[int]{}, 0, 1); v != nil || err == nil || err.Error() != `pabtgrid: nil neighbours` {
+		t.Fatal(v, err)
+	}
+}
+
+func TestState_Variable(t *testing.T) {
+	state, err := New(Config[int]{Neighbours: func(int) []int { return nil }}, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := state.Variable(ActorKey{}); err != nil || v != 3 {
+		t.Error(v, err)
+	}
+	if v, err := state.Variable(`actor`); err == nil || v != nil {
+		t.Error(v, err)
+	}
+	if v, err := state.Actions(pabt.EqCond(ActorKey{}, 4)); err == nil || v != nil {
+		t.Error(v, err)
+	}
+}
+
+func TestState_occupied(t *testing.T) {
+	var moves [][2]int
+	config := newTestGrid(3, 3, &moves)
+	config.Occupied = func(cell [2]int) bool { return cell == [2]int{1, 0} || cell == [2]int{1, 1} }
+	state, err := New(config, [2]int{0, 0}, [2]int{2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runPlan(t, state)
+	if state.Actor() != [2]int{2, 0} {
+		t.Fatal(state.Actor())
+	}
+	for _, cell := range moves {
+		if config.Occupied(cell) {
+			t.Errorf(`moved into occupied cell %v`, cell)
+		}
+	}
+	if expected := [][2]int{{0, 1}, {0, 2}, {1, 2}, {2, 2}, {2, 1}, {2, 0}}; !reflect.DeepEqual(moves, expected) {
+		t.Errorf("unexpected moves: %v", moves)
+	}
+}
+
+func TestState_cost(t *testing.T) {
+	var moves [][2]int
+	config := newTestGrid(2, 2, &moves)
+	// moving through (1, 0) is expensive
+	config.Cost = func(from, to [2]int) float64 {
+		if from == [2]int{1, 0} || to == [2]int{1, 0} {
+			return 10
+		}
+		return 1
+	}
+	state, err := New(config, [2]int{0, 0}, [2]int{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runPlan(t, state, pabt.WithCostGuidedExpansion[pabt.Condition]())
+	if expected := [][2]int{{0, 1}, {1, 1}}; !reflect.DeepEqual(moves, expected) {
+		t.Errorf("unexpected moves: %v", moves)
+	}
+}
+
+func TestState_moveError(t *testing.T) {
+	expected := errors.New(`some error`)
+	var moves [][2]int
+	config := newTestGrid(2, 1, &moves)
+	config.Move = func(from, to [2]int) (bool, error) { return false, expected }
+	state, err := New(config, [2]int{0, 0}, [2]int{1, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := pabt.INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := plan.Node()
+	status, err := node.Tick()
+	for i := 0; err == nil && status == bt.Running && i < 10; i++ {
+		status, err = node.Tick()
+	}
+	if !errors.Is(err, expected) || state.Actor() != [2]int{0, 0} {
+		t.Fatal(status, err, state.Actor())
+	}
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"encoding/json"
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"io"
+)
+
+// savedPlan is the serialized form of a Plan, see Plan.Save
+type savedPlan struct {
+	// Expanded is the path to each expanded node (at the time), in order
+	Expanded [][]int `json:"expanded"`
+	// Statuses are the last status of each precondition, in depth-first order
+	Statuses []bt.Status `json:"statuses"`
+}
+
+// ILoadPlan is an alias for the [LoadPlan] factory function without a more-specific [Condition] type.
+func ILoadPlan(r io.Reader, state IState, goal []IConditions, opts ...IOption) (*IPlan, error) {
+	return LoadPlan(r, state, goal, opts...)
+}
+
+// LoadPlan constructs a new [Plan] like [New], then restores the tree structure and condition statuses, from data
+// written by [Plan.Save], such that planning resumes from where it left off. The tree is rebuilt by replaying each
+// expansion, meaning the same goal must be provided, and [State.Actions] must return equivalent results, for each
+// expanded condition, as it did for the saved plan.
+func LoadPlan[T Condition](
+	r io.Reader,
+	state State[T],
+	goal []Conditions[T],
+	opts ...Option[T],
+) (*Plan[T], error) {
+	var saved savedPlan
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf(`pabt: invalid saved plan: %w`, err)
+	}
+	p, err := New(state, goal, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.load(&saved); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Save writes the tree structure (in terms of the expanded conditions) and condition statuses, as JSON, for use with
+// [LoadPlan]. Note that the actual behavior tree nodes are not persisted, and are instead rebuilt using the [State].
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Save(w io.Writer) error {
+	var saved savedPlan
+	if p.root != nil {
+		// note expanded is only reset on init, which is deferred if root is nil
+		saved.Expanded = p.expanded
+		p.root.walkPreconditions(func(p *precondition[T]) { saved.Statuses = append(saved.Statuses, p.status) })
+	}
+	return json.NewEncoder(w).Encode(&saved)
+}
+
+func (p *Plan[T]) load(saved *savedPlan) error {
+	for _, path := range saved.Expanded {
+		n := p.root.at(path)
+		if n == nil || n.precondition == nil || n.precondition.root != n {
+			return fmt.Errorf(`pabt: invalid saved plan: no unexpanded condition at %v`, path)
+		}
+		p.expanded = append(p.expanded, path)
+		p.stats.Expansions++
+		if err := n.precondition.expand(); err != nil {
+			return err
+		}
+		conflicts, err := n.ppa.resolve()
+		p.stats.ConflictsResolved += conflicts
+		if err != nil {
+			return err
+		}
+	}
+	var preconditions []*precondition[T]
+	p.root.walkPreconditions(func(p *precondition[T]) { preconditions = append(preconditions, p) })
+	if len(saved.Statuses) != 0 || len(saved.Expanded) != 0 {
+		if len(saved.Statuses) != len(preconditions) {
+			return fmt.Errorf(`pabt: invalid saved plan: expected %d statuses got %d`, len(preconditions), len(saved.Statuses))
+		}
+		for i, status := range saved.Statuses {
+			preconditions[i].status = status
+			preconditions[i].observe(status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"bytes"
+	"fmt"
+	bt "github.com/joeycumines/go-behaviortree"
+	"strings"
+	"testing"
+)
+
+func TestPlan_Save(t *testing.T) {
+	state := newGraphState()
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if len(plan.expanded) < 2 {
+		t.Fatal(plan.expanded)
+	}
+
+	var b bytes.Buffer
+	if err := plan.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ILoadPlan(&b, state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, actual := replacePointers(plan.Node().String()), replacePointers(loaded.Node().String()); expected != actual {
+		t.Fatalf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+	var expected, actual []bt.Status
+	plan.root.walkPreconditions(func(p *precondition[Condition]) { expected = append(expected, p.status) })
+	loaded.root.walkPreconditions(func(p *precondition[Condition]) { actual = append(actual, p.status) })
+	if len(expected) == 0 || len(expected) != len(actual) {
+		t.Fatal(expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatal(expected, actual)
+		}
+	}
+	if a, aOK := plan.root.goal.search(); !aOK {
+		t.Error(a, aOK)
+	} else if b, bOK := loaded.root.goal.search(); !bOK || fmt.Sprint(a.root.path()) != fmt.Sprint(b.root.path()) {
+		t.Error(b, bOK)
+	}
+
+	// continue with the loaded plan
+	for i := 0; ; i++ {
+		status, err := loaded.Node().Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == bt.Success {
+			break
+		}
+		if status != bt.Running || i > 100 {
+			t.Fatal(i, status)
+		}
+	}
+	if state.actor != state.goal[0] {
+		t.Error(state.actor.name)
+	}
+}
+
+func TestPlan_Save_discarded(t *testing.T) {
+	state := newGraphState()
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	plan.root = nil
+	var b bytes.Buffer
+	if err := plan.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	if v := strings.TrimSpace(b.String()); v != `{"expanded":null,"statuses":null}` {
+		t.Fatal(v)
+	}
+	loaded, err := ILoadPlan(&b, state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.expanded) != 0 {
+		t.Error(loaded.expanded)
+	}
+	if expected, actual := replacePointers(plan.Node().String()), replacePointers(loaded.Node().String()); expected != actual {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
+
+func TestLoadPlan_invalid(t *testing.T) {
+	state := newGraphState()
+	for _, tc := range []struct {
+		Name  string
+		Input string
+		Err   string
+	}{
+		{`json`, `{`, `pabt: invalid saved plan: unexpected EOF`},
+		{`path`, `{"expanded":[[1]]}`, `pabt: invalid saved plan: no unexpanded condition at [1]`},
+		{`expanded`, `{"expanded":[[0],[0]]}`, `pabt: invalid saved plan: no unexpanded condition at [0]`},
+		{`statuses`, `{"expanded":[[0]],"statuses":[1]}`, `pabt: invalid saved plan: expected 3 statuses got 1`},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			if _, err := ILoadPlan(strings.NewReader(tc.Input), state, state.Goal()); err == nil || err.Error() != tc.Err {
+				t.Error(err)
+			}
+		})
+	}
+}
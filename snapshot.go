@@ -0,0 +1,77 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type (
+	// PlanSnapshot is a serializable (e.g. via [json.Marshal]) representation of the structure of a [Plan]'s tree,
+	// see [Plan.Snapshot].
+	PlanSnapshot struct {
+		// Root will be nil if the tree has been discarded, pending re-initialisation.
+		Root *NodeSnapshot `json:"root,omitempty"`
+	}
+
+	// NodeSnapshot models a single node in a [PlanSnapshot].
+	NodeSnapshot struct {
+		// Kind is the role of the node, one of goal, ppa, action, or precondition.
+		Kind string `json:"kind"`
+		// Tick is the tick type for group nodes, one of Sequence, Selector, or Memorize, and empty for leaf nodes.
+		Tick string `json:"tick,omitempty"`
+		// Post is true if the node is the post-condition of a ppa (an expanded precondition).
+		Post bool `json:"post,omitempty"`
+		// Key is the [Condition.Key] of precondition leaf nodes, formatted using [fmt.Sprint] if it cannot be
+		// marshalled as JSON.
+		Key any `json:"key,omitempty"`
+		// Children are the child nodes, in order.
+		Children []NodeSnapshot `json:"children,omitempty"`
+	}
+)
+
+// Snapshot returns a [PlanSnapshot] of the current tree, which excludes any behavior tree nodes, and is intended for
+// offline analysis and comparison, e.g. in tests.
+// It may only be called between ticks of the root [Plan.Node], i.e. not
+// concurrently with ticking the root [Plan.Node].
+func (p *Plan[T]) Snapshot() (snapshot PlanSnapshot) {
+	if p.root != nil {
+		root := p.root.snapshot()
+		snapshot.Root = &root
+	}
+	return
+}
+
+func (n *node[T]) snapshot() (snapshot NodeSnapshot) {
+	snapshot.Kind = n.kind()
+	if n.node == nil {
+		snapshot.Tick = tickKind(n.tick)
+	}
+	// note the post-condition node retains the context of the expanded precondition, i.e. the ppa of the parent
+	snapshot.Post = n.parent != nil && n.parent.ppa != nil && n.parent.ppa.post == n
+	if n.precondition != nil && n.node != nil {
+		snapshot.Key = n.precondition.condition.Key()
+		if _, err := json.Marshal(snapshot.Key); err != nil {
+			snapshot.Key = fmt.Sprint(snapshot.Key)
+		}
+	}
+	for child := n.first; child != nil; child = child.next {
+		snapshot.Children = append(snapshot.Children, child.snapshot())
+	}
+	return
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"encoding/json"
+	bt "github.com/joeycumines/go-behaviortree"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlan_Snapshot_preconditions(t *testing.T) {
+	cond := func(key int) Condition {
+		return &mockCondition{key: func() any { return key }, match: func(value any) bool { return false }}
+	}
+	plan, err := INew(&mockState{}, []IConditions{
+		{cond(2)},
+		{cond(1), cond(3)},
+		{cond(1), cond(3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.MarshalIndent(plan.Snapshot(), ``, `  `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, '\n')
+	golden := filepath.Join(`testdata`, `snapshot_preconditions.golden.json`)
+	if *updateGolden {
+		if err := os.WriteFile(golden, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(expected) {
+		t.Errorf("unexpected output:\n%s", b)
+	}
+}
+
+func TestPlan_Snapshot_expanded(t *testing.T) {
+	state := &mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions: func(failed Condition) ([]IAction, error) {
+			return []IAction{&simpleAction{
+				conditions: []IConditions{{&mockCondition{
+					key:   func() any { return complex(1, 2) },
+					match: func(value any) bool { return false },
+				}}},
+				effects: Effects{&simpleEffect{key: `x`, value: 1}},
+				node:    failureNode(),
+			}}, nil
+		},
+	}
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	b, err := json.Marshal(plan.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != `{"root":{"kind":"goal","tick":"Sequence","children":[{"kind":"ppa","tick":"Selector","children":[{"kind":"precondition","post":true,"key":"x"},{"kind":"action","tick":"Sequence","children":[{"kind":"precondition","key":"(1+2i)"},{"kind":"action"}]}]}]}}` {
+		t.Error(s)
+	}
+	plan.root = nil
+	if snapshot := plan.Snapshot(); snapshot.Root != nil {
+		t.Error(snapshot)
+	}
+}
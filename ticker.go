@@ -0,0 +1,113 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"errors"
+	bt "github.com/joeycumines/go-behaviortree"
+	"sync"
+	"time"
+)
+
+type (
+	// PlanTicker drives a [Plan] from an external clock source, see [NewPlanTicker].
+	PlanTicker[T Condition] struct {
+		plan   *Plan[T]
+		node   bt.Node
+		tick   <-chan time.Time
+		stop   chan struct{}
+		done   chan struct{}
+		once   sync.Once
+		mutex  sync.Mutex
+		status bt.Status
+		err    error
+	}
+
+	// IPlanTicker is an alias for a [PlanTicker] without a more-specific [Condition] type.
+	IPlanTicker = PlanTicker[Condition]
+)
+
+// NewPlanTicker constructs a new [PlanTicker], which will tick the [Plan.Node] once per value received from tick,
+// stopping on [bt.Success], or an error (returned by the tick, or per [Plan.Err]), or if tick is closed, or
+// [PlanTicker.Stop] is called. Note that ticking continues after a [bt.Failure] without an error, as the [Plan] will
+// re-refine the tree, e.g. if an action failed, or the refinement was stale. This is analogous to [bt.NewTicker], but
+// allows the caller to control the clock.
+//
+// WARNING: The plan must not be ticked by anything else, until the ticker is done.
+func NewPlanTicker[T Condition](p *Plan[T], tick <-chan time.Time) *PlanTicker[T] {
+	if p == nil {
+		panic(errors.New(`pabt: nil plan`))
+	}
+	if tick == nil {
+		panic(errors.New(`pabt: nil tick channel`))
+	}
+	t := &PlanTicker[T]{
+		plan: p,
+		node: p.Node(),
+		tick: tick,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Done returns a channel that will be closed once the ticker has stopped.
+func (t *PlanTicker[T]) Done() <-chan struct{} { return t.done }
+
+// Err returns the error from the last tick, if any.
+func (t *PlanTicker[T]) Err() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.err
+}
+
+// Status returns the status from the last tick, which will be zero (invalid) prior to the first tick.
+func (t *PlanTicker[T]) Status() bt.Status {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.status
+}
+
+// Stop shuts down the ticker, and is safe to call multiple times, note that it doesn't wait for Done.
+func (t *PlanTicker[T]) Stop() { t.once.Do(func() { close(t.stop) }) }
+
+func (t *PlanTicker[T]) run() {
+	defer close(t.done)
+	for {
+		select {
+		case <-t.stop:
+			return
+		case _, ok := <-t.tick:
+			if !ok {
+				return
+			}
+		}
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		status, err := t.node.Tick()
+		t.mutex.Lock()
+		t.status, t.err = status, err
+		t.mutex.Unlock()
+		if err != nil || status == bt.Success || t.plan.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+   Copyright 2021 Joseph Cumines
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pabt
+
+import (
+	"errors"
+	bt "github.com/joeycumines/go-behaviortree"
+	"testing"
+	"time"
+)
+
+func TestNewPlanTicker(t *testing.T) {
+	state := newGraphState()
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		clock  = make(chan time.Time)
+		ticker = NewPlanTicker(plan, clock)
+		ticks  int
+	)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case clock <- time.Time{}:
+			ticks++
+		case <-ticker.Done():
+			done = true
+		case <-time.After(time.Second * 5):
+			t.Fatal(`timeout`)
+		}
+	}
+	if status, err := ticker.Status(), ticker.Err(); status != bt.Success || err != nil {
+		t.Fatal(status, err)
+	}
+	if state.actor != state.goal[0] {
+		t.Error(state.actor.name)
+	}
+	if ticks < 2 {
+		t.Error(ticks)
+	}
+}
+
+func TestNewPlanTicker_err(t *testing.T) {
+	expected := errors.New(`some error`)
+	plan, err := INew(&mockState{
+		variable: func(key any) (any, error) { return nil, expected },
+		actions:  func(failed Condition) ([]IAction, error) { return nil, expected },
+	}, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := make(chan time.Time, 1)
+	clock <- time.Time{}
+	ticker := NewPlanTicker(plan, clock)
+	<-ticker.Done()
+	if status, err := ticker.Status(), ticker.Err(); status != bt.Failure || err != expected {
+		t.Error(status, err)
+	}
+}
+
+func TestNewPlanTicker_failure(t *testing.T) {
+	var (
+		vars  = map[any]any{`x`: 0}
+		calls int
+		state = &mockState{
+			variable: func(key any) (any, error) { return vars[key], nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node: bt.New(func([]bt.Node) (bt.Status, error) {
+						calls++
+						if calls == 1 {
+							// e.g. a transient failure, the plan will re-refine, then retry
+							return bt.Failure, nil
+						}
+						vars[`x`] = 1
+						return bt.Success, nil
+					}),
+				}}, nil
+			},
+		}
+	)
+	plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		clock  = make(chan time.Time)
+		ticker = NewPlanTicker(plan, clock)
+	)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case clock <- time.Time{}:
+		case <-ticker.Done():
+			done = true
+		case <-time.After(time.Second * 5):
+			t.Fatal(`timeout`)
+		}
+	}
+	if status, err := ticker.Status(), ticker.Err(); status != bt.Success || err != nil {
+		t.Fatal(status, err)
+	}
+	if calls != 2 || vars[`x`] != 1 {
+		t.Error(calls, vars)
+	}
+}
+
+func TestPlanTicker_Stop(t *testing.T) {
+	plan, err := INew(&mockState{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticker := NewPlanTicker(plan, make(chan time.Time))
+	ticker.Stop()
+	ticker.Stop()
+	<-ticker.Done()
+	if status, err := ticker.Status(), ticker.Err(); status != 0 || err != nil {
+		t.Error(status, err)
+	}
+}
+
+func TestPlanTicker_closed(t *testing.T) {
+	plan, err := INew(&mockState{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := make(chan time.Time)
+	close(clock)
+	ticker := NewPlanTicker(plan, clock)
+	<-ticker.Done()
+	if status, err := ticker.Status(), ticker.Err(); status != 0 || err != nil {
+		t.Error(status, err)
+	}
+}
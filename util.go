@@ -19,8 +19,38 @@ package pabt
 import (
 	"fmt"
 	bt "github.com/joeycumines/go-behaviortree"
+	"math"
+	"reflect"
+	"sort"
 )
 
+var (
+	// code pointers used to identify the tick of group nodes, see tickKind
+	tickSequence = reflect.ValueOf(bt.Sequence).Pointer()
+	tickSelector = reflect.ValueOf(bt.Selector).Pointer()
+	tickMemorize = reflect.ValueOf(bt.Memorize(bt.Selector)).Pointer()
+)
+
+// newNode returns a node initialised to v, reusing a released node if available, see config.release
+func (c *config[T]) newNode(v node[T]) *node[T] {
+	n, _ := c.nodes.Get().(*node[T])
+	if n == nil {
+		n = new(node[T])
+	}
+	*n = v
+	return n
+}
+
+// release resets then pools every node in the tree, which must no longer be referenced, see config.newNode
+func (c *config[T]) release(root *node[T]) {
+	var nodes []*node[T]
+	root.walk(0, func(n *node[T], _ int) { nodes = append(nodes, n) })
+	for _, n := range nodes {
+		*n = node[T]{}
+		c.nodes.Put(n)
+	}
+}
+
 func (n *node[T]) append(next *node[T], children ...*node[T]) {
 	if n.node != nil {
 		panic(fmt.Errorf(`pabt: invalid append`))
@@ -82,12 +112,12 @@ func (n *node[T]) generateOr(goal []Conditions[T]) (or []*preconditions[T], err
 	default:
 		n.tick = bt.Selector
 		for range goal {
-			node := &node[T]{
+			node := n.goal.config.newNode(node[T]{
 				goal:          n.goal,
 				ppa:           n.ppa,
 				action:        n.action,
 				preconditions: &preconditions[T]{},
-			}
+			})
 			node.preconditions.root = node
 			n.append(nil, node)
 			or = append(or, node.preconditions)
@@ -98,6 +128,9 @@ func (n *node[T]) generateOr(goal []Conditions[T]) (or []*preconditions[T], err
 		if err != nil {
 			return
 		}
+		for _, condition := range goal[i] {
+			preconditions.keys = append(preconditions.keys, condition.Key())
+		}
 	}
 	return
 }
@@ -106,28 +139,47 @@ func (n *node[T]) generateAnd(conditions Conditions[T]) (and map[any]*preconditi
 	if len(conditions) == 0 {
 		return
 	}
+	if a, b, ok := contradiction(conditions); ok {
+		err = fmt.Errorf(`%w: (%T) %v and (%T) %v`, ErrContradictoryConditions, a, a, b, b)
+		return
+	}
 	n.tick = bt.Sequence
 	and = make(map[any]*precondition[T], len(conditions))
-	for _, condition := range conditions {
+	for i, condition := range conditions {
 		key := condition.Key()
+		var duplicate bool
 		if !func() bool {
 			defer func() { _ = recover() }()
-			if _, ok := and[key]; ok {
-				return false
-			}
+			_, duplicate = and[key]
 			return true
 		}() {
+			err = fmt.Errorf(`%w: key %d of type %T is not comparable`, err, i, key)
 			return
 		}
-		node := &node[T]{
+		if duplicate {
+			err = fmt.Errorf(`%w: (%T) %v`, ErrDuplicateConditionKey, key, key)
+			return
+		}
+		node := n.goal.config.newNode(node[T]{
 			goal:          n.goal,
 			ppa:           n.ppa,
 			action:        n.action,
 			preconditions: n.preconditions,
 			precondition:  &precondition[T]{condition: condition},
-		}
+		})
 		node.precondition.root = node
-		node.node = newConditionNode(n.goal.state, key, condition.Match, &node.precondition.status)
+		if guard, ok := any(condition).(GuardCondition); ok {
+			if node.node = guard.Guard(); node.node == nil {
+				err = fmt.Errorf(`pabt: invalid condition guard`)
+				return
+			}
+			node.node = newGuardConditionNode(node.node, &node.precondition.status, node.precondition.observe)
+		} else {
+			node.node = newConditionNode(n.goal.state, key, node.precondition.match, &node.precondition.status, node.precondition.observe)
+		}
+		if c := n.goal.config; c.checkInterval > 1 && c.checkTagged(condition) {
+			node.node = newCachedConditionNode(node.node, c.checkInterval, &node.precondition.status)
+		}
 		n.append(nil, node)
 		and[key] = node.precondition
 	}
@@ -149,11 +201,14 @@ func (n *node[T]) group() (tick bt.Tick, children []bt.Node) {
 	return
 }
 
+// newConditionNode builds a node evaluating match against the value of key, where outcome (if non-nil) will be set
+// to the resulting status, which callers need only provide to record the precondition.status, used by search
 func newConditionNode[T Condition](
 	state State[T],
 	key any,
 	match func(value any) bool,
 	outcome *bt.Status,
+	observe func(status bt.Status),
 ) bt.Node {
 	return bt.New(func([]bt.Node) (status bt.Status, err error) {
 		var value any
@@ -163,11 +218,122 @@ func newConditionNode[T Condition](
 		} else {
 			status = bt.Failure
 		}
-		*outcome = status
+		if outcome != nil {
+			*outcome = status
+		}
+		if observe != nil {
+			observe(status)
+		}
 		return
 	})
 }
 
+// newGuardConditionNode wraps the node supplied by a GuardCondition, recording the outcome like newConditionNode,
+// where errors are treated as bt.Failure
+func newGuardConditionNode(guard bt.Node, outcome *bt.Status, observe func(status bt.Status)) bt.Node {
+	return func() (bt.Tick, []bt.Node) {
+		tick, children := guard()
+		if tick == nil {
+			return nil, children
+		}
+		return func(children []bt.Node) (status bt.Status, err error) {
+			status, err = tick(children)
+			if err != nil {
+				status = bt.Failure
+			}
+			*outcome = status
+			if observe != nil {
+				observe(status)
+			}
+			return
+		}, children
+	}
+}
+
+// newCachedConditionNode wraps a condition node such that it is only evaluated every interval ticks, reusing the last
+// outcome in between, note that errors are never cached
+func newCachedConditionNode(node bt.Node, interval int, outcome *bt.Status) bt.Node {
+	var skip int
+	return func() (bt.Tick, []bt.Node) {
+		if skip > 0 {
+			skip--
+			return func([]bt.Node) (bt.Status, error) { return *outcome, nil }, nil
+		}
+		tick, children := node()
+		return func(children []bt.Node) (status bt.Status, err error) {
+			status, err = tick(children)
+			if err == nil {
+				skip = interval - 1
+			}
+			return
+		}, children
+	}
+}
+
+// match evaluates a value from the state against the condition, applying hysteresis if supported
+func (p *precondition[T]) match(value any) bool {
+	if c, ok := any(p.condition).(HysteresisCondition); ok && p.status == bt.Success {
+		return c.Retain(value)
+	}
+	return p.condition.Match(value)
+}
+
+// record wraps the node (the bt of the receiver's root) to record it's status, see Plan.Progress
+func (p *preconditions[T]) record(node bt.Node) bt.Node {
+	return func() (bt.Tick, []bt.Node) {
+		tick, children := node()
+		if tick == nil {
+			return nil, children
+		}
+		return func(children []bt.Node) (status bt.Status, err error) {
+			status, err = tick(children)
+			if err != nil {
+				p.status = bt.Failure
+			} else {
+				p.status = status
+			}
+			return
+		}, children
+	}
+}
+
+// matchEffect evaluates a value from an effect against the condition, see ContextualCondition
+func matchEffect(condition Condition, value any) bool {
+	if c, ok := condition.(ContextualCondition); ok {
+		return c.MatchEffect(value)
+	}
+	return condition.Match(value)
+}
+
+// contradiction returns the keys of the first pair of conditions that contradict, see ContradictoryCondition
+func contradiction[T Condition](conditions Conditions[T]) (a, b any, ok bool) {
+	for i, x := range conditions {
+		for _, y := range conditions[i+1:] {
+			if c, o := any(x).(ContradictoryCondition); o && c.Contradicts(y) {
+				return x.Key(), y.Key(), true
+			}
+			if c, o := any(y).(ContradictoryCondition); o && c.Contradicts(x) {
+				return x.Key(), y.Key(), true
+			}
+		}
+	}
+	return
+}
+
+// observe maintains the goal's index of failed preconditions, and must be called with each new status, note that
+// only unexpanded preconditions are indexed, i.e. not those evaluated as the post condition of a ppa
+func (p *precondition[T]) observe(status bt.Status) {
+	g := p.root.goal
+	if status == bt.Failure && p.root.precondition == p {
+		if g.failed == nil {
+			g.failed = make(map[*precondition[T]]struct{})
+		}
+		g.failed[p] = struct{}{}
+	} else {
+		delete(g.failed, p)
+	}
+}
+
 // copy updates all fields of the receiver from src except the tree links then returns the receiver
 func (n *node[T]) copy(src *node[T]) *node[T] {
 	// TODO test
@@ -180,6 +346,10 @@ func (n *node[T]) copy(src *node[T]) *node[T] {
 	n.tick = src.tick
 	return n
 }
+
+// search performs a breadth-first search for the first failed, unexpanded precondition, and is the reference
+// implementation for goal.search, note that ties (at the same depth) are broken by left-to-right sibling order, which
+// is determined only by the structure of the tree
 func (n *node[T]) search() (*precondition[T], bool) {
 	queue := []*node[T]{n}
 	for len(queue) != 0 {
@@ -198,12 +368,241 @@ func (n *node[T]) search() (*precondition[T], bool) {
 	}
 	return nil, false
 }
+
+// search is equivalent to node.search (from the goal root), but only considers the indexed failed preconditions, and
+// will prune any which have since been expanded, note that the result must not depend on the (map) iteration order
+func (g *goal[T]) search() (cf *precondition[T], ok bool) {
+	var (
+		depth    int
+		distance float64
+	)
+	for p := range g.failed {
+		if p.root.precondition != p {
+			// expanded
+			delete(g.failed, p)
+			continue
+		}
+		d, attached := p.root.depth(g.root)
+		if !attached {
+			continue
+		}
+		var dist float64
+		if g.config.nearestFirst {
+			dist = conditionDistance(p.condition)
+			if ok && dist != distance {
+				if dist < distance {
+					cf, depth, distance = p, d, dist
+				}
+				continue
+			}
+		}
+		if !ok || d < depth || (d == depth && p.root.before(cf.root)) {
+			cf, depth, distance, ok = p, d, dist, true
+		}
+	}
+	return
+}
+
+// conditionDistance returns the distance of the condition, see DistanceCondition, or +Inf if not implemented (or NaN)
+func conditionDistance(condition Condition) float64 {
+	if condition, ok := condition.(DistanceCondition); ok {
+		if d := condition.Distance(); !math.IsNaN(d) {
+			return d
+		}
+	}
+	return math.Inf(1)
+}
+
+// actionCost returns the cost of the action, see CostedAction, or 0 if not implemented
+func actionCost[T Condition](act Action[T]) float64 {
+	if act, ok := act.(CostedAction[T]); ok {
+		return act.Cost()
+	}
+	return 0
+}
+
+// sortByCost returns a copy of candidates (indices of actions), stable sorted by ascending cost, see actionCost
+func sortByCost[T Condition](actions []Action[T], candidates []int) []int {
+	costs := make(map[int]float64, len(candidates))
+	for _, i := range candidates {
+		costs[i] = actionCost(actions[i])
+	}
+	candidates = append([]int(nil), candidates...)
+	sort.SliceStable(candidates, func(i, j int) bool { return costs[candidates[i]] < costs[candidates[j]] })
+	return candidates
+}
+
+// breakTies returns a copy of actions, with each run of actions with equal cost reordered by tieBreaker, see
+// WithTieBreaker
+func breakTies[T Condition](actions []Action[T], tieBreaker func(candidates []Action[T]) []Action[T]) ([]Action[T], error) {
+	result := make([]Action[T], 0, len(actions))
+	for i := 0; i < len(actions); {
+		j := i + 1
+		for cost := actionCost(actions[i]); j < len(actions) && actionCost(actions[j]) == cost; j++ {
+		}
+		run := actions[i:j]
+		if len(run) > 1 {
+			run = tieBreaker(append([]Action[T](nil), run...))
+			if len(run) != j-i {
+				return nil, fmt.Errorf(`pabt: tie breaker returned %d of %d actions`, len(run), j-i)
+			}
+		}
+		result = append(result, run...)
+		i = j
+	}
+	return result, nil
+}
+
+// depth returns the distance between the receiver and root, and false if root isn't an ancestor of the receiver
+func (n *node[T]) depth(root *node[T]) (depth int, ok bool) {
+	for ; n.parent != nil; n = n.parent {
+		depth++
+	}
+	ok = n == root
+	return
+}
+
+// before returns true if the receiver would be visited before o, by a breadth-first traversal, where both nodes must
+// be at the same depth, within the same tree
+func (n *node[T]) before(o *node[T]) bool {
+	for n.parent != o.parent {
+		n, o = n.parent, o.parent
+	}
+	for n = n.next; n != nil; n = n.next {
+		if n == o {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the index of each node from the root (exclusive) to the receiver (inclusive), see node.at
+func (n *node[T]) path() (path []int) {
+	for ; n.parent != nil; n = n.parent {
+		var i int
+		for o := n.prev; o != nil; o = o.prev {
+			i++
+		}
+		path = append(path, i)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return
+}
+
+// at returns the node at the given path, relative to the receiver, or nil if there is no such node
+func (n *node[T]) at(path []int) *node[T] {
+	for _, i := range path {
+		if i < 0 {
+			return nil
+		}
+		n = n.first
+		for ; n != nil && i > 0; i-- {
+			n = n.next
+		}
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// walk calls fn with each node in the tree, in depth-first order, along with it's depth relative to the receiver,
+// which must be provided as depth
+func (n *node[T]) walk(depth int, fn func(n *node[T], depth int)) {
+	fn(n, depth)
+	for n = n.first; n != nil; n = n.next {
+		n.walk(depth+1, fn)
+	}
+}
+
+// kind returns the role of the receiver, one of goal, ppa, action, or precondition, noting that group nodes for
+// alternative Conditions are classified by the tree they belong to
+func (n *node[T]) kind() string {
+	switch {
+	case n == n.goal.root:
+		return `goal`
+	case n.precondition != nil:
+		return `precondition`
+	case n.ppa != nil && n.ppa.root == n:
+		return `ppa`
+	case n.action != nil:
+		return `action`
+	case n.ppa != nil:
+		return `ppa`
+	default:
+		return `goal`
+	}
+}
+
+// tickKind returns the name of the tick used by a group node, note that all bt.Memorize ticks are equivalent
+func tickKind(tick bt.Tick) string {
+	if tick == nil {
+		return `nil`
+	}
+	switch reflect.ValueOf(tick).Pointer() {
+	case tickSequence:
+		return `Sequence`
+	case tickSelector:
+		return `Selector`
+	case tickMemorize:
+		return `Memorize`
+	default:
+		return `Tick`
+	}
+}
+
+// walkPreconditions calls fn with each precondition in the tree, in depth-first order
+func (n *node[T]) walkPreconditions(fn func(p *precondition[T])) {
+	n.walk(0, func(n *node[T], _ int) {
+		if n.precondition != nil {
+			fn(n.precondition)
+		}
+	})
+}
+
 func (p *precondition[T]) expand() (err error) {
-	var acts []Action[T]
-	acts, err = p.root.goal.state.Actions(p.condition)
+	var (
+		acts       []Action[T]
+		index      map[any][]int
+		candidates []int
+	)
+	if limit := p.root.goal.config.maxDepth; limit > 0 {
+		var depth int
+		for n := p.root; n.parent != nil; n = n.parent {
+			depth++
+		}
+		if depth > limit {
+			return ErrMaxDepthExceeded
+		}
+	}
+	acts, index, err = p.root.goal.config.actions(p.condition)
 	if err != nil {
 		return
 	}
+	if observer := p.root.goal.config.expandObserver; observer != nil {
+		observer(p.condition, acts)
+	}
+
+	if index != nil {
+		candidates = indexCandidates(index, p.condition.Key())
+	} else {
+		candidates = actionCandidates(acts, p.condition.Key())
+	}
+
+	if p.root.goal.config.costGuided {
+		candidates = sortByCost(acts, candidates)
+	}
+	ordered := make([]Action[T], 0, len(candidates))
+	for _, i := range candidates {
+		ordered = append(ordered, acts[i])
+	}
+	if tieBreaker := p.root.goal.config.tieBreaker; tieBreaker != nil {
+		if ordered, err = breakTies(ordered, tieBreaker); err != nil {
+			return
+		}
+	}
 
 	// original root is copied and used as the post-condition, then has it's links preserved and is updated
 	// with a new ppa (linking to the new copy), note the original root has all fields overwritten except it's links
@@ -211,20 +610,44 @@ func (p *precondition[T]) expand() (err error) {
 		goal: p.root.goal,
 		ppa: &ppa[T]{
 			root: p.root,
-			post: new(node[T]).copy(p.root),
+			post: p.root.goal.config.newNode(node[T]{}).copy(p.root),
 		},
 		tick: bt.Selector,
 	})
 	// first child of the selector is the post-condition
 	p.root.append(nil, p.root.ppa.post)
+	// no longer an unexpanded precondition, see observe
+	delete(p.root.goal.failed, p)
+
+	// skip any actions equal to an earlier one, see WithActionDeduplication
+candidates:
+	for _, candidate := range ordered {
+		if equal := p.root.goal.config.actionEqual; equal != nil {
+			for _, act := range p.root.ppa.candidates {
+				if equal(act, candidate) {
+					continue candidates
+				}
+			}
+		}
+		p.root.ppa.candidates = append(p.root.ppa.candidates, candidate)
+	}
 
 	// need to build all actions as their own trees first
-	for _, act := range acts {
-		_, err = p.root.generateAction(p.condition, act)
-		if err != nil {
-			return
+	if prior := p.root.goal.config.reused(p.condition, p.root.ppa.candidates); prior != nil {
+		p.root.reuseActions(prior)
+	} else {
+		for _, act := range p.root.ppa.candidates {
+			if limit := p.root.goal.config.maxActions; limit > 0 && len(p.root.ppa.actions) >= limit {
+				break
+			}
+			if _, err = p.root.generateAction(p.condition, act); err != nil {
+				break
+			}
 		}
 	}
+	if err != nil {
+		return
+	}
 
 	// switch how actions are wired up based on how many there are
 	switch len(p.root.ppa.actions) {
@@ -232,11 +655,11 @@ func (p *precondition[T]) expand() (err error) {
 	case 1:
 		p.root.append(nil, p.root.ppa.actions[0].root)
 	default:
-		node := &node[T]{
+		node := p.root.goal.config.newNode(node[T]{
 			goal: p.root.goal,
 			ppa:  p.root.ppa,
 			tick: bt.Memorize(bt.Selector),
-		}
+		})
 		for _, act := range p.root.ppa.actions {
 			node.append(nil, act.root)
 		}
@@ -244,57 +667,345 @@ func (p *precondition[T]) expand() (err error) {
 	}
 	return
 }
-func (n *node[T]) generateAction(post Condition, act Action[T]) (ok bool, err error) {
-	r := new(action[T])
 
-	// map the effects
-	{
-		effects := act.Effects()
-		if len(effects) == 0 {
+// reused returns (and removes) the ppa for failed from the discarded tree, if it considered the same candidate
+// actions, see WithSubtreeReuse
+func (c *config[T]) reused(failed T, candidates []Action[T]) (prior *ppa[T]) {
+	if c.reusable == nil {
+		return
+	}
+	func() {
+		defer func() { _ = recover() }()
+		prior = c.reusable[failed]
+	}()
+	if prior == nil {
+		return
+	}
+	delete(c.reusable, failed)
+	if len(prior.candidates) != len(candidates) {
+		return nil
+	}
+	for i, act := range candidates {
+		if !c.sameAction(prior.candidates[i], act) {
+			return nil
+		}
+	}
+	return
+}
+
+// sameAction compares actions using the configured equality, see WithActionDeduplication, or otherwise ==, where
+// non-comparable actions are never equal
+func (c *config[T]) sameAction(a, b Action[T]) (same bool) {
+	if c.actionEqual != nil {
+		return c.actionEqual(a, b)
+	}
+	defer func() { _ = recover() }()
+	return a == b
+}
+
+// reusable indexes each ppa in the (to be discarded) tree by it's post-condition, where the first (by depth-first
+// order) wins, see WithSubtreeReuse
+func (n *node[T]) reusable() map[any]*ppa[T] {
+	m := make(map[any]*ppa[T])
+	n.walk(0, func(n *node[T], _ int) {
+		if n.ppa == nil || n.ppa.root != n {
 			return
 		}
-		pk := post.Key()
-		r.effects = make(map[any]Effect, len(effects))
-		for _, effect := range effects {
-			key := effect.Key()
-			if !func() bool {
-				defer func() { _ = recover() }()
-				if _, ok := r.effects[key]; ok {
-					return false
+		condition := n.ppa.post.precondition.condition
+		func() {
+			defer func() { _ = recover() }()
+			if _, ok := m[condition]; !ok {
+				m[condition] = n.ppa
+			}
+		}()
+	})
+	return m
+}
+
+// reuseActions adds the actions of prior (from a discarded tree) to the receiver's ppa, reusing their subtrees, after
+// discarding any refinements of their preconditions (which may themselves be reused, as they are refined)
+func (n *node[T]) reuseActions(prior *ppa[T]) {
+	for _, r := range prior.actions {
+		for _, or := range r.or {
+			or.restore(r.node)
+		}
+		r.root.delete()
+		r.root.parent, r.root.prev, r.root.next = nil, nil, nil
+		r.root.walk(0, func(o *node[T], _ int) {
+			o.goal = n.goal
+			o.ppa = n.ppa
+		})
+		n.ppa.actions = append(n.ppa.actions, r)
+		// the statuses are retained, so any failures must be indexed, as cached conditions may not re-observe them
+		r.root.walkPreconditions(func(p *precondition[T]) {
+			if p.status == bt.Failure {
+				p.observe(p.status)
+			}
+		})
+	}
+}
+
+// restore reverts the receiver's group node to it's unexpanded preconditions (in order), followed by the action node,
+// if it belongs to the group, discarding any refinements, as well as any subtrees moved into it by conflict resolution
+func (c *preconditions[T]) restore(act *node[T]) {
+	children := make([]*node[T], 0, len(c.keys)+1)
+	for _, key := range c.keys {
+		p := c.and[key]
+		if p.root.precondition != p {
+			// expanded, the post node has the condition node
+			p.root = p.root.goal.config.newNode(node[T]{}).copy(p.root.ppa.post)
+		}
+		children = append(children, p.root)
+	}
+	if act.parent == c.root {
+		children = append(children, act)
+	}
+	for o := c.root.first; o != nil; {
+		next := o.next
+		o.parent, o.prev, o.next = nil, nil, nil
+		o = next
+	}
+	c.root.first, c.root.last = nil, nil
+	c.root.append(nil, children...)
+}
+
+// actions wraps State.Actions, applying the cache (if enabled), note that results for non-comparable conditions
+// won't be cached, also returns an index of the actions by effect key, if cached, see indexEffects
+func (c *config[T]) actions(failed T) (actions []Action[T], index map[any][]int, err error) {
+	if !c.cacheActions {
+		actions, err = c.stateActions(failed)
+		return
+	}
+	var (
+		cached cachedActions[T]
+		ok     bool
+	)
+	func() {
+		defer func() { _ = recover() }()
+		cached, ok = c.actionsCache[failed]
+	}()
+	if ok {
+		return cached.actions, cached.index, nil
+	}
+	actions, err = c.stateActions(failed)
+	if err != nil {
+		return
+	}
+	index = indexEffects(actions)
+	func() {
+		defer func() { _ = recover() }()
+		if c.actionsCache == nil {
+			c.actionsCache = make(map[any]cachedActions[T])
+		}
+		c.actionsCache[failed] = cachedActions[T]{actions: actions, index: index}
+	}()
+	return
+}
+
+// sortGoal returns a copy of goal, stable sorted using less, which compares the original indices, see WithGoalPriority
+func sortGoal[T Condition](goal []Conditions[T], less func(i, j int) bool) []Conditions[T] {
+	order := make([]int, len(goal))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return less(order[i], order[j]) })
+	sorted := make([]Conditions[T], len(goal))
+	for i, j := range order {
+		sorted[i] = goal[j]
+	}
+	return sorted
+}
+
+// stateActions calls State.Actions (or consumes StreamingState.ActionsSeq), returning a (stable) sorted copy, if an
+// action sorter is configured
+func (c *config[T]) stateActions(failed T) (actions []Action[T], err error) {
+	if state, ok := c.state.(StreamingState[T]); ok {
+		actions, err = c.streamActions(state, failed)
+	} else {
+		actions, err = c.state.Actions(failed)
+	}
+	if err == nil && c.actionSorter != nil && len(actions) > 1 {
+		actions = append([]Action[T](nil), actions...)
+		sort.SliceStable(actions, func(i, j int) bool { return c.actionSorter(actions[i], actions[j]) })
+	}
+	return
+}
+
+// streamActions consumes StreamingState.ActionsSeq, stopping once enough actions have been consumed to reach the
+// limit (see WithMaxActionsPerCondition), unless the actions may be reordered, e.g. by WithActionSorter, note that
+// actions are only counted if they may achieve failed, and (if configured) are not equal to an earlier action
+func (c *config[T]) streamActions(state StreamingState[T], failed T) (actions []Action[T], err error) {
+	limit := c.maxActions
+	if c.actionSorter != nil || c.costGuided || c.tieBreaker != nil {
+		limit = 0
+	}
+	var accepted []Action[T]
+actions:
+	for act, err := range state.ActionsSeq(failed) {
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, act)
+		if limit <= 0 {
+			continue
+		}
+		if _, ok, err := c.mapEffects(failed, act); !ok && err == nil {
+			continue
+		}
+		if c.actionEqual != nil {
+			for _, other := range accepted {
+				if c.actionEqual(other, act) {
+					continue actions
 				}
-				return true
-			}() {
-				return
 			}
-			r.effects[key] = effect
-			if !ok && key == pk && post.Match(effect.Value()) {
-				ok = true
+		}
+		if accepted = append(accepted, act); len(accepted) >= limit {
+			break
+		}
+	}
+	return
+}
+
+// actionCandidates returns the indices of the actions with an effect on key, in order, which is a cheaper pre-filter
+// for generateAction, as it avoids mapping the effects of actions which cannot achieve the condition, note that
+// actions with effect keys that panic on comparison are omitted, as generateAction would reject them, and that this
+// is only used for uncached actions, as building an index would require a map insert per effect, for a single lookup
+func actionCandidates[T Condition](actions []Action[T], key any) (candidates []int) {
+	for i, act := range actions {
+		if func() bool {
+			defer func() { _ = recover() }()
+			for _, effect := range act.Effects() {
+				if effect.Key() == key {
+					return true
+				}
 			}
+			return false
+		}() {
+			candidates = append(candidates, i)
 		}
 	}
+	return
+}
+
+// indexEffects maps each effect key to the indices of the actions with an effect on it, in order, built once per
+// cached State.Actions result, such that the equivalent of actionCandidates is a lookup, see indexCandidates, note
+// that actions with effect keys that aren't hashable are omitted entirely, as generateAction would reject them
+func indexEffects[T Condition](actions []Action[T]) map[any][]int {
+	index := make(map[any][]int)
+	for i, act := range actions {
+		effects := act.Effects()
+		if func() (ok bool) {
+			defer func() { _ = recover() }()
+			for _, effect := range effects {
+				_ = index[effect.Key()]
+			}
+			return true
+		}() {
+			for _, effect := range effects {
+				key := effect.Key()
+				if indices := index[key]; len(indices) == 0 || indices[len(indices)-1] != i {
+					index[key] = append(indices, i)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// indexCandidates returns the indices of the actions with an effect on key, from an index built by indexEffects,
+// note that a key that isn't hashable has no candidates
+func indexCandidates(index map[any][]int, key any) (candidates []int) {
+	defer func() { _ = recover() }()
+	return index[key]
+}
+
+// mapEffects maps the effects of act by key, where ok will be true if act may achieve post, noting that actions with
+// effects which are out of domain (see WithEffectValidator), or keys that panic on comparison, are never ok
+func (c *config[T]) mapEffects(post Condition, act Action[T]) (effects map[any]Effect, ok bool, err error) {
+	values := act.Effects()
+	if len(values) == 0 {
+		return
+	}
+	pk := post.Key()
+	effects = make(map[any]Effect, len(values))
+	for _, effect := range values {
+		key := effect.Key()
+		var duplicate bool
+		if !func() bool {
+			defer func() { _ = recover() }()
+			_, duplicate = effects[key]
+			return true
+		}() {
+			return nil, false, nil
+		}
+		if duplicate {
+			return nil, false, fmt.Errorf(`%w: (%T) %v`, ErrDuplicateEffectKey, key, key)
+		}
+		if c.effectValidator != nil && !c.effectValidator(effect) {
+			// out of domain
+			return nil, false, nil
+		}
+		effects[key] = effect
+		if !ok && key == pk && matchEffect(post, effect.Value()) {
+			ok = true
+		}
+	}
+	return
+}
+
+func (n *node[T]) generateAction(post Condition, act Action[T]) (ok bool, err error) {
+	r := &action[T]{value: act}
+
+	// map the effects
+	r.effects, ok, err = n.goal.config.mapEffects(post, act)
+	if err != nil {
+		return false, err
+	}
 	if !ok {
 		return false, nil
 	}
 
+	// map any resources
+	if act, ok := act.(ResourceAction[T]); ok {
+		if resources := act.Resources(); len(resources) != 0 {
+			distinct := make(map[any]struct{}, len(resources))
+			for _, key := range resources {
+				if !func() bool {
+					defer func() { _ = recover() }()
+					if _, ok := distinct[key]; !ok {
+						distinct[key] = struct{}{}
+						r.resources = append(r.resources, key)
+					}
+					return true
+				}() {
+					return false, fmt.Errorf(`pabt: invalid action resources`)
+				}
+			}
+		}
+	}
+
 	// create action node
 	if actNode := act.Node(); actNode == nil {
 		return false, fmt.Errorf(`pabt: invalid action`)
 	} else {
-		actNode = wrapActionNodeHandleSetRunning(n.goal.running, actNode)
-		r.node = &node[T]{
+		if n.goal.config.simulate != nil {
+			actNode = n.goal.config.simulate(act)
+		}
+		actNode = wrapActionNodeHandleSetRunning(n.goal.running, &n.goal.config.ticked, n.goal.config.actionErrors, actNode)
+		r.node = n.goal.config.newNode(node[T]{
 			goal:   n.goal,
 			ppa:    n.ppa,
 			action: r,
 			node:   actNode,
-		}
+		})
 	}
 
 	// build the conditions root as the action root (for the moment)
-	r.root = &node[T]{
+	r.root = n.goal.config.newNode(node[T]{
 		goal:   n.goal,
 		ppa:    n.ppa,
 		action: r,
-	}
+	})
 	r.or, err = r.root.generateOr(act.Conditions())
 	if err != nil {
 		return
@@ -307,12 +1018,12 @@ func (n *node[T]) generateAction(post Condition, act Action[T]) (ok bool, err er
 	default:
 		// more than one Conditions, need another layer
 		condRoot := r.root
-		r.root = &node[T]{
+		r.root = n.goal.config.newNode(node[T]{
 			goal:   n.goal,
 			ppa:    n.ppa,
 			action: r,
 			tick:   bt.Sequence,
-		}
+		})
 		r.root.append(nil, condRoot)
 	}
 
@@ -323,20 +1034,74 @@ func (n *node[T]) generateAction(post Condition, act Action[T]) (ok bool, err er
 	n.ppa.actions = append(n.ppa.actions, r)
 	return
 }
-func (p *ppa[T]) resolve() (conflicts int) {
-	for c := p.conflict(); c != nil; c = p.conflict() {
+func (p *ppa[T]) resolve() (conflicts int, err error) {
+	for c, ordered := p.conflict(); c != nil; c, ordered = p.conflict() {
+		if !ordered && c.irreversible() {
+			key := p.post.precondition.condition.Key()
+			return conflicts, fmt.Errorf(`%w: (%T) %v`, ErrIrreversibleConflict, key, key)
+		}
 		c.root.parent.append(c.root, p.root)
 		conflicts++
+		if observer := p.root.goal.config.conflictObs; observer != nil {
+			observer(&PPAInfo[T]{p}, &PPAInfo[T]{c})
+		}
+	}
+	if p.violatesOrdering() {
+		key := p.post.precondition.condition.Key()
+		return conflicts, fmt.Errorf(`%w: (%T) %v`, ErrOrderingConstraint, key, key)
+	}
+	return
+}
+
+// violatesOrdering returns true if any ordering constraint requires a subtree to be executed prior to p, where p
+// will be executed prior to it, i.e. the reverse of the case handled by conflict, which can't be resolved by moving p
+// (leftward or upward), see WithOrderingConstraint
+func (p *ppa[T]) violatesOrdering() (violated bool) {
+	if len(p.root.goal.config.ordering) == 0 {
+		return
 	}
+	p.root.goal.root.walk(0, func(n *node[T], _ int) {
+		if !violated && n.ppa != nil && n.ppa.root == n && n.ppa != p && n.ppa.precedes(p) && n.ppa.follows(p) {
+			violated = true
+		}
+	})
 	return
 }
-func (p *ppa[T]) conflict() *ppa[T] {
+
+// follows returns true if o will be executed prior to p, i.e. o is nested within (the conditions of) p's actions, or o
+// is one of the subtrees that conflict checks p against
+func (p *ppa[T]) follows(o *ppa[T]) bool {
+	for n := o.root.parent; n != nil; n = n.parent {
+		if n == p.root {
+			return true
+		}
+	}
+	n := p.root
+	for {
+		switch {
+		case n.prev != nil:
+			n = n.prev
+		case n.parent != nil && n.parent.ppa != nil:
+			n = n.parent.ppa.root
+			continue
+		default:
+			return false
+		}
+		if n == o.root {
+			return true
+		}
+	}
+}
+
+// conflict returns the nearest prior subtree that p must be moved ahead of, if any, where ordered indicates it was due
+// to an ordering constraint, rather than a conflict
+func (p *ppa[T]) conflict() (o *ppa[T], ordered bool) {
 	// finding a conflict involves checking the new subtree's (receiver) conditions against the
 	// effects of any actions that may be executed prior to it, in the tree structure
 	//
 	// the provided examples did not make it clear how to handle EITHER the multi-action or
 	// multi-condition cases (disjoint sets of either i.e. multiple feasible actions and
-	// multiple feasible sets of conditions).
+	// multiple feasible sets of conditions), see conflicts for how they are handled.
 	//
 	// Relevant excerpt:
 	//
@@ -376,60 +1141,136 @@ func (p *ppa[T]) conflict() *ppa[T] {
 			continue
 		default:
 			// no conflict
-			return nil
+			return nil, false
 		}
 		// n should always be an as-yet unchecked ppa root
-		if p.conflicts(n.ppa) {
-			return n.ppa
+		if p.precedes(n.ppa) {
+			return n.ppa, true
+		}
+		if strategy := p.root.goal.config.conflictOrder; strategy != nil {
+			if strategy(&PPAInfo[T]{p}, &PPAInfo[T]{n.ppa}) {
+				return n.ppa, false
+			}
+		} else if p.conflicts(n.ppa) {
+			return n.ppa, false
+		}
+	}
+}
+
+// precedes returns true if any ordering constraint requires p to be executed prior to o, see WithOrderingConstraint
+func (p *ppa[T]) precedes(o *ppa[T]) bool {
+	if len(o.actions) == 0 {
+		return false
+	}
+	for _, constraint := range p.root.goal.config.ordering {
+		if p.anyAction(constraint.before) && !o.anyAction(func(act Action[T]) bool { return !constraint.after(act) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// irreversible returns true if any of p's actions are irreversible, see IrreversibleAction
+func (p *ppa[T]) irreversible() bool {
+	return p.anyAction(func(act Action[T]) bool {
+		v, ok := act.(IrreversibleAction[T])
+		return ok && v.Irreversible()
+	})
+}
+func (p *ppa[T]) anyAction(fn func(act Action[T]) bool) bool {
+	for _, act := range p.actions {
+		if fn(act.value) {
+			return true
 		}
 	}
+	return false
 }
 func (p *ppa[T]) conflicts(o *ppa[T]) bool {
-	// prepare conditions for comparison
-	type Pair struct {
-		K any
-		V Condition
+	var resources []any
+	for _, act := range p.actions {
+		resources = append(resources, act.resources...)
 	}
-	var pairs []Pair
+
+	// only one of each of p's action's conditions (the or) must hold, meaning an action is only broken by o if all of
+	// them are, and (as with o) p's actions are alternatives, but any broken action will still be considered a
+	// conflict, as it may be the one that is executed
 	for _, act := range p.actions {
+		if len(act.or) == 0 {
+			if p.conflictsWith(o, nil, resources) {
+				return true
+			}
+			continue
+		}
+		broken := true
 		for _, or := range act.or {
-			for key, and := range or.and {
-				pairs = append(pairs, Pair{key, and.condition})
+			if !p.conflictsWith(o, or, resources) {
+				broken = false
+				break
 			}
 		}
+		if broken {
+			return true
+		}
 	}
 
+	return false
+}
+
+// conflictsWith implements conflicts for a single set of p's conditions (which may be nil)
+func (p *ppa[T]) conflictsWith(o *ppa[T], conditions *preconditions[T], resources []any) bool {
 	// fast path
-	if len(pairs) == 0 {
+	if (conditions == nil || len(conditions.keys) == 0) && len(resources) == 0 {
 		return false
 	}
 
 	// ensure that p's conditions are compatible with any corresponding effects from o (also checks all sub-ppa)
-	queue := []*ppa[T]{o}
-	for len(queue) != 0 {
-		o = queue[0]
-		queue[0] = nil
-		queue = queue[1:]
-		for _, act := range o.actions {
-			for _, pair := range pairs {
-				if eff, ok := act.effects[pair.K]; ok && !pair.V.Match(eff.Value()) {
-					return true
+	// and that p doesn't share any resources with o, except where o is p (which may be a sub-ppa)
+	//
+	// only one of o's actions will be executed (they are alternatives, under a memorized selector), meaning o only
+	// conflicts if all of it's actions do, where each action conflicts if it's own effects or resources do, or if
+	// any of the (expanded) preconditions guarding it do
+	var (
+		ppaConflicts    func(o *ppa[T]) bool
+		actionConflicts = func(o *ppa[T], act *action[T]) bool {
+			if conditions != nil {
+				for _, key := range conditions.keys {
+					if eff, ok := act.effects[key]; ok && !matchEffect(conditions.and[key].condition, eff.Value()) {
+						return true
+					}
+				}
+			}
+			if o != p {
+				for _, key := range resources {
+					for _, other := range act.resources {
+						if key == other {
+							return true
+						}
+					}
 				}
 			}
 			for _, or := range act.or {
-				for _, and := range or.and {
-					if and.root == and.root.ppa.root {
-						queue = append(queue, and.root.ppa)
+				for _, key := range or.keys {
+					if and := or.and[key]; and.root == and.root.ppa.root && ppaConflicts(and.root.ppa) {
+						return true
 					}
 				}
 			}
+			return false
 		}
+	)
+	ppaConflicts = func(o *ppa[T]) bool {
+		for _, act := range o.actions {
+			if !actionConflicts(o, act) {
+				return false
+			}
+		}
+		return len(o.actions) != 0
 	}
 
-	return false
+	return ppaConflicts(o)
 }
 
-func wrapActionNodeHandleSetRunning(running *bool, actNode bt.Node) bt.Node {
+func wrapActionNodeHandleSetRunning(running, ticked *bool, policy ActionErrorPolicy, actNode bt.Node) bt.Node {
 	return func() (bt.Tick, []bt.Node) {
 		tick, children := actNode()
 		if tick == nil {
@@ -437,6 +1278,10 @@ func wrapActionNodeHandleSetRunning(running *bool, actNode bt.Node) bt.Node {
 		}
 		return func(children []bt.Node) (status bt.Status, err error) {
 			status, err = tick(children)
+			*ticked = true
+			if err != nil && policy == ActionErrorReplan {
+				status, err = bt.Failure, nil
+			}
 			if err == nil && status == bt.Running {
 				*running = true
 			}
@@ -17,8 +17,11 @@
 package pabt
 
 import (
+	"errors"
 	"fmt"
 	bt "github.com/joeycumines/go-behaviortree"
+	"math"
+	"reflect"
 	"testing"
 )
 
@@ -405,3 +408,727 @@ func Test_node_append_panic(t *testing.T) {
 	(&node[Condition]{node: func() (bt.Tick, []bt.Node) { panic(`unexpected call`) }}).append(nil)
 	t.Error(`expected panic`)
 }
+
+func Test_goal_search(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		State *graphState
+	}{
+		{`graph`, newGraphState()},
+		{`grid`, newGridGraphState(5, 5)},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.State.frozen = true
+			plan, err := INew(tc.State, tc.State.Goal())
+			if err != nil {
+				t.Fatal(err)
+			}
+			node := plan.Node()
+			var checked int
+			for i := 0; i < 100; i++ {
+				if status, err := node.Tick(); err != nil || status != bt.Running {
+					t.Fatal(status, err)
+				}
+				// evaluate the conditions (no side effects, the state is frozen), to populate the index
+				if status, err := plan.root.bt().Tick(); err != nil || status != bt.Failure {
+					t.Fatal(status, err)
+				}
+				expected, expectedOK := plan.root.search()
+				actual, actualOK := plan.root.goal.search()
+				if expected != actual || expectedOK != actualOK {
+					t.Fatalf(`iteration %d: expected %p %v got %p %v`, i, expected, expectedOK, actual, actualOK)
+				}
+				if actualOK {
+					checked++
+				}
+			}
+			if checked != 100 {
+				t.Error(checked)
+			}
+		})
+	}
+}
+
+func Test_goal_search_tieBreak(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		Opts []IOption
+		A, B float64
+	}{
+		{`breadth first`, nil, 0, 0},
+		{`equal distance`, []IOption{WithNearestFirst[Condition]()}, 1, 1},
+		{`nan distance`, []IOption{WithNearestFirst[Condition]()}, math.NaN(), math.NaN()},
+		{`nan and inf`, []IOption{WithNearestFirst[Condition]()}, math.Inf(1), math.NaN()},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			// repeated, as goal.search iterates a map
+			for i := 0; i < 50; i++ {
+				plan, err := INew(
+					&mockState{variable: func(key any) (any, error) { return 0, nil }},
+					[]IConditions{
+						{&distanceCondition{simpleCondition{key: `a`, value: 1}, tc.A}},
+						{&distanceCondition{simpleCondition{key: `b`, value: 1}, tc.B}},
+					},
+					tc.Opts...,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// both conditions are evaluated (and fail), without expanding either
+				if status, err := plan.root.bt().Tick(); err != nil || status != bt.Failure {
+					t.Fatal(status, err)
+				}
+				if len(plan.root.goal.failed) != 2 {
+					t.Fatal(plan.root.goal.failed)
+				}
+				if cf, ok := plan.root.search(); !ok || cf.condition.Key() != `a` {
+					t.Fatal(cf, ok)
+				}
+				if cf, ok := plan.root.goal.search(); !ok || cf.condition.Key() != `a` {
+					t.Fatal(cf, ok)
+				}
+			}
+		})
+	}
+}
+
+func Test_precondition_observe_expanded(t *testing.T) {
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions: func(failed Condition) ([]IAction, error) {
+				return []IAction{&simpleAction{
+					effects: Effects{&simpleEffect{key: `x`, value: 1}},
+					node:    bt.New(func([]bt.Node) (bt.Status, error) { return bt.Running, nil }),
+				}}, nil
+			},
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// expands x, then the post condition (x) is evaluated (and fails) each tick, while the action runs
+	for i := 0; i < 5; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+		for p := range plan.root.goal.failed {
+			if p.root.precondition != p {
+				t.Fatal(i, p.condition.Key())
+			}
+		}
+	}
+}
+
+type resourceAction struct {
+	simpleAction
+	resources []any
+}
+
+func (a *resourceAction) Resources() []any { return a.resources }
+
+func Test_ppa_conflicts_resources(t *testing.T) {
+	for _, tc := range []struct {
+		Name      string
+		Resources []any
+		Order     []string
+	}{
+		{`none`, nil, []string{`a`, `b`}},
+		{`shared`, []any{`dock`}, []string{`b`, `a`}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				vars      = map[any]any{`a`: 0, `b`: 0}
+				newAction = func(key string) *resourceAction {
+					return &resourceAction{
+						simpleAction: simpleAction{
+							effects: Effects{&simpleEffect{key: key, value: 1}},
+							node: bt.New(func([]bt.Node) (bt.Status, error) {
+								vars[key] = 1
+								return bt.Success, nil
+							}),
+						},
+						resources: tc.Resources,
+					}
+				}
+				state = &mockState{
+					variable: func(key any) (any, error) { return vars[key], nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						return []IAction{newAction(failed.Key().(string))}, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{&simpleCondition{key: `a`, value: 1}, &simpleCondition{key: `b`, value: 1}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// expands a, then ticks a's action and expands b
+			for i := 0; i < 2; i++ {
+				if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+					t.Fatal(i, status, err)
+				}
+			}
+			var order []string
+			for n := plan.root.first; n != nil; n = n.next {
+				if n.ppa == nil || n.ppa.root != n {
+					t.Fatal(`expected ppa`)
+				}
+				order = append(order, n.ppa.post.precondition.condition.Key().(string))
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.Order) {
+				t.Error(order)
+			}
+		})
+	}
+}
+
+func Test_ppa_conflicts_alternatives(t *testing.T) {
+	for _, tc := range []struct {
+		Name  string
+		W     []int // the w effect of each of x's actions
+		Order []string
+	}{
+		// only one of x's alternative actions conflicts with z's condition w=1
+		{`one`, []int{0, 1}, []string{`x`, `z`}},
+		{`all`, []int{0, 0}, []string{`z`, `x`}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				vars      = map[any]any{`w`: 0, `x`: 0, `z`: 0}
+				newAction = func(conditions []IConditions, effects ...*simpleEffect) IAction {
+					a := &simpleAction{conditions: conditions, node: bt.New(func([]bt.Node) (bt.Status, error) {
+						for _, effect := range effects {
+							vars[effect.key] = effect.value
+						}
+						return bt.Success, nil
+					})}
+					for _, effect := range effects {
+						a.effects = append(a.effects, effect)
+					}
+					return a
+				}
+				state = &mockState{
+					variable: func(key any) (any, error) { return vars[key], nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						switch failed.Key() {
+						case `x`:
+							var actions []IAction
+							for _, w := range tc.W {
+								actions = append(actions, newAction(nil, &simpleEffect{`x`, 1}, &simpleEffect{`w`, w}))
+							}
+							return actions, nil
+						case `z`:
+							return []IAction{newAction([]IConditions{{&simpleCondition{`w`, 1}}}, &simpleEffect{`z`, 1})}, nil
+						}
+						return nil, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `z`, value: 1}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// expands x, then ticks x's (first) action and expands z
+			for i := 0; i < 2; i++ {
+				if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+					t.Fatal(i, status, err)
+				}
+			}
+			var order []string
+			for n := plan.root.first; n != nil; n = n.next {
+				key := n.ppa.post.precondition.condition.Key().(string)
+				if key == `x` && len(n.ppa.actions) != 2 {
+					t.Fatal(len(n.ppa.actions))
+				}
+				order = append(order, key)
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.Order) {
+				t.Error(order)
+			}
+		})
+	}
+}
+
+func Test_ppa_conflicts_disjunction(t *testing.T) {
+	for _, tc := range []struct {
+		Name    string
+		Effects []*simpleEffect // the effects of x's action
+		Order   []string
+	}{
+		// z requires either w=1 or v=1, and x's action only breaks the former
+		{`one`, []*simpleEffect{{`x`, 1}, {`w`, 0}}, []string{`x`, `z`}},
+		{`all`, []*simpleEffect{{`x`, 1}, {`w`, 0}, {`v`, 0}}, []string{`z`, `x`}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var (
+				vars      = map[any]any{`v`: 0, `w`: 0, `x`: 0, `z`: 0}
+				newAction = func(conditions []IConditions, effects ...*simpleEffect) IAction {
+					a := &simpleAction{conditions: conditions, node: bt.New(func([]bt.Node) (bt.Status, error) {
+						for _, effect := range effects {
+							vars[effect.key] = effect.value
+						}
+						return bt.Success, nil
+					})}
+					for _, effect := range effects {
+						a.effects = append(a.effects, effect)
+					}
+					return a
+				}
+				state = &mockState{
+					variable: func(key any) (any, error) { return vars[key], nil },
+					actions: func(failed Condition) ([]IAction, error) {
+						switch failed.Key() {
+						case `x`:
+							return []IAction{newAction(nil, tc.Effects...)}, nil
+						case `z`:
+							return []IAction{newAction(
+								[]IConditions{{&simpleCondition{`w`, 1}}, {&simpleCondition{`v`, 1}}},
+								&simpleEffect{`z`, 1},
+							)}, nil
+						}
+						return nil, nil
+					},
+				}
+			)
+			plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}, &simpleCondition{key: `z`, value: 1}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// expands x, then ticks x's action and expands z
+			for i := 0; i < 2; i++ {
+				if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+					t.Fatal(i, status, err)
+				}
+			}
+			var order []string
+			for n := plan.root.first; n != nil; n = n.next {
+				order = append(order, n.ppa.post.precondition.condition.Key().(string))
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tc.Order) {
+				t.Error(order)
+			}
+		})
+	}
+}
+
+func Test_ppa_conflicts_deterministic(t *testing.T) {
+	run := func() (trees []string, reordered bool) {
+		var (
+			vars = map[any]any{`a`: 0, `b`: 0, `c`: 0, `d`: 0, `e`: 0}
+			set  = func(effects Effects) bt.Node {
+				return bt.New(func([]bt.Node) (bt.Status, error) {
+					for _, effect := range effects {
+						vars[effect.Key()] = effect.Value()
+					}
+					return bt.Success, nil
+				})
+			}
+			newAction = func(conditions IConditions, effects ...Effect) IAction {
+				a := &simpleAction{effects: effects, node: set(effects)}
+				if len(conditions) != 0 {
+					a.conditions = []IConditions{conditions}
+				}
+				return a
+			}
+			state = &mockState{
+				variable: func(key any) (any, error) { return vars[key], nil },
+				actions: func(failed Condition) ([]IAction, error) {
+					switch failed.Key() {
+					case `a`:
+						return []IAction{newAction(
+							IConditions{&simpleCondition{key: `c`, value: 1}, &simpleCondition{key: `d`, value: 1}, &simpleCondition{key: `e`, value: 1}},
+							&simpleEffect{key: `a`, value: 1}, &simpleEffect{key: `c`, value: 0}, &simpleEffect{key: `e`, value: 0},
+						)}, nil
+					case `b`:
+						return []IAction{newAction(
+							IConditions{&simpleCondition{key: `c`, value: 1}, &simpleCondition{key: `e`, value: 1}},
+							&simpleEffect{key: `b`, value: 1}, &simpleEffect{key: `d`, value: 0}, &simpleEffect{key: `c`, value: 0},
+						)}, nil
+					case `c`, `d`, `e`:
+						return []IAction{newAction(nil, &simpleEffect{key: failed.Key().(string), value: 1})}, nil
+					}
+					return nil, nil
+				},
+			}
+		)
+		plan, err := INew(state, []IConditions{{&simpleCondition{key: `a`, value: 1}, &simpleCondition{key: `b`, value: 1}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			status, err := plan.Node().Tick()
+			if err != nil {
+				t.Fatal(err)
+			}
+			trees = append(trees, replacePointers(plan.Node().String()))
+			if status == bt.Success {
+				break
+			}
+			if i > 100 {
+				t.Fatal(status)
+			}
+			var keys []any
+			for n := plan.root.first; n != nil; n = n.next {
+				if n.ppa != nil && n.ppa.root == n {
+					keys = append(keys, n.ppa.post.precondition.condition.Key())
+				} else {
+					keys = append(keys, n.precondition.condition.Key())
+				}
+			}
+			if fmt.Sprint(keys) == `[b a]` {
+				// the conflict was resolved by moving b's subtree before a's
+				reordered = true
+			}
+		}
+		if reordered && plan.Stats().ConflictsResolved == 0 {
+			t.Error(plan.Stats())
+		}
+		return
+	}
+	expected, reordered := run()
+	if !reordered {
+		t.Fatal(`expected conflict resolution`)
+	}
+	for i := 0; i < 50; i++ {
+		actual, _ := run()
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Fatalf("run %d differs", i)
+		}
+	}
+}
+
+func Test_node_generateAction_invalidResources(t *testing.T) {
+	act := &resourceAction{
+		simpleAction: simpleAction{
+			effects: Effects{&simpleEffect{key: `a`, value: 1}},
+			node:    failureNode(),
+		},
+		resources: []any{func() {}},
+	}
+	plan, err := INew(&mockState{
+		variable: func(key any) (any, error) { return 0, nil },
+		actions:  func(failed Condition) ([]IAction, error) { return []IAction{act}, nil },
+	}, []IConditions{{&simpleCondition{key: `a`, value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, err := plan.Node().Tick(); err == nil || err.Error() != `pabt: invalid action resources` || status != bt.Failure {
+		t.Error(status, err)
+	}
+}
+
+func newSearchBenchmarkPlan(b *testing.B) *IPlan {
+	state := newGridGraphState(20, 20)
+	state.frozen = true
+	plan, err := INew(state, state.Goal())
+	if err != nil {
+		b.Fatal(err)
+	}
+	node := plan.Node()
+	for i := 0; i < 200; i++ {
+		if status, err := node.Tick(); err != nil || status != bt.Running {
+			b.Fatal(status, err)
+		}
+	}
+	if status, err := plan.root.bt().Tick(); err != nil || status != bt.Failure {
+		b.Fatal(status, err)
+	}
+	return plan
+}
+
+func Benchmark_node_search(b *testing.B) {
+	plan := newSearchBenchmarkPlan(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := plan.root.search(); !ok {
+			b.Fatal(ok)
+		}
+	}
+}
+
+func Benchmark_goal_search(b *testing.B) {
+	plan := newSearchBenchmarkPlan(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := plan.root.goal.search(); !ok {
+			b.Fatal(ok)
+		}
+	}
+}
+
+type sliceEffect []int
+
+func (e sliceEffect) Key() any   { return []int(e) }
+func (e sliceEffect) Value() any { return nil }
+
+// manyEffectsActions returns n actions, each with effects on m keys, where every 10th action has an effect on x,
+// alternating between values matching and not matching x=1
+func manyEffectsActions(n, m int) (actions []IAction) {
+	for i := 0; i < n; i++ {
+		var effects Effects
+		for j := 0; j < m; j++ {
+			effects = append(effects, &simpleEffect{key: fmt.Sprintf(`k%d_%d`, i, j), value: j})
+		}
+		if i%10 == 0 {
+			effects[m/2] = &simpleEffect{key: `x`, value: 1 + i%20}
+		}
+		actions = append(actions, &simpleAction{effects: effects, node: failureNode()})
+	}
+	return
+}
+
+func Test_precondition_expand_candidates(t *testing.T) {
+	var (
+		actions = append(manyEffectsActions(40, 5),
+			// non-comparable key
+			&simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}, sliceEffect{1}}, node: failureNode()},
+			// matches
+			&simpleAction{effects: Effects{&simpleEffect{key: `y`, value: 2}, &simpleEffect{key: `x`, value: 1}}, node: failureNode()},
+		)
+		state = &mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+		}
+	)
+	// reference implementation: scan every effect of every action
+	var expected []int
+	for i, act := range actions {
+		var match, invalid bool
+		for _, effect := range act.Effects() {
+			key, ok := effect.Key().(string)
+			if !ok {
+				invalid = true
+				break
+			}
+			if key == `x` && effect.Value() == 1 {
+				match = true
+			}
+		}
+		if match && !invalid {
+			expected = append(expected, i)
+		}
+	}
+	if fmt.Sprint(expected) != `[0 20 41]` {
+		t.Fatal(expected)
+	}
+	for _, opts := range [][]IOption{nil, {WithActionsCache[Condition]()}} {
+		plan, err := INew(state, []IConditions{{&simpleCondition{key: `x`, value: 1}}}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := plan.Reset(); err != nil {
+				t.Fatal(err)
+			}
+			if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+				t.Fatal(status, err)
+			}
+			var selected []int
+			for _, r := range plan.root.first.ppa.actions {
+			search:
+				for j, act := range actions {
+					for _, effect := range act.Effects() {
+						if k, ok := effect.Key().(string); ok && r.effects[k] == effect {
+							selected = append(selected, j)
+							break search
+						}
+					}
+				}
+			}
+			if fmt.Sprint(selected) != fmt.Sprint(expected) {
+				t.Error(len(opts), i, selected)
+			}
+		}
+	}
+}
+
+func Test_indexEffects(t *testing.T) {
+	actions := append(manyEffectsActions(40, 5),
+		// duplicate key
+		&simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}, &simpleEffect{key: `x`, value: 2}}},
+		// non-hashable key
+		&simpleAction{effects: Effects{&simpleEffect{key: `x`, value: 1}, sliceEffect{1}}},
+	)
+	index := indexEffects(actions)
+	for _, key := range []any{`x`, `k3_2`, `k10_2`, `y`, 1} {
+		if a, b := indexCandidates(index, key), actionCandidates(actions[:41], key); fmt.Sprint(a) != fmt.Sprint(b) {
+			t.Error(key, a, b)
+		}
+	}
+	if v := indexCandidates(index, `x`); fmt.Sprint(v) != `[0 10 20 30 40]` {
+		t.Error(v)
+	}
+	if v := indexCandidates(index, []int{1}); v != nil {
+		t.Error(v)
+	}
+}
+
+func Benchmark_precondition_expand_candidates(b *testing.B) { benchmarkExpandCandidates(b) }
+
+func Benchmark_precondition_expand_candidates_cached(b *testing.B) {
+	benchmarkExpandCandidates(b, WithActionsCache[Condition]())
+}
+
+func benchmarkExpandCandidates(b *testing.B, opts ...IOption) {
+	actions := manyEffectsActions(500, 50)
+	plan, err := INew(
+		&mockState{
+			variable: func(key any) (any, error) { return 0, nil },
+			actions:  func(failed Condition) ([]IAction, error) { return actions, nil },
+		},
+		[]IConditions{{&simpleCondition{key: `x`, value: 1}}},
+		opts...,
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	node := plan.Node()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := plan.Reset(); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := node.Tick(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Test_newConditionNode_nilOutcome(t *testing.T) {
+	var observed []bt.Status
+	node := newConditionNode[Condition](
+		&mockState{variable: func(key any) (any, error) { return key, nil }},
+		1,
+		func(value any) bool { return value == 1 },
+		nil,
+		func(status bt.Status) { observed = append(observed, status) },
+	)
+	if status, err := node.Tick(); err != nil || status != bt.Success {
+		t.Fatal(status, err)
+	}
+	node = newConditionNode[Condition](
+		&mockState{variable: func(key any) (any, error) { return nil, errors.New(`some error`) }},
+		1,
+		func(value any) bool { return true },
+		nil,
+		nil,
+	)
+	if status, err := node.Tick(); err == nil || status != bt.Failure {
+		t.Fatal(status, err)
+	}
+	if fmt.Sprint(observed) != `[success]` {
+		t.Error(observed)
+	}
+}
+
+func Test_precondition_root_resolve(t *testing.T) {
+	plan := newConflictPlan(t)
+	check := func() {
+		t.Helper()
+		plan.root.walkPreconditions(func(p *precondition[Condition]) {
+			if p.root.precondition == p {
+				return
+			}
+			if p.root.ppa == nil || p.root.ppa.root != p.root || p.root.ppa.post.precondition != p {
+				t.Errorf(`stale root for %v`, p.condition.Key())
+			}
+			if _, ok := p.root.ppa.post.depth(plan.root); !ok {
+				t.Errorf(`detached post for %v`, p.condition.Key())
+			}
+		})
+	}
+	check()
+	// the z subtree was moved, to before x and y, and w (z's precondition) must still be found
+	if v := plan.root.first.ppa.post.precondition.condition.Key(); v != `z` {
+		t.Fatal(v)
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+		t.Fatal(status, err)
+	}
+	check()
+	var w *precondition[Condition]
+	plan.root.walkPreconditions(func(p *precondition[Condition]) {
+		if p.condition.Key() == `w` {
+			w = p
+		}
+	})
+	if w == nil || w.root.precondition == w || w.root.ppa.post.precondition != w {
+		t.Fatal(`expected w to be expanded`)
+	}
+	if cf, ok := plan.root.search(); ok {
+		t.Error(cf.condition.Key())
+	}
+	for i := 0; i < 10; i++ {
+		status, err := plan.Node().Tick()
+		if err != nil {
+			t.Fatal(err)
+		}
+		check()
+		if status == bt.Success {
+			return
+		}
+	}
+	t.Error(`expected success`)
+}
+
+func Test_config_release(t *testing.T) {
+	plan := newChainPlan(t, 5)
+	for i := 0; i < 3; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	var nodes []*node[Condition]
+	plan.root.walk(0, func(n *node[Condition], _ int) { nodes = append(nodes, n) })
+	plan.discard()
+	if plan.root != nil {
+		t.Fatal(plan.root)
+	}
+	// note the pool may drop nodes, e.g. with the race detector
+	released := make(map[*node[Condition]]struct{}, len(nodes))
+	for _, n := range nodes {
+		released[n] = struct{}{}
+	}
+	var count int
+	for v := plan.nodes.Get(); v != nil; v = plan.nodes.Get() {
+		n := v.(*node[Condition])
+		if _, ok := released[n]; !ok {
+			t.Fatal(`unexpected node`)
+		}
+		if !reflect.ValueOf(*n).IsZero() {
+			t.Errorf(`node not reset: %+v`, *n)
+		}
+		count++
+	}
+	if count == 0 || count > len(nodes) {
+		t.Error(count, len(nodes))
+	}
+	for _, n := range nodes {
+		if !reflect.ValueOf(*n).IsZero() {
+			t.Errorf(`node not reset: %+v`, *n)
+		}
+	}
+
+	// released nodes are reused, and the plan continues as normal
+	for _, n := range nodes {
+		plan.nodes.Put(n)
+	}
+	if err := plan.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := released[plan.root]; !ok {
+		t.Error(`expected a reused node`)
+	}
+	for i := 0; i < 5; i++ {
+		if status, err := plan.Node().Tick(); err != nil || status != bt.Running {
+			t.Fatal(i, status, err)
+		}
+	}
+	if status, err := plan.Node().Tick(); err != nil || status != bt.Failure || plan.root != nil {
+		t.Fatal(status, err)
+	}
+}